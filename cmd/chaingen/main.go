@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"storage-mining/internal/chaingen"
+	"strings"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/pkg/errors"
+)
+
+// Generator of the runtime types, storage accessors, call builders and
+// event structs of the cess pallets, run by go generate in
+// internal/chain/cess. With -rpc it saves the metadata of a node instead.
+func main() {
+	var (
+		metaPath string
+		outPath  string
+		pkg      string
+		pallets  string
+		rpcAddr  string
+	)
+	flag.StringVar(&metaPath, "meta", "metadata.hex", "Metadata `file`, hex or raw SCALE")
+	flag.StringVar(&outPath, "out", "runtime_gen.go", "Generated `file`")
+	flag.StringVar(&pkg, "pkg", os.Getenv("GOPACKAGE"), "Package `name` of the generated file")
+	flag.StringVar(&pallets, "pallets", "Sminer,SegmentBook", "Comma separated `pallets` to generate")
+	flag.StringVar(&rpcAddr, "rpc", "", "RPC address of a node, to save its metadata to -meta")
+	flag.Parse()
+
+	var err error
+	if rpcAddr != "" {
+		err = saveMetadata(rpcAddr, metaPath)
+	} else {
+		err = generate(metaPath, outPath, pkg, pallets)
+	}
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(1)
+	}
+}
+
+func generate(metaPath, outPath, pkg, pallets string) error {
+	if pkg == "" {
+		return errors.New("no package name, set -pkg")
+	}
+	meta, err := chaingen.LoadMetadata(metaPath)
+	if err != nil {
+		return errors.Wrap(err, "save the metadata of a node first with -rpc")
+	}
+	var list []string
+	for _, v := range strings.Split(pallets, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	src, err := chaingen.Generate(meta, pkg, list)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(outPath, src, 0644)
+	if err != nil {
+		return errors.Wrap(err, "WriteFile err")
+	}
+	fmt.Printf("\x1b[%dm[ok]\x1b[0m %v generated from %v\n", 42, outPath, metaPath)
+	return nil
+}
+
+// Save the metadata of the node as returned by state_getMetadata
+func saveMetadata(rpcAddr, metaPath string) error {
+	api, err := gsrpc.NewSubstrateAPI(rpcAddr)
+	if err != nil {
+		return errors.Wrap(err, "NewSubstrateAPI err")
+	}
+	var hex string
+	err = api.Client.Call(&hex, "state_getMetadata")
+	if err != nil {
+		return errors.Wrap(err, "state_getMetadata err")
+	}
+	err = ioutil.WriteFile(metaPath, []byte(hex+"\n"), 0644)
+	if err != nil {
+		return errors.Wrap(err, "WriteFile err")
+	}
+	_, err = chaingen.LoadMetadata(metaPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\x1b[%dm[ok]\x1b[0m metadata of %v saved to %v\n", 42, rpcAddr, metaPath)
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/signer"
+	"storage-mining/tools"
+	"strings"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Environment variable holding the token the miners authenticate with
+const tokenEnv = "CESS_SIGNER_TOKEN"
+
+// Calls signed when -allow is not given. Withdrawals and the exit have to
+// be allowed explicitly.
+var defaultCalls = []string{
+	configs.ChainTx_Sminer_Register,
+	configs.ChainTx_Sminer_UpdateAddress,
+	configs.ChainTx_Sminer_IncreaseCollateral,
+	configs.ChainTx_SegmentBook_IntentSubmit,
+	configs.ChainTx_SegmentBook_IntentSubmitPost,
+	configs.ChainTx_SegmentBook_SubmitToVpa,
+	configs.ChainTx_SegmentBook_SubmitToVpb,
+	configs.ChainTx_SegmentBook_SubmitToVpc,
+	configs.ChainTx_SegmentBook_SubmitToVpd,
+}
+
+// Signing service for the identity account of a miner, meant to run on a
+// separate host that keeps the keystore
+func main() {
+	var (
+		keystorePath string
+		listen       string
+		allow        string
+		rpcAddr      string
+		network      string
+		genesis      string
+		tlsCert      string
+		tlsKey       string
+	)
+	flag.StringVar(&keystorePath, "keystore", "keystore.json", "Keystore of the identity account")
+	flag.StringVar(&listen, "listen", "127.0.0.1:15010", "Listen `address`")
+	flag.StringVar(&allow, "allow", strings.Join(defaultCalls, ","), "Comma separated `calls` to sign")
+	flag.StringVar(&rpcAddr, "rpc", "", "RPC `address` of a node, to check that a payload is the call it claims to be (required)")
+	flag.StringVar(&network, "network", configs.DefaultNetwork, "Network `profile` of the chain: hacknet, testnet or dev")
+	flag.StringVar(&genesis, "genesis", "", "Genesis `hash` of the chain, required on hacknet and testnet whose profiles have none yet")
+	flag.StringVar(&tlsCert, "tlscert", "", "TLS certificate `file`, serve https with -tlskey")
+	flag.StringVar(&tlsKey, "tlskey", "", "TLS key `file`")
+	flag.IntVar(&keystore.PassphraseFd, "passfd", -1, "Read the keystore passphrase from this `file descriptor`\n"+
+		"Otherwise it is taken from "+keystore.PassphraseEnv+" or asked for")
+	flag.Parse()
+
+	n, ok := configs.Networks[network]
+	if !ok {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m Unknown network '%v', use hacknet, testnet or dev\n", 41, network)
+		os.Exit(configs.Exit_Normal)
+	}
+	// checked before the passphrase is asked for
+	if genesis == "" && n.GenesisHash == "" && !n.AnyGenesis {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m The %v network has no genesis hash yet, -genesis is required\n", 41, network)
+		fmt.Printf("\x1b[%dm[note]\x1b[0m Get it from the operators of the network, 'mining compat' prints the genesis of the nodes\n", 43)
+		os.Exit(configs.Exit_Normal)
+	}
+	pass, err := keystore.Passphrase(fmt.Sprintf("Passphrase of %v: ", keystorePath), false)
+	if err == nil {
+		err = keystore.Load(keystorePath, pass)
+	}
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(configs.Exit_Keystore)
+	}
+	kp, err := signature.KeyringPairFromSecret(keystore.Secret(), 42)
+	if err == nil {
+		// the prefix of the network may not fit the one of the keyring
+		kp.Address, err = tools.EncodeSS58(kp.PublicKey, n.SS58Prefix)
+	}
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(configs.Exit_Keystore)
+	}
+
+	policy := &signer.Policy{Calls: make(map[string]bool)}
+	for _, v := range strings.Split(allow, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			policy.Calls[v] = true
+		}
+	}
+	// the call name of a request is only trusted once the payload
+	// carries the index of that call
+	if rpcAddr == "" {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m -rpc is required to check that a payload is the call it claims to be\n", 41)
+		os.Exit(configs.Exit_Normal)
+	}
+	api, err := gsrpc.NewSubstrateAPI(rpcAddr)
+	err = errors.Wrap(err, "NewSubstrateAPI err")
+	if err == nil {
+		policy.Genesis, err = chainGenesis(api, n, genesis)
+	}
+	if err == nil {
+		policy.CallIndex, err = callIndexer(api)
+	}
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(configs.Exit_Normal)
+	}
+
+	s := &signer.Server{
+		PublicKey: kp.PublicKey,
+		Address:   kp.Address,
+		Token:     os.Getenv(tokenEnv),
+		Policy:    policy,
+		Sign: func(payload []byte) ([]byte, error) {
+			return signature.Sign(payload, keystore.Secret())
+		},
+		Log: func(call string, err error) {
+			if err != nil {
+				log.Printf("refused %v: %v", call, err)
+			} else {
+				log.Printf("signed %v", call)
+			}
+		},
+	}
+	if s.Token == "" {
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m %v is not set, requests are not authenticated\n", 43, tokenEnv)
+	}
+	fmt.Printf("\x1b[%dm[ok]\x1b[0m Signing for %v on %v\n", 42, kp.Address, listen)
+	if tlsCert != "" {
+		err = http.ListenAndServeTLS(listen, tlsCert, tlsKey, s.Handler())
+	} else {
+		err = http.ListenAndServe(listen, s.Handler())
+	}
+	fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+	os.Exit(configs.Exit_Normal)
+}
+
+// The genesis hash the payloads must carry: -genesis, else the one of
+// the network profile. The node has to serve that chain, a dev chain
+// is taken as it is.
+func chainGenesis(api *gsrpc.SubstrateAPI, n configs.Network, genesis string) (types.Hash, error) {
+	h, err := api.RPC.Chain.GetBlockHash(0)
+	if err != nil {
+		return h, errors.Wrap(err, "GetBlockHash err")
+	}
+	if genesis == "" {
+		genesis = n.GenesisHash
+	}
+	if genesis == "" {
+		if n.AnyGenesis {
+			return h, nil
+		}
+		return h, errors.Errorf("the network has no genesis hash, set -genesis, the node has %v", h.Hex())
+	}
+	want, err := types.NewHashFromHexString(genesis)
+	if err != nil {
+		return want, errors.Wrapf(err, "genesis hash '%v'", genesis)
+	}
+	if h != want {
+		return want, errors.Errorf("the node serves the chain of genesis %v, not %v", h.Hex(), want.Hex())
+	}
+	return want, nil
+}
+
+// Look up call indexes in the metadata of the node
+func callIndexer(api *gsrpc.SubstrateAPI) (func(call string, refresh bool) (types.CallIndex, error), error) {
+	meta, err := api.RPC.State.GetMetadataLatest()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetMetadataLatest err")
+	}
+	return func(call string, refresh bool) (types.CallIndex, error) {
+		if refresh {
+			m, err := api.RPC.State.GetMetadataLatest()
+			if err != nil {
+				return types.CallIndex{}, errors.Wrap(err, "GetMetadataLatest err")
+			}
+			meta = m
+		}
+		return meta.FindCallIndex(call)
+	}, nil
+}
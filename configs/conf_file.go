@@ -7,19 +7,28 @@ type MinerOnChain struct {
 }
 
 type CessChain struct {
-	RpcAddr string `json:"rpcAddr"`
+	Network      string   `json:"network"`
+	GenesisHash  string   `json:"genesisHash"`
+	RpcAddr      string   `json:"rpcAddr"`
+	RpcAddrs     []string `json:"rpcAddrs"`
+	Confirmation string   `json:"confirmation"`
 }
 
 type MinerData struct {
 	PledgeTokens uint64 `json:"pledgeTokens"`
 	//RenewalTokens         uint64 `json:"renewalTokens"`
-	StorageSpace          uint64 `json:"storageSpace"`
-	MountedPath           string `json:"mountedPath"`
-	ServiceIpAddr         string `json:"serviceIpAddr"`
-	ServicePort           uint32 `json:"servicePort"`
-	FilePort              uint32 `json:"filePort"`
-	IncomeAccountPubkey   string `json:"incomeAccountPubkey"`
-	IdAccountPhraseOrSeed string `json:"idAccountPhraseOrSeed"`
+	CollateralTarget    uint64 `json:"collateralTarget"`
+	CollateralThreshold uint64 `json:"collateralThreshold"`
+	FeeRunway           uint64 `json:"feeRunway"`
+	StorageSpace        uint64 `json:"storageSpace"`
+	MountedPath         string `json:"mountedPath"`
+	ServiceIpAddr       string `json:"serviceIpAddr"`
+	ServicePort         uint32 `json:"servicePort"`
+	FilePort            uint32 `json:"filePort"`
+	IncomeAccountPubkey string `json:"incomeAccountPubkey"`
+	Keystore            string `json:"keystore"`
+	SignerUrl           string `json:"signerUrl"`
+	SignerToken         string `json:"signerToken"`
 }
 
 type FileSystem struct {
@@ -29,12 +38,27 @@ type FileSystem struct {
 var Confile = new(MinerOnChain)
 
 const ConfigFile_Templete = `[cessChain]
-# RPC address of CES public chain
+# Network profile: "hacknet", "testnet" or "dev". It sets the address prefix, the default RPC address and the genesis the chain must have.
+network = "hacknet"
+# Genesis hash of the chain, e.g. "0x1234...". Required on hacknet and testnet, whose profiles have none yet; not needed on dev.
+# Get it from the operators of the network. Without it the miner prints the genesis of the nodes in rpcAddr and stops.
+genesisHash = ""
+# RPC address of CES public chain, empty for the default of the network profile
 rpcAddr = ""
+# More RPC addresses of the same chain, the healthiest one is used and the client fails over automatically.
+rpcAddrs = []
+# When a transaction counts as done: "inblock", "finalized" or a number of confirmations, e.g. "3".
+confirmation = "inblock"
 
 [minerData]
 # The cess coin that the miner needs to pledge when registering, the unit is TCESS.
 pledgeTokens           = 2000
+# Collateral kept on the chain by '-t' and the automatic top-up, the unit is TCESS. 0 means pledgeTokens.
+collateralTarget       = 0
+# Top up to collateralTarget automatically when the collateral drops below this, the unit is TCESS. 0 disables it.
+collateralThreshold    = 0
+# Warn when the balance pays the fees of fewer proof transactions than this. 0 disables it.
+feeRunway              = 100
 # Total space used to store files, the unit is GB.
 storageSpace           = 1024
 # Path to the mounted disk where the data is saved
@@ -45,10 +69,14 @@ serviceIpAddr          = ""
 servicePort            = 15001
 # Port number for file service monitoring.
 filePort               = 15002
-# Public key of income account.
+# Income account, an SS58 address or a hex public key.
 incomeAccountPubkey    = ""
-# Phrase words or seeds for identity accounts.
-idAccountPhraseOrSeed  = ""
+# Encrypted keystore of the identity account, create it with 'key import'.
+keystore               = "keystore.json"
+# URL of a remote signing service holding the identity account, e.g. "https://10.0.0.2:15010". The keystore is not used then.
+signerUrl              = ""
+# Token to authenticate with the signing service.
+signerToken            = ""
 
 [fileSystem]
 # Installation path of Fastdfs 
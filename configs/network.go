@@ -0,0 +1,42 @@
+package configs
+
+// A cess network the miner can run on
+type Network struct {
+	// Hex hash of block 0. When empty genesisHash has to be set in the
+	// configuration file, unless AnyGenesis is true.
+	GenesisHash string
+	AnyGenesis  bool
+	SS58Prefix  uint16
+	// Used when rpcAddr is not set
+	RpcAddrs []string
+}
+
+// Profile of an empty 'network', the chain the miner ran on before
+// profiles were introduced
+const DefaultNetwork = "hacknet"
+
+// Named network profiles of 'network' in the configuration file
+// The hacknet and testnet profiles have no genesis hash yet, a
+// configuration file for them has to set genesisHash.
+var Networks = map[string]Network{
+	"hacknet": {
+		SS58Prefix: 42,
+		RpcAddrs:   []string{"wss://cesslab.co.uk/rpc2-hacknet/ws/"},
+	},
+	// cess-testnet in the ss58 registry, no public endpoint yet
+	"testnet": {
+		SS58Prefix: 11330,
+	},
+	// a local development chain, whose genesis changes with every purge
+	"dev": {
+		AnyGenesis: true,
+		SS58Prefix: 42,
+		RpcAddrs:   []string{"ws://127.0.0.1:9944"},
+	},
+}
+
+// The profile in use, set from the configuration file
+var (
+	NetworkName    = DefaultNetwork
+	NetworkProfile = Networks[DefaultNetwork]
+)
@@ -20,29 +20,50 @@ const (
 	Exit_DirSizeError             = -12
 	Exit_ReduceStorageSpace       = -13
 	Exit_FreeSpaceInvalid         = -14
+	Exit_MinerExit                = -15
+	Exit_Withdraw                 = -16
+	Exit_Keystore                 = -17
+	Exit_IncompatibleRuntime      = -18
 )
 
 // cess chain module
 const (
 	ChainModule_Sminer      = "Sminer"
 	ChainModule_SegmentBook = "SegmentBook"
+	ChainModule_Timestamp   = "Timestamp"
 )
 
 // cess chain module method
 const (
 	ChainModule_Sminer_MinerItems          = "MinerItems"
 	ChainModule_Sminer_SegInfo             = "SegInfo"
+	ChainModule_Sminer_MinerColling        = "MinerColling"
 	ChainModule_SegmentBook_ParamSetA      = "ParamSetA"
 	ChainModule_SegmentBook_ParamSetB      = "ParamSetB"
 	ChainModule_SegmentBook_ParamSetD      = "ParamSetD"
 	ChainModule_SegmentBook_ConProofInfoA  = "ConProofInfoA"
 	ChainModule_SegmentBook_ConProofInfoC  = "ConProofInfoC"
 	ChainModule_SegmentBook_MinerHoldSlice = "MinerHoldSlice"
+	ChainModule_SegmentBook_VerPoolA       = "VerPoolA"
+	ChainModule_SegmentBook_VerPoolB       = "VerPoolB"
+	ChainModule_SegmentBook_VerPoolC       = "VerPoolC"
+	ChainModule_SegmentBook_VerPoolD       = "VerPoolD"
+)
+
+// cess chain module constant
+const (
+	ChainConst_Sminer_LockInPeriod     = "LockInPeriod"
+	ChainConst_Timestamp_MinimumPeriod = "MinimumPeriod"
 )
 
 // cess chain Transaction name
 const (
 	ChainTx_Sminer_Register              = "Sminer.regnstk"
+	ChainTx_Sminer_ExitMining            = "Sminer.exit_miner"
+	ChainTx_Sminer_IncreaseCollateral    = "Sminer.increase_collateral"
+	ChainTx_Sminer_WithdrawEarnings      = "Sminer.withdraw_earnings"
+	ChainTx_Sminer_UpdateAddress         = "Sminer.update_ip"
+	ChainTx_Sminer_Withdraw              = "Sminer.withdraw"
 	ChainTx_SegmentBook_IntentSubmit     = "SegmentBook.intent_submit"
 	ChainTx_SegmentBook_IntentSubmitPost = "SegmentBook.intent_submit_po_st"
 	ChainTx_FileBank_Update              = "FileBank.update"
@@ -62,9 +83,37 @@ const (
 )
 
 const (
-	Vpb_SubmintPeriod  = 72
-	Vpd_SubmintPeriod  = 72
+	// Time between two Vpb or Vpd rounds until the interval of the timed
+	// task of the chain is known, turned into blocks with the block time
+	// of the chain. The rounds start at multiples of the period.
+	ProofWindow_S = 72 * 60
+	// Block time of a runtime without the Timestamp.MinimumPeriod constant
+	BlockTime_S = 6
+	// Blocks a signed transaction stays valid, counted from the finalized
+	// block it was signed at. A power of two.
+	TxMortalPeriod_B = 64
+	// Blocks before a failed proof round is tried again
+	BlocksToRetryProof = 10
+	// Blocks to wait while there is no space for new segments
+	BlocksToWaitSpace = 100
+	// Time without a new head before the chain is taken as stalled
+	TimeToStallHead_S  = 60
 	TimeToWaitEvents_S = 20
+	// Time to wait for confirmations or finality after the inclusion block
+	TimeToWaitConfirm_S = 180
+	// Health check interval of the rpc endpoints
+	TimeToCheckEndpoints_S = 25
+	// Blocks an rpc endpoint may fall behind the others before failing over
+	MaxBlockLag = 5
+	// Interval of the withdrawal attempts once the lock-in period is over
+	TimeToRetryWithdraw_M = 30
+	// Longest interval of the withdrawal attempts when the chain tells
+	// neither the lock-in period nor the outcome of a dry run
+	MaxTimeToRetryWithdraw_M = 24 * 60
+	// Interval of the collateral checks of the automatic top-up
+	TimeToCheckCollateral_M = 10
+	// Interval of the fee runway checks of the proof loops
+	TimeToCheckRunway_M = 10
 )
 
 const (
@@ -79,8 +128,13 @@ var (
 	//MinerEvent_Mining        bool
 	MinerEvent_Exit          bool
 	MinerEvent_RenewalTokens bool
+	MinerEvent_Earnings      bool
+	MinerEvent_Withdraw      bool
 )
 
+// Build, sign and validate the transactions without submitting them
+var DryRun bool
+
 // Miner data updated at runtime
 var (
 	MinerId_S     string = ""
@@ -96,4 +150,7 @@ var (
 	TmpltFileFolder   = "temp"
 	TmpltFileName     = "template"
 	FileData          = "fileData"
+	ExitFile          = "exit.json"
+	WithdrawalFile    = "withdrawals.log"
+	JournalFile       = "txjournal.log"
 )
@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/BurntSushi/toml v0.4.1 // indirect
 	github.com/CESSProject/cess-ffi v0.0.0-20220217052609-6c35c99d795c // indirect
+	github.com/ChainSafe/go-schnorrkel v0.0.0-20210318173838-ccb5cd955283
 	github.com/centrifuge/go-substrate-rpc-client/v4 v4.0.0
 	github.com/filecoin-project/go-address v0.0.6
 	github.com/filecoin-project/go-fil-commcid v0.1.0
@@ -18,11 +19,14 @@ require (
 	github.com/ipfs/go-ipfs-chunker v0.0.5
 	github.com/klauspost/reedsolomon v1.9.14
 	github.com/minio/blake2b-simd v0.0.0-20160723061019-3f5f724cb5b1
+	github.com/mr-tron/base58 v1.2.0
 	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/pkg/errors v0.9.1
 	github.com/shirou/gopsutil v3.21.10+incompatible
 	github.com/spf13/viper v1.9.0
 	go.uber.org/zap v1.19.1
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
+	golang.org/x/sys v0.0.0-20210823070655-63515b42dcdf
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
@@ -0,0 +1,51 @@
+package chain
+
+import (
+	"fmt"
+	"os"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"storage-mining/tools"
+)
+
+// Compare the ip on the chain with serviceIpAddr and update the service
+// address when it changed. MinerItems does not keep the ports, they are
+// sent along with the ip.
+func syncMinerAddress(mdata CessChain_MinerItems) {
+	ipint, err := tools.InetAtoN(configs.Confile.MinerData.ServiceIpAddr)
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m Invalid serviceIpAddr '%v'\n", 41, configs.Confile.MinerData.ServiceIpAddr)
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		os.Exit(configs.Exit_ConfFileFormatError)
+	}
+	if uint32(mdata.Ip) == uint32(ipint) {
+		return
+	}
+	onchain := tools.InetNtoA(int64(mdata.Ip))
+	logger.InfoLogger.Sugar().Infof("[C%v] service ip on the chain %v, configured %v", mdata.Peerid, onchain, configs.Confile.MinerData.ServiceIpAddr)
+
+	ok, err := Client.HasCall(configs.ChainTx_Sminer_UpdateAddress)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+	}
+	if !ok {
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m The service ip on the chain is %v, but serviceIpAddr is %v.\n", 43, onchain, configs.Confile.MinerData.ServiceIpAddr)
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m The chain has no %v call, files will be fetched from %v until the miner registers again.\n", 43, configs.ChainTx_Sminer_UpdateAddress, onchain)
+		logger.ErrLogger.Sugar().Errorf("[C%v] service ip %v differs from serviceIpAddr %v and %v is not available", mdata.Peerid, onchain, configs.Confile.MinerData.ServiceIpAddr, configs.ChainTx_Sminer_UpdateAddress)
+		return
+	}
+	ok, err = Client.UpdateAddress(
+		keystore.Secret(),
+		configs.Confile.MinerData.ServiceIpAddr,
+		configs.Confile.MinerData.ServicePort,
+		configs.Confile.MinerData.FilePort,
+	)
+	if err != nil || !ok {
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m Failed to update the service ip on the chain from %v to %v: %v\n", 43, onchain, configs.Confile.MinerData.ServiceIpAddr, err)
+		logger.ErrLogger.Sugar().Errorf("[%v] %v", configs.ChainTx_Sminer_UpdateAddress, err)
+		return
+	}
+	fmt.Printf("\x1b[%dm[ok]\x1b[0m Service address updated on the chain: %v -> %v\n", 42, onchain, configs.Confile.MinerData.ServiceIpAddr)
+	logger.InfoLogger.Sugar().Infof("[C%v] service address updated %v -> %v:%v,%v", mdata.Peerid, onchain, configs.Confile.MinerData.ServiceIpAddr, configs.Confile.MinerData.ServicePort, configs.Confile.MinerData.FilePort)
+}
@@ -0,0 +1,226 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"sync"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Funds of the identity account compared with the cost of a transaction
+type Funds struct {
+	Call string
+	// balance that can pay fees and be reserved
+	Usable *big.Int
+	// estimated fee of the transaction
+	Fee *big.Int
+	// tokens the transaction reserves or transfers
+	Spend *big.Int
+}
+
+// What the transaction costs in total
+func (f Funds) Need() *big.Int {
+	return new(big.Int).Add(f.Fee, f.Spend)
+}
+
+// Missing to pay for the transaction, 0 if there is enough
+func (f Funds) Shortfall() *big.Int {
+	v := new(big.Int).Sub(f.Need(), f.Usable)
+	if v.Sign() < 0 {
+		v.SetInt64(0)
+	}
+	return v
+}
+
+// The account cannot pay for the transaction, it is not submitted
+type InsufficientFundsError struct {
+	Funds
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("[%v] insufficient balance: need %v TCESS (fee %v), usable %v TCESS, short of %v TCESS",
+		e.Call, PlanckToTokens(e.Need()), PlanckToTokens(e.Fee), PlanckToTokens(e.Usable), PlanckToTokens(e.Shortfall()))
+}
+
+// Whether err reports insufficient funds
+func IsInsufficientFunds(err error) bool {
+	var e *InsufficientFundsError
+	return errors.As(err, &e)
+}
+
+// Highest fee seen for a transaction of the proof loops
+var (
+	feeLock  sync.Mutex
+	proofFee *big.Int
+)
+
+// Check that the identity account can pay the fee of the call plus the
+// tokens it spends. Returns an InsufficientFundsError with the shortfall
+// if it cannot. The api lock is only held to build the call, the balance
+// and the fee are queried without it.
+func Preflight(identifyAccountPhrase, callName string, spend *big.Int, args ...interface{}) (Funds, error) {
+	signer, err := accountSigner(identifyAccountPhrase)
+	if err != nil {
+		return Funds{Call: callName}, err
+	}
+	api := getSubstrateAPI()
+	ctx, err := getChainContext(api)
+	releaseSubstrateAPI()
+	if err != nil {
+		return Funds{Call: callName}, err
+	}
+	c, err := types.NewCall(ctx.meta, callName, args...)
+	if err != nil {
+		return Funds{Call: callName}, errors.Wrapf(err, "NewCall err [%v]", callName)
+	}
+	return checkFunds(api, ctx, signer.PublicKey(), callName, c, spend)
+}
+
+func checkFunds(api *gsrpc.SubstrateAPI, ctx *chainContext, pub []byte, callName string, c types.Call, spend *big.Int) (Funds, error) {
+	f := Funds{Call: callName, Spend: new(big.Int)}
+	if spend != nil {
+		f.Spend.Set(spend)
+	}
+	var err error
+	f.Usable, err = usableBalance(api, ctx.meta, pub)
+	if err != nil {
+		return f, err
+	}
+	f.Fee, err = estimateFee(api, pub, c)
+	if err != nil {
+		return f, err
+	}
+	if isProofCall(callName) {
+		feeLock.Lock()
+		if proofFee == nil || f.Fee.Cmp(proofFee) > 0 {
+			proofFee = new(big.Int).Set(f.Fee)
+		}
+		feeLock.Unlock()
+	}
+	if f.Shortfall().Sign() > 0 {
+		return f, &InsufficientFundsError{Funds: f}
+	}
+	return f, nil
+}
+
+// Free balance less the frozen part
+func usableBalance(api *gsrpc.SubstrateAPI, meta *types.Metadata, pub []byte) (*big.Int, error) {
+	var accountInfo types.AccountInfo
+	key, err := types.CreateStorageKey(meta, "System", "Account", pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "CreateStorageKey System Account err")
+	}
+	ok, err := api.RPC.State.GetStorageLatest(key, &accountInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetStorageLatest err")
+	}
+	if !ok {
+		// the account does not exist yet
+		return new(big.Int), nil
+	}
+	frozen := u128Int(accountInfo.Data.MiscFrozen)
+	if ff := u128Int(accountInfo.Data.FreeFrozen); ff.Cmp(frozen) > 0 {
+		frozen = ff
+	}
+	v := new(big.Int).Sub(u128Int(accountInfo.Data.Free), frozen)
+	if v.Sign() < 0 {
+		v.SetInt64(0)
+	}
+	return v, nil
+}
+
+// Ask the node for the fee of the call with payment_queryInfo. The
+// signature is not checked there, so a blank one of the right size
+// avoids a round trip to a remote signer.
+func estimateFee(api *gsrpc.SubstrateAPI, pub []byte, c types.Call) (*big.Int, error) {
+	ext := types.NewExtrinsic(c)
+	ext.Signature = types.ExtrinsicSignatureV4{
+		Signer:    types.NewMultiAddressFromAccountID(pub),
+		Signature: types.MultiSignature{IsSr25519: true},
+		Era:       types.ExtrinsicEra{IsImmortalEra: true},
+		Nonce:     types.NewUCompactFromUInt(0),
+		Tip:       types.NewUCompactFromUInt(0),
+	}
+	ext.Version |= types.ExtrinsicBitSigned
+	enc, err := types.EncodeToHexString(ext)
+	if err != nil {
+		return nil, errors.Wrap(err, "EncodeToHexString err")
+	}
+	return queryFee(api, enc)
+}
+
+// Fee of the encoded extrinsic from payment_queryInfo
+func queryFee(api *gsrpc.SubstrateAPI, enc string) (*big.Int, error) {
+	var info struct {
+		PartialFee json.RawMessage `json:"partialFee"`
+	}
+	err := api.Client.Call(&info, "payment_queryInfo", enc)
+	if err != nil {
+		return nil, errors.Wrap(err, "payment_queryInfo err")
+	}
+	// a number, or a string for values beyond the json range
+	var s string
+	if json.Unmarshal(info.PartialFee, &s) != nil {
+		s = string(info.PartialFee)
+	}
+	fee, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return nil, errors.Errorf("invalid partialFee %v", string(info.PartialFee))
+	}
+	return fee, nil
+}
+
+func isProofCall(callName string) bool {
+	switch callName {
+	case configs.ChainTx_SegmentBook_IntentSubmit,
+		configs.ChainTx_SegmentBook_IntentSubmitPost,
+		configs.ChainTx_SegmentBook_SubmitToVpa,
+		configs.ChainTx_SegmentBook_SubmitToVpb,
+		configs.ChainTx_SegmentBook_SubmitToVpc,
+		configs.ChainTx_SegmentBook_SubmitToVpd:
+		return true
+	}
+	return false
+}
+
+// Number of proof transactions the usable balance still pays for, with
+// the highest fee seen so far. ok is false until a fee is known.
+func FeeRunway() (txs uint64, usable *big.Int, ok bool, err error) {
+	feeLock.Lock()
+	fee := proofFee
+	feeLock.Unlock()
+	if fee == nil || fee.Sign() == 0 {
+		return 0, nil, false, nil
+	}
+	api := getSubstrateAPI()
+	defer releaseSubstrateAPI()
+	meta, err := getMetadata(api)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	pub, err := accountPublicKey(keystore.Secret())
+	if err != nil {
+		return 0, nil, false, err
+	}
+	usable, err = usableBalance(api, meta, pub)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	n := new(big.Int).Div(usable, fee)
+	if !n.IsUint64() {
+		return ^uint64(0), usable, true, nil
+	}
+	return n.Uint64(), usable, true, nil
+}
+
+// Log a failed pre-flight check of a transaction that is submitted anyway
+func logPreflight(callName string, err error) {
+	logger.ErrLogger.Sugar().Errorf("[%v] pre-flight check: %v", callName, err)
+}
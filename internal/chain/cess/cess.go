@@ -0,0 +1,11 @@
+// Package cess holds the runtime types, storage accessors, call builders
+// and event structs of the Sminer and SegmentBook pallets, generated from
+// the metadata saved in metadata.hex. The saved metadata holds the items
+// of the two pallets the miner uses, in the layout it decodes them. After
+// a runtime upgrade, save the metadata of a node and generate again:
+//
+//	go run ./cmd/chaingen -rpc wss://node/ws/ -meta internal/chain/cess/metadata.hex
+//	go generate ./internal/chain/cess
+package cess
+
+//go:generate go run storage-mining/cmd/chaingen -meta metadata.hex -out runtime_gen.go -pallets Sminer,SegmentBook
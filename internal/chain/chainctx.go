@@ -0,0 +1,166 @@
+package chain
+
+import (
+	"storage-mining/internal/logger"
+	"sync"
+	"time"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Delay before subscribing to runtime versions again after a failure
+const runtimeWatchRetry = time.Second * 10
+
+// Chain data that only changes with a runtime upgrade
+type chainContext struct {
+	meta        *types.Metadata
+	genesisHash types.Hash
+	rv          types.RuntimeVersion
+}
+
+var (
+	ctxLock  sync.RWMutex
+	chainCtx *chainContext
+)
+
+// Get the cached chain context, loading it from the node on first use
+func getChainContext(api *gsrpc.SubstrateAPI) (*chainContext, error) {
+	ctxLock.RLock()
+	c := chainCtx
+	ctxLock.RUnlock()
+	if c != nil {
+		return c, nil
+	}
+	rv, err := api.RPC.State.GetRuntimeVersionLatest()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetRuntimeVersionLatest err")
+	}
+	return loadChainContext(api, *rv)
+}
+
+// Get the cached metadata
+func getMetadata(api *gsrpc.SubstrateAPI) (*types.Metadata, error) {
+	c, err := getChainContext(api)
+	if err != nil {
+		return nil, err
+	}
+	return c.meta, nil
+}
+
+// Whether the runtime of the node has the call, e.g. "Sminer.update_ip"
+func HasCall(callName string) (bool, error) {
+	api := getSubstrateAPI()
+	meta, err := getMetadata(api)
+	releaseSubstrateAPI()
+	if err != nil {
+		return false, err
+	}
+	_, err = meta.FindCallIndex(callName)
+	return err == nil, nil
+}
+
+// Load the metadata and genesis hash matching the runtime version
+// and replace the cached context
+func loadChainContext(api *gsrpc.SubstrateAPI, rv types.RuntimeVersion) (*chainContext, error) {
+	meta, err := api.RPC.State.GetMetadataLatest()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetMetadataLatest err")
+	}
+	genesisHash, err := api.RPC.Chain.GetBlockHash(0)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBlockHash err")
+	}
+	// nothing is signed for another chain than the network profile
+	err = verifyGenesis(genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	c := &chainContext{meta: meta, genesisHash: genesisHash, rv: rv}
+	ctxLock.Lock()
+	old := chainCtx
+	chainCtx = c
+	ctxLock.Unlock()
+	if old == nil {
+		logger.InfoLogger.Sugar().Infof("runtime %v spec %v tx %v", rv.SpecName, rv.SpecVersion, rv.TransactionVersion)
+	} else if old.rv.SpecVersion != rv.SpecVersion || old.rv.TransactionVersion != rv.TransactionVersion {
+		logger.InfoLogger.Sugar().Infof("runtime upgraded: spec %v -> %v, tx %v -> %v",
+			old.rv.SpecVersion, rv.SpecVersion, old.rv.TransactionVersion, rv.TransactionVersion)
+		reportCompatIssues(CheckMetadata(meta))
+	}
+	return c, nil
+}
+
+// Refresh the cached context if the runtime version differs from it.
+// Returns true if the cache was replaced.
+func checkRuntimeUpgrade(api *gsrpc.SubstrateAPI, rv types.RuntimeVersion) (bool, error) {
+	ctxLock.RLock()
+	c := chainCtx
+	ctxLock.RUnlock()
+	if c != nil && c.rv.SpecVersion == rv.SpecVersion && c.rv.TransactionVersion == rv.TransactionVersion {
+		return false, nil
+	}
+	_, err := loadChainContext(api, rv)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Ask the node for its current runtime version and refresh the cache
+// on a spec version change
+func runtimeUpgraded(api *gsrpc.SubstrateAPI) bool {
+	rv, err := api.RPC.State.GetRuntimeVersionLatest()
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("GetRuntimeVersionLatest err: %v", err)
+		return false
+	}
+	ok, err := checkRuntimeUpgrade(api, *rv)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+	}
+	return ok
+}
+
+// Keep the chain context up to date across runtime upgrades.
+// The subscription is renewed after a reconnect.
+func runtimeVersionWatch() {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	for {
+		err := watchRuntimeVersion()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+		}
+		time.Sleep(runtimeWatchRetry)
+	}
+}
+
+func watchRuntimeVersion() error {
+	api := getSubstrateAPI()
+	sub, err := api.RPC.State.SubscribeRuntimeVersion()
+	releaseSubstrateAPI()
+	if err != nil {
+		// the subscription may be unavailable, at least catch the
+		// upgrades that happened while it was down
+		runtimeUpgraded(api)
+		return errors.Wrap(err, "SubscribeRuntimeVersion err")
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case rv := <-sub.Chan():
+			_, err = checkRuntimeUpgrade(api, rv)
+			if err != nil {
+				logger.ErrLogger.Sugar().Errorf("%v", err)
+			}
+		case err = <-sub.Err():
+			return errors.Wrap(err, "RuntimeVersion subscription err")
+		}
+	}
+}
@@ -1,53 +1,23 @@
 package chain
 
 import (
-	"fmt"
+	"storage-mining/configs"
+	"storage-mining/internal/chain/cess"
 	"storage-mining/internal/logger"
 
-	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
-	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/pkg/errors"
 )
 
-type CessChain_MinerItems struct {
-	Peerid      types.U64       `json:"peerid"`
-	Beneficiary types.AccountID `json:"beneficiary"`
-	Ip          types.U32       `json:"ip"`
-	Collaterals types.U128      `json:"collaterals"`
-	Earnings    types.U128      `json:"earnings"`
-	Locked      types.U128      `json:"locked"`
-}
-
-type ParamInfo struct {
-	Peer_id    types.U64 `json:"peer_id"`
-	Segment_id types.U64 `json:"segment_id"`
-	Rand       types.U32 `json:"rand"`
-}
-
-type IpostParaInfo struct {
-	Peer_id    types.U64   `json:"peer_id"`
-	Segment_id types.U64   `json:"segment_id"`
-	Sealed_cid types.Bytes `json:"sealed_cid"`
-	Size_type  types.U128  `json:"size_type"`
-}
-
-type UnsealedCidInfo struct {
-	Peer_id    types.U64     `json:"peer_id"`
-	Segment_id types.U64     `json:"segment_id"`
-	Uncid      []types.Bytes `json:"uncid"`
-	Rand       types.U32     `json:"rand"`
-	Hash       types.Bytes   `json:"hash"`
-	Shardhash  types.Bytes   `json:"shardhash"`
-}
-
-type FpostParaInfo struct {
-	Peer_id    types.U64     `json:"peer_id"`
-	Segment_id types.U64     `json:"segment_id"`
-	Sealed_cid []types.Bytes `json:"sealed_cid"`
-	Hash       types.Bytes   `json:"hash"`
-	Size_type  types.U128    `json:"size_type"`
-}
+// The storage values of the Sminer and SegmentBook pallets, in the
+// layout generated from the runtime metadata
+type (
+	CessChain_MinerItems = cess.MinerInfo
+	ParamInfo            = cess.ParamInfo
+	IpostParaInfo        = cess.IpostParaInfo
+	UnsealedCidInfo      = cess.UnsealedCidInfo
+	FpostParaInfo        = cess.FpostParaInfo
+)
 
 // Get miner information on the cess chain
 func GetMinerDataOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) (CessChain_MinerItems, error) {
@@ -63,17 +33,17 @@ func GetMinerDataOnChain(identifyAccountPhrase, chainModule, chainModuleMethod s
 			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
 		}
 	}()
-	meta, err := api.RPC.State.GetMetadataLatest()
+	meta, err := getMetadata(api)
 	if err != nil {
-		return mdata, errors.Wrap(err, "GetMetadataLatest err")
+		return mdata, err
 	}
 
-	account, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
+	pub, err := accountPublicKey(identifyAccountPhrase)
 	if err != nil {
-		return mdata, errors.Wrap(err, "KeyringPairFromSecret err")
+		return mdata, err
 	}
 
-	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, account.PublicKey)
+	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, pub)
 	if err != nil {
 		return mdata, errors.Wrap(err, "CreateStorageKey err")
 	}
@@ -100,17 +70,17 @@ func GetSeedNumOnChain(identifyAccountPhrase, chainModule, chainModuleMethod str
 			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
 		}
 	}()
-	meta, err := api.RPC.State.GetMetadataLatest()
+	meta, err := getMetadata(api)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "GetMetadataLatest err")
+		return paramdata, err
 	}
 
-	account, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
+	pub, err := accountPublicKey(identifyAccountPhrase)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "KeyringPairFromSecret err")
+		return paramdata, err
 	}
 
-	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, account.PublicKey)
+	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, pub)
 	if err != nil {
 		return paramdata, errors.Wrap(err, "CreateStorageKey err")
 	}
@@ -139,17 +109,17 @@ func GetVpaPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod str
 			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
 		}
 	}()
-	meta, err := api.RPC.State.GetMetadataLatest()
+	meta, err := getMetadata(api)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "GetMetadataLatest err")
+		return paramdata, err
 	}
 
-	account, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
+	pub, err := accountPublicKey(identifyAccountPhrase)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "KeyringPairFromSecret err")
+		return paramdata, err
 	}
 
-	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, account.PublicKey)
+	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, pub)
 	if err != nil {
 		return paramdata, errors.Wrap(err, "CreateStorageKey err")
 	}
@@ -175,17 +145,17 @@ func GetunsealcidOnChain(identifyAccountPhrase, chainModule, chainModuleMethod s
 			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
 		}
 	}()
-	meta, err := api.RPC.State.GetMetadataLatest()
+	meta, err := getMetadata(api)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "GetMetadataLatest err")
+		return paramdata, err
 	}
 
-	account, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
+	pub, err := accountPublicKey(identifyAccountPhrase)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "KeyringPairFromSecret err")
+		return paramdata, err
 	}
 
-	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, account.PublicKey)
+	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, pub)
 	if err != nil {
 		return paramdata, errors.Wrap(err, "CreateStorageKey err")
 	}
@@ -211,17 +181,17 @@ func GetVpcPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod str
 			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
 		}
 	}()
-	meta, err := api.RPC.State.GetMetadataLatest()
+	meta, err := getMetadata(api)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "GetMetadataLatest err")
+		return paramdata, err
 	}
 
-	account, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
+	pub, err := accountPublicKey(identifyAccountPhrase)
 	if err != nil {
-		return paramdata, errors.Wrap(err, "KeyringPairFromSecret err")
+		return paramdata, err
 	}
 
-	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, account.PublicKey)
+	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, pub)
 	if err != nil {
 		return paramdata, errors.Wrap(err, "CreateStorageKey err")
 	}
@@ -233,33 +203,117 @@ func GetVpcPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod str
 	return paramdata, nil
 }
 
-// Renewal tokens
-func RenewalTokens() error {
-	//TODO:
-	return errors.New("test")
+// Whether a proof of the segment waits for its verification in the
+// pool item of the SegmentBook
+func GetProofSubmittedOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string, segmentid uint64) (bool, error) {
+	api := getSubstrateAPI()
+	defer func() {
+		releaseSubstrateAPI()
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	meta, err := getMetadata(api)
+	if err != nil {
+		return false, err
+	}
+
+	pub, err := accountPublicKey(identifyAccountPhrase)
+	if err != nil {
+		return false, err
+	}
+
+	seg, err := types.EncodeToBytes(types.NewU64(segmentid))
+	if err != nil {
+		return false, errors.Wrap(err, "EncodeToBytes err")
+	}
+
+	key, err := types.CreateStorageKey(meta, chainModule, chainModuleMethod, pub, seg)
+	if err != nil {
+		return false, errors.Wrap(err, "CreateStorageKey err")
+	}
+
+	raw, err := api.RPC.State.GetStorageRawLatest(key)
+	if err != nil {
+		return false, errors.Wrap(err, "GetStorageRawLatest err")
+	}
+	return raw != nil && len(*raw) > 0, nil
 }
 
-//not use
-func GetLatestBlockHeight() {
-	api, err := gsrpc.NewSubstrateAPI("ws://106.15.44.155:9947")
+// Get the block the miner exited at from the Sminer storage, false
+// while it has not exited
+func GetExitBlockOnChain(identifyAccountPhrase string) (uint64, bool, error) {
+	var block types.U32
+	api := getSubstrateAPI()
+	defer func() {
+		releaseSubstrateAPI()
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	meta, err := getMetadata(api)
+	if err != nil {
+		return 0, false, err
+	}
+
+	pub, err := accountPublicKey(identifyAccountPhrase)
+	if err != nil {
+		return 0, false, err
+	}
+
+	key, err := types.CreateStorageKey(meta, configs.ChainModule_Sminer, configs.ChainModule_Sminer_MinerColling, pub)
 	if err != nil {
-		panic(err)
+		return 0, false, errors.Wrap(err, "CreateStorageKey err")
 	}
-	sub, err := api.RPC.Chain.SubscribeNewHeads()
+
+	ok, err := api.RPC.State.GetStorageLatest(key, &block)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "GetStorageLatest err")
+	}
+	return uint64(block), ok, nil
+}
+
+// Get a constant of a pallet, false if the runtime has no such constant
+func GetConstantOnChain(chainModule, constantName string, v interface{}) (bool, error) {
+	api := getSubstrateAPI()
+	defer func() {
+		releaseSubstrateAPI()
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	meta, err := getMetadata(api)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
-	defer sub.Unsubscribe()
 
-	count := 0
+	b, err := meta.FindConstantValue(chainModule, constantName)
+	if err != nil {
+		return false, nil
+	}
+	err = types.DecodeFromBytes(b, v)
+	if err != nil {
+		return false, errors.Wrapf(err, "DecodeFromBytes %v.%v err", chainModule, constantName)
+	}
+	return true, nil
+}
 
-	for {
-		head := <-sub.Chan()
-		fmt.Printf("Chain is at block: #%v\n", head.Number)
-		count++
-		if count == 10 {
-			sub.Unsubscribe()
-			break
+// Get the number of the best block
+func GetBlockHeight() (uint64, error) {
+	api := getSubstrateAPI()
+	defer func() {
+		releaseSubstrateAPI()
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
 		}
+	}()
+	header, err := api.RPC.Chain.GetHeaderLatest()
+	if err != nil {
+		return 0, errors.Wrap(err, "GetHeaderLatest err")
 	}
+	return uint64(header.Number), nil
 }
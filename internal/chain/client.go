@@ -0,0 +1,160 @@
+package chain
+
+import (
+	"math/big"
+	"storage-mining/configs"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+)
+
+// Everything the mining workflow needs from the cess chain:
+// storage reads, transaction submission and proof events.
+// Client talks to the node, FakeChain keeps the state in memory.
+type ChainClient interface {
+	// storage
+	GetMinerDataOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) (CessChain_MinerItems, error)
+	GetSeedNumOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) (ParamInfo, error)
+	GetVpaPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]IpostParaInfo, error)
+	GetunsealcidOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]UnsealedCidInfo, error)
+	GetVpcPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]FpostParaInfo, error)
+	GetExitBlockOnChain(identifyAccountPhrase string) (uint64, bool, error)
+	GetExitLockBlocks() (uint64, bool, error)
+	GetBlockTime() (time.Duration, bool, error)
+	GetBlockHeight() (uint64, error)
+	HasCall(callName string) (bool, error)
+
+	// transactions
+	RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr string, pledgeTokens uint64, port, fileport uint32) (bool, error)
+	IntentSubmitToChain(identifyAccountPhrase, TransactionName string, segsizetype, segtype uint8, peerid uint64, unsealedcid [][]byte, hash, shardhash []byte) (uint64, uint32, error)
+	IntentSubmitPostToChain(identifyAccountPhrase, TransactionName string, segmentid uint64, segsizetype, segtype uint8) (uint32, error)
+	SegmentSubmitToVpaOrVpb(identifyAccountPhrase, TransactionName string, peerid, segmentid uint64, proofs, cid []byte) (bool, error)
+	SegmentSubmitToVpc(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error)
+	SegmentSubmitToVpd(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error)
+	UpdateAddress(identifyAccountPhrase, ipAddr string, port, fileport uint32) (bool, error)
+	RenewalTokens(identifyAccountPhrase string, tokens *big.Int) (bool, error)
+	WithdrawEarnings(identifyAccountPhrase string) (TxReceipt, error)
+	ExitMining(identifyAccountPhrase string) (bool, error)
+	Withdraw(identifyAccountPhrase string) (bool, error)
+	// whether the runtime would accept the withdrawal now, the rejection
+	// is the error; false if the node cannot tell
+	CheckWithdraw(identifyAccountPhrase string) (bool, error)
+
+	// events, the returned function ends the subscription
+	SubscribeMinerEvents(identifyAccountPhrase string, peerid uint64) (<-chan MinerEvent, func(), error)
+	SubscribeHeads() (<-chan ChainHead, func(), error)
+}
+
+// The chain used by the mining workflow, replace it with a FakeChain to
+// run without a node
+var Client ChainClient = nodeClient{}
+
+var _ ChainClient = (*FakeChain)(nil)
+
+// ChainClient backed by the connected node
+type nodeClient struct{}
+
+func (nodeClient) GetMinerDataOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) (CessChain_MinerItems, error) {
+	return GetMinerDataOnChain(identifyAccountPhrase, chainModule, chainModuleMethod)
+}
+
+func (nodeClient) GetSeedNumOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) (ParamInfo, error) {
+	return GetSeedNumOnChain(identifyAccountPhrase, chainModule, chainModuleMethod)
+}
+
+func (nodeClient) GetVpaPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]IpostParaInfo, error) {
+	return GetVpaPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod)
+}
+
+func (nodeClient) GetunsealcidOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]UnsealedCidInfo, error) {
+	return GetunsealcidOnChain(identifyAccountPhrase, chainModule, chainModuleMethod)
+}
+
+func (nodeClient) GetVpcPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]FpostParaInfo, error) {
+	return GetVpcPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod)
+}
+
+func (nodeClient) GetExitBlockOnChain(identifyAccountPhrase string) (uint64, bool, error) {
+	return GetExitBlockOnChain(identifyAccountPhrase)
+}
+
+func (nodeClient) GetExitLockBlocks() (uint64, bool, error) {
+	var blocks types.U32
+	ok, err := GetConstantOnChain(configs.ChainModule_Sminer, configs.ChainConst_Sminer_LockInPeriod, &blocks)
+	return uint64(blocks), ok, err
+}
+
+// The target block time is twice the minimum period of the timestamps
+func (nodeClient) GetBlockTime() (time.Duration, bool, error) {
+	var ms types.U64
+	ok, err := GetConstantOnChain(configs.ChainModule_Timestamp, configs.ChainConst_Timestamp_MinimumPeriod, &ms)
+	return time.Duration(ms) * 2 * time.Millisecond, ok && ms > 0, err
+}
+
+func (nodeClient) GetBlockHeight() (uint64, error) {
+	if h, ok := LatestHead(); ok {
+		return h.Number, nil
+	}
+	return GetBlockHeight()
+}
+
+func (nodeClient) HasCall(callName string) (bool, error) {
+	return HasCall(callName)
+}
+
+func (nodeClient) RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr string, pledgeTokens uint64, port, fileport uint32) (bool, error) {
+	return RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr, pledgeTokens, port, fileport)
+}
+
+func (nodeClient) IntentSubmitToChain(identifyAccountPhrase, TransactionName string, segsizetype, segtype uint8, peerid uint64, unsealedcid [][]byte, hash, shardhash []byte) (uint64, uint32, error) {
+	return IntentSubmitToChain(identifyAccountPhrase, TransactionName, segsizetype, segtype, peerid, unsealedcid, hash, shardhash)
+}
+
+func (nodeClient) IntentSubmitPostToChain(identifyAccountPhrase, TransactionName string, segmentid uint64, segsizetype, segtype uint8) (uint32, error) {
+	return IntentSubmitPostToChain(identifyAccountPhrase, TransactionName, segmentid, segsizetype, segtype)
+}
+
+func (nodeClient) SegmentSubmitToVpaOrVpb(identifyAccountPhrase, TransactionName string, peerid, segmentid uint64, proofs, cid []byte) (bool, error) {
+	return SegmentSubmitToVpaOrVpb(identifyAccountPhrase, TransactionName, peerid, segmentid, proofs, cid)
+}
+
+func (nodeClient) SegmentSubmitToVpc(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
+	return SegmentSubmitToVpc(identifyAccountPhrase, peerid, segmentid, proofs, sealcid)
+}
+
+func (nodeClient) SegmentSubmitToVpd(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
+	return SegmentSubmitToVpd(identifyAccountPhrase, peerid, segmentid, proofs, sealcid)
+}
+
+func (nodeClient) UpdateAddress(identifyAccountPhrase, ipAddr string, port, fileport uint32) (bool, error) {
+	return UpdateAddress(identifyAccountPhrase, ipAddr, port, fileport)
+}
+
+func (nodeClient) RenewalTokens(identifyAccountPhrase string, tokens *big.Int) (bool, error) {
+	return RenewalTokens(identifyAccountPhrase, tokens)
+}
+
+func (nodeClient) WithdrawEarnings(identifyAccountPhrase string) (TxReceipt, error) {
+	return WithdrawEarnings(identifyAccountPhrase)
+}
+
+func (nodeClient) ExitMining(identifyAccountPhrase string) (bool, error) {
+	return ExitMining(identifyAccountPhrase)
+}
+
+func (nodeClient) Withdraw(identifyAccountPhrase string) (bool, error) {
+	return Withdraw(identifyAccountPhrase)
+}
+
+func (nodeClient) CheckWithdraw(identifyAccountPhrase string) (bool, error) {
+	return CheckWithdraw(identifyAccountPhrase)
+}
+
+func (nodeClient) SubscribeMinerEvents(identifyAccountPhrase string, peerid uint64) (<-chan MinerEvent, func(), error) {
+	return SubscribeMinerEvents(identifyAccountPhrase, peerid)
+}
+
+func (nodeClient) SubscribeHeads() (<-chan ChainHead, func(), error) {
+	ch, cancel := SubscribeHeads()
+	return ch, cancel, nil
+}
@@ -0,0 +1,553 @@
+package chain
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"storage-mining/configs"
+	"storage-mining/internal/logger"
+	"strings"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/scale"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// A storage item, call or event of the runtime that is missing or does not
+// match our types. Optional items are not used by the miner itself.
+type CompatIssue struct {
+	Item     string
+	Problem  string
+	Optional bool
+}
+
+func (c CompatIssue) String() string {
+	return fmt.Sprintf("%v: %v", c.Item, c.Problem)
+}
+
+// A storage item with the Go types of its keys and value. A nil value
+// is only checked for existence.
+type runtimeStorage struct {
+	pallet, item string
+	keys         []interface{}
+	value        interface{}
+	optional     bool
+}
+
+// A call with the Go types of the arguments we send, in order
+type runtimeCall struct {
+	name     string
+	args     []interface{}
+	optional bool
+}
+
+// A pallet constant with the Go type we decode it into
+type runtimeConstant struct {
+	pallet, name string
+	value        interface{}
+	optional     bool
+}
+
+// The storage items of configs/sys.go as we read them
+var runtimeStorages = []runtimeStorage{
+	{configs.ChainModule_Sminer, configs.ChainModule_Sminer_MinerItems, []interface{}{types.AccountID{}}, CessChain_MinerItems{}, false},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ConProofInfoA, []interface{}{types.AccountID{}}, []IpostParaInfo{}, false},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ConProofInfoC, []interface{}{types.AccountID{}}, []FpostParaInfo{}, false},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_MinerHoldSlice, []interface{}{types.AccountID{}}, []UnsealedCidInfo{}, false},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ParamSetA, []interface{}{types.AccountID{}}, ParamInfo{}, true},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ParamSetB, []interface{}{types.AccountID{}}, ParamInfo{}, true},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ParamSetD, []interface{}{types.AccountID{}}, ParamInfo{}, true},
+	{configs.ChainModule_Sminer, configs.ChainModule_Sminer_SegInfo, nil, nil, true},
+	// confirms an exit the runtime rejects as done before
+	{configs.ChainModule_Sminer, configs.ChainModule_Sminer_MinerColling, []interface{}{types.AccountID{}}, types.U32(0), true},
+	// a proof that was submitted but not verified yet, only looked up
+	// when a transaction could not be reconciled through its hash
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_VerPoolA, []interface{}{types.AccountID{}, types.U64(0)}, nil, true},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_VerPoolB, []interface{}{types.AccountID{}, types.U64(0)}, nil, true},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_VerPoolC, []interface{}{types.AccountID{}, types.U64(0)}, nil, true},
+	{configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_VerPoolD, []interface{}{types.AccountID{}, types.U64(0)}, nil, true},
+}
+
+// The calls of configs/sys.go with the arguments of transaction.go
+var runtimeCalls = []runtimeCall{
+	{configs.ChainTx_Sminer_Register, []interface{}{types.MultiAddress{}, types.U32(0), types.U32(0), types.U32(0), types.UCompact{}}, false},
+	// the exit, the collateral top-up and the withdrawals are disabled
+	// when the runtime lacks their call, see callAvailable
+	{configs.ChainTx_Sminer_ExitMining, nil, true},
+	{configs.ChainTx_Sminer_IncreaseCollateral, []interface{}{types.UCompact{}}, true},
+	{configs.ChainTx_Sminer_WithdrawEarnings, nil, true},
+	{configs.ChainTx_Sminer_Withdraw, nil, true},
+	// the miner address is then only updated by registering again
+	{configs.ChainTx_Sminer_UpdateAddress, []interface{}{types.U32(0), types.U32(0), types.U32(0)}, true},
+	{configs.ChainTx_SegmentBook_IntentSubmit, []interface{}{types.U8(0), types.U8(0), types.U64(0), []types.Bytes{}, types.Bytes{}, types.Bytes{}}, false},
+	{configs.ChainTx_SegmentBook_IntentSubmitPost, []interface{}{types.U64(0), types.U8(0), types.U8(0)}, false},
+	{configs.ChainTx_SegmentBook_SubmitToVpa, []interface{}{types.U64(0), types.U64(0), types.Bytes{}, types.Bytes{}}, false},
+	{configs.ChainTx_SegmentBook_SubmitToVpb, []interface{}{types.U64(0), types.U64(0), types.Bytes{}, types.Bytes{}}, false},
+	{configs.ChainTx_SegmentBook_SubmitToVpc, []interface{}{types.U64(0), types.U64(0), []types.Bytes{}, []types.Bytes{}}, false},
+	{configs.ChainTx_SegmentBook_SubmitToVpd, []interface{}{types.U64(0), types.U64(0), []types.Bytes{}, []types.Bytes{}}, false},
+	{configs.ChainTx_FileBank_Update, nil, true},
+}
+
+// The constants of configs/sys.go as we read them
+var runtimeConstants = []runtimeConstant{
+	// the collateral is then withdrawn once the runtime accepts it
+	{configs.ChainModule_Sminer, configs.ChainConst_Sminer_LockInPeriod, types.U32(0), true},
+	// turns the proof window into blocks until a timed task is seen
+	{configs.ChainModule_Timestamp, configs.ChainConst_Timestamp_MinimumPeriod, types.U64(0), true},
+}
+
+var (
+	typeAccountID    = reflect.TypeOf(types.AccountID{})
+	typeHash         = reflect.TypeOf(types.Hash{})
+	typeBytes        = reflect.TypeOf(types.Bytes{})
+	typeText         = reflect.TypeOf(types.Text(""))
+	typeUCompact     = reflect.TypeOf(types.UCompact{})
+	typeU128         = reflect.TypeOf(types.U128{})
+	typeU256         = reflect.TypeOf(types.U256{})
+	typeMultiAddress = reflect.TypeOf(types.MultiAddress{})
+	typeDecodeable   = reflect.TypeOf((*scale.Decodeable)(nil)).Elem()
+)
+
+// Check the runtime of the node in use at startup and refuse to mine
+// against one that lacks or changed what the miner depends on
+func checkRuntimeOrExit() {
+	api := getSubstrateAPI()
+	meta, err := getMetadata(api)
+	releaseSubstrateAPI()
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		os.Exit(configs.Exit_Normal)
+	}
+	issues := CheckMetadata(meta)
+	if !reportCompatIssues(issues) {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m The runtime of %v is not compatible with this version of the miner\n", 41, CurrentEndpoint())
+		logger.ErrLogger.Sugar().Errorf("The runtime of %v is not compatible", CurrentEndpoint())
+		os.Exit(configs.Exit_IncompatibleRuntime)
+	}
+}
+
+// Whether the runtime has the call, the feature that needs it is
+// disabled otherwise
+func callAvailable(callName, feature string) bool {
+	ok, err := Client.HasCall(callName)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+	}
+	if !ok {
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m The chain has no %v call, %v is disabled\n", 43, callName, feature)
+		logger.ErrLogger.Sugar().Errorf("%v is not available, %v is disabled", callName, feature)
+	}
+	return ok
+}
+
+// Print the issues, false when one of them is not optional
+func PrintCompatIssues(issues []CompatIssue) bool {
+	ok := true
+	for _, v := range issues {
+		if v.Optional {
+			fmt.Printf("\x1b[%dm[warn]\x1b[0m %v\n", 43, v)
+			continue
+		}
+		ok = false
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, v)
+	}
+	return ok
+}
+
+// Print and log the issues of the runtime in use
+func reportCompatIssues(issues []CompatIssue) bool {
+	for _, v := range issues {
+		if v.Optional {
+			logger.InfoLogger.Sugar().Infof("runtime: %v", v)
+		} else {
+			logger.ErrLogger.Sugar().Errorf("runtime: %v", v)
+		}
+	}
+	return PrintCompatIssues(issues)
+}
+
+// Connect to addr and check its genesis and runtime
+func CheckRuntimeAt(addr string) (types.RuntimeVersion, []CompatIssue, error) {
+	var rv types.RuntimeVersion
+	api, err := gsrpc.NewSubstrateAPI(addr)
+	if err != nil {
+		return rv, nil, errors.Wrap(err, "NewSubstrateAPI err")
+	}
+	defer closeAPI(api)
+	rv1, err := api.RPC.State.GetRuntimeVersionLatest()
+	if err != nil {
+		return rv, nil, errors.Wrap(err, "GetRuntimeVersionLatest err")
+	}
+	genesis, err := api.RPC.Chain.GetBlockHash(0)
+	if err != nil {
+		return *rv1, nil, errors.Wrap(err, "GetBlockHash err")
+	}
+	err = verifyGenesis(genesis)
+	if errors.Cause(err) == ErrUnknownGenesis {
+		// the hash to set once the node is known to serve the right chain
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m %v: genesis %v, set genesisHash to it to mine on this chain\n", 43, addr, genesis.Hex())
+	} else if err != nil {
+		return *rv1, nil, err
+	}
+	meta, err := api.RPC.State.GetMetadataLatest()
+	if err != nil {
+		return *rv1, nil, errors.Wrap(err, "GetMetadataLatest err")
+	}
+	return *rv1, CheckMetadata(meta), nil
+}
+
+// Every storage item, call, constant and event the miner uses that is
+// missing from the metadata or whose SCALE type differs from our Go type.
+// Metadata before V14 has no types and only the names are checked.
+func CheckMetadata(meta *types.Metadata) []CompatIssue {
+	var issues []CompatIssue
+	add := func(item string, optional bool, err error) {
+		if err != nil {
+			issues = append(issues, CompatIssue{Item: item, Problem: err.Error(), Optional: optional})
+		}
+	}
+	v14 := meta.Version == 14
+	if !v14 {
+		issues = append(issues, CompatIssue{Item: "metadata", Problem: fmt.Sprintf("V%v has no type information, only the names are checked", meta.Version), Optional: true})
+	}
+	for _, s := range runtimeStorages {
+		item := fmt.Sprintf("storage %v.%v", s.pallet, s.item)
+		if !v14 {
+			_, err := meta.FindStorageEntryMetadata(s.pallet, s.item)
+			add(item, s.optional, missing(err))
+			continue
+		}
+		add(item, s.optional, checkStorage(&meta.AsMetadataV14, s))
+	}
+	for _, c := range runtimeCalls {
+		item := "call " + c.name
+		if !v14 {
+			_, err := meta.FindCallIndex(c.name)
+			add(item, c.optional, missing(err))
+			continue
+		}
+		add(item, c.optional, checkCall(&meta.AsMetadataV14, c))
+	}
+	for _, c := range runtimeConstants {
+		item := fmt.Sprintf("constant %v.%v", c.pallet, c.name)
+		if !v14 {
+			_, err := meta.FindConstantValue(c.pallet, c.name)
+			add(item, c.optional, missing(err))
+			continue
+		}
+		add(item, c.optional, checkConstant(&meta.AsMetadataV14, c))
+	}
+	if v14 {
+		t := reflect.TypeOf(MyEventRecords{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			k := strings.Index(f.Name, "_")
+			item := fmt.Sprintf("event %v.%v", f.Name[:k], f.Name[k+1:])
+			add(item, false, checkEvent(&meta.AsMetadataV14, f.Name[:k], f.Name[k+1:], f.Type.Elem()))
+		}
+	}
+	return issues
+}
+
+func missing(err error) error {
+	if err != nil {
+		return errors.New("not in the runtime")
+	}
+	return nil
+}
+
+func findPallet(m *types.MetadataV14, name string) *types.PalletMetadataV14 {
+	for i := range m.Pallets {
+		if string(m.Pallets[i].Name) == name {
+			return &m.Pallets[i]
+		}
+	}
+	return nil
+}
+
+func findVariant(m *types.MetadataV14, id int64, name string) *types.Si1Variant {
+	t, ok := m.EfficientLookup[id]
+	if !ok || !t.Def.IsVariant {
+		return nil
+	}
+	for k := range t.Def.Variant.Variants {
+		if string(t.Def.Variant.Variants[k].Name) == name {
+			return &t.Def.Variant.Variants[k]
+		}
+	}
+	return nil
+}
+
+func checkStorage(m *types.MetadataV14, s runtimeStorage) error {
+	p := findPallet(m, s.pallet)
+	if p == nil || !p.HasStorage {
+		return errors.New("not in the runtime")
+	}
+	var entry *types.StorageEntryMetadataV14
+	for k := range p.Storage.Items {
+		if string(p.Storage.Items[k].Name) == s.item {
+			entry = &p.Storage.Items[k]
+		}
+	}
+	if entry == nil {
+		return errors.New("not in the runtime")
+	}
+	if s.value == nil {
+		return nil
+	}
+	if entry.Type.IsPlainType {
+		if len(s.keys) > 0 {
+			return errors.Errorf("plain value, we read a map with %v keys", len(s.keys))
+		}
+		return matchType(m, entry.Type.AsPlainType.Int64(), reflect.TypeOf(s.value), 0)
+	}
+	hashers := entry.Type.AsMap.Hashers
+	if len(hashers) != len(s.keys) {
+		return errors.Errorf("map with %v keys, we read %v", len(hashers), len(s.keys))
+	}
+	keyIDs := []int64{entry.Type.AsMap.Key.Int64()}
+	if len(hashers) > 1 {
+		t, ok := m.EfficientLookup[keyIDs[0]]
+		if !ok || !t.Def.IsTuple || len(t.Def.Tuple) != len(hashers) {
+			return errors.New("keys do not match the hashers")
+		}
+		keyIDs = keyIDs[:0]
+		for _, v := range t.Def.Tuple {
+			keyIDs = append(keyIDs, v.Int64())
+		}
+	}
+	for k, id := range keyIDs {
+		err := matchType(m, id, reflect.TypeOf(s.keys[k]), 0)
+		if err != nil {
+			return errors.Wrapf(err, "key %v", k)
+		}
+	}
+	return matchType(m, entry.Type.AsMap.Value.Int64(), reflect.TypeOf(s.value), 0)
+}
+
+func checkCall(m *types.MetadataV14, c runtimeCall) error {
+	name := strings.SplitN(c.name, ".", 2)
+	p := findPallet(m, name[0])
+	if p == nil || !p.HasCalls || len(name) < 2 {
+		return errors.New("not in the runtime")
+	}
+	v := findVariant(m, p.Calls.Type.Int64(), name[1])
+	if v == nil {
+		return errors.New("not in the runtime")
+	}
+	if c.optional && c.args == nil {
+		return nil
+	}
+	if len(v.Fields) != len(c.args) {
+		return errors.Errorf("takes %v arguments, we send %v", len(v.Fields), len(c.args))
+	}
+	for k, f := range v.Fields {
+		err := matchType(m, f.Type.Int64(), reflect.TypeOf(c.args[k]), 0)
+		if err != nil {
+			return errors.Wrapf(err, "argument %v %v", k, f.Name)
+		}
+	}
+	return nil
+}
+
+func checkConstant(m *types.MetadataV14, c runtimeConstant) error {
+	p := findPallet(m, c.pallet)
+	if p == nil {
+		return errors.New("not in the runtime")
+	}
+	for k := range p.Constants {
+		if string(p.Constants[k].Name) == c.name {
+			return matchType(m, p.Constants[k].Type.Int64(), reflect.TypeOf(c.value), 0)
+		}
+	}
+	return errors.New("not in the runtime")
+}
+
+// The fields of an event struct between Phase and Topics
+func checkEvent(m *types.MetadataV14, pallet, event string, t reflect.Type) error {
+	p := findPallet(m, pallet)
+	if p == nil || !p.HasEvents {
+		return errors.New("not in the runtime")
+	}
+	v := findVariant(m, p.Events.Type.Int64(), event)
+	if v == nil {
+		return errors.New("not in the runtime")
+	}
+	if len(v.Fields) != t.NumField()-2 {
+		return errors.Errorf("has %v fields, %v has %v", len(v.Fields), t.Name(), t.NumField()-2)
+	}
+	for k, f := range v.Fields {
+		err := matchType(m, f.Type.Int64(), t.Field(k+1).Type, 0)
+		if err != nil {
+			return errors.Wrapf(err, "field %v", t.Field(k+1).Name)
+		}
+	}
+	return nil
+}
+
+// Whether values of the runtime type id decode into the Go type t
+func matchType(m *types.MetadataV14, id int64, t reflect.Type, depth int) error {
+	if depth > maxTypeDepth {
+		return errors.New("types nested too deep")
+	}
+	rt, ok := m.EfficientLookup[id]
+	if !ok {
+		return errors.Errorf("unknown type %v", id)
+	}
+	def := rt.Def
+	// a new type is the type it wraps, unless ours is a struct of one field too
+	if def.IsComposite && len(def.Composite.Fields) == 1 && !(t.Kind() == reflect.Struct && t.NumField() == 1 && !gsrpcType(t)) {
+		return matchType(m, def.Composite.Fields[0].Type.Int64(), t, depth+1)
+	}
+	mismatch := errors.Errorf("expected %v, runtime has %v", t, describeType(m, id, 0))
+	switch t {
+	case typeAccountID, typeHash:
+		if def.IsArray && def.Array.Len == 32 && isPrimitive(m, def.Array.Type.Int64(), types.IsU8) {
+			return nil
+		}
+		return mismatch
+	case typeBytes, typeText:
+		if def.IsSequence && isPrimitive(m, def.Sequence.Type.Int64(), types.IsU8) ||
+			def.IsPrimitive && def.Primitive.Si0TypeDefPrimitive == types.IsStr {
+			return nil
+		}
+		return mismatch
+	case typeUCompact:
+		if def.IsCompact {
+			return nil
+		}
+		return mismatch
+	case typeU128:
+		return primitiveMatch(def, types.IsU128, mismatch)
+	case typeU256:
+		return primitiveMatch(def, types.IsU256, mismatch)
+	case typeMultiAddress:
+		if def.IsVariant && len(rt.Path) > 0 && rt.Path[len(rt.Path)-1] == "MultiAddress" {
+			return nil
+		}
+		return mismatch
+	}
+	// our own enum decoding, only the kind can be checked
+	if reflect.PtrTo(t).Implements(typeDecodeable) {
+		if def.IsVariant {
+			return nil
+		}
+		return mismatch
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return primitiveMatch(def, types.IsBool, mismatch)
+	case reflect.Uint8:
+		return primitiveMatch(def, types.IsU8, mismatch)
+	case reflect.Uint16:
+		return primitiveMatch(def, types.IsU16, mismatch)
+	case reflect.Uint32:
+		if def.IsPrimitive && def.Primitive.Si0TypeDefPrimitive == types.IsChar {
+			return nil
+		}
+		return primitiveMatch(def, types.IsU32, mismatch)
+	case reflect.Uint64:
+		return primitiveMatch(def, types.IsU64, mismatch)
+	case reflect.Int8:
+		return primitiveMatch(def, types.IsI8, mismatch)
+	case reflect.Int16:
+		return primitiveMatch(def, types.IsI16, mismatch)
+	case reflect.Int32:
+		return primitiveMatch(def, types.IsI32, mismatch)
+	case reflect.Int64:
+		return primitiveMatch(def, types.IsI64, mismatch)
+	case reflect.Slice:
+		if !def.IsSequence {
+			return mismatch
+		}
+		return matchType(m, def.Sequence.Type.Int64(), t.Elem(), depth+1)
+	case reflect.Array:
+		if !def.IsArray || int(def.Array.Len) != t.Len() {
+			return mismatch
+		}
+		return matchType(m, def.Array.Type.Int64(), t.Elem(), depth+1)
+	case reflect.Struct:
+		var ids []int64
+		switch {
+		case def.IsComposite:
+			for _, f := range def.Composite.Fields {
+				ids = append(ids, f.Type.Int64())
+			}
+		case def.IsTuple:
+			for _, v := range def.Tuple {
+				ids = append(ids, v.Int64())
+			}
+		default:
+			return mismatch
+		}
+		if len(ids) != t.NumField() {
+			return errors.Errorf("%v has %v fields, runtime %v has %v", t, t.NumField(), describeType(m, id, 0), len(ids))
+		}
+		for k, v := range ids {
+			err := matchType(m, v, t.Field(k).Type, depth+1)
+			if err != nil {
+				return errors.Wrapf(err, "field %v", t.Field(k).Name)
+			}
+		}
+		return nil
+	}
+	return mismatch
+}
+
+// gsrpc types that are structs but decode as a whole
+func gsrpcType(t reflect.Type) bool {
+	switch t {
+	case typeUCompact, typeU128, typeU256:
+		return true
+	}
+	return reflect.PtrTo(t).Implements(typeDecodeable)
+}
+
+func isPrimitive(m *types.MetadataV14, id int64, p types.Si0TypeDefPrimitive) bool {
+	t, ok := m.EfficientLookup[id]
+	return ok && t.Def.IsPrimitive && t.Def.Primitive.Si0TypeDefPrimitive == p
+}
+
+func primitiveMatch(def types.Si1TypeDef, p types.Si0TypeDefPrimitive, mismatch error) error {
+	if def.IsPrimitive && def.Primitive.Si0TypeDefPrimitive == p {
+		return nil
+	}
+	return mismatch
+}
+
+var primitiveNames = map[types.Si0TypeDefPrimitive]string{
+	types.IsBool: "bool", types.IsChar: "char", types.IsStr: "str",
+	types.IsU8: "u8", types.IsU16: "u16", types.IsU32: "u32", types.IsU64: "u64", types.IsU128: "u128", types.IsU256: "u256",
+	types.IsI8: "i8", types.IsI16: "i16", types.IsI32: "i32", types.IsI64: "i64", types.IsI128: "i128", types.IsI256: "i256",
+}
+
+// The runtime type in Rust notation, e.g. Vec<u8>
+func describeType(m *types.MetadataV14, id int64, depth int) string {
+	t, ok := m.EfficientLookup[id]
+	if !ok || depth > 4 {
+		return "?"
+	}
+	def := t.Def
+	switch {
+	case def.IsPrimitive:
+		return primitiveNames[def.Primitive.Si0TypeDefPrimitive]
+	case def.IsCompact:
+		return fmt.Sprintf("Compact<%v>", describeType(m, def.Compact.Type.Int64(), depth+1))
+	case def.IsSequence:
+		return fmt.Sprintf("Vec<%v>", describeType(m, def.Sequence.Type.Int64(), depth+1))
+	case def.IsArray:
+		return fmt.Sprintf("[%v; %v]", describeType(m, def.Array.Type.Int64(), depth+1), def.Array.Len)
+	case def.IsTuple:
+		var s []string
+		for _, v := range def.Tuple {
+			s = append(s, describeType(m, v.Int64(), depth+1))
+		}
+		return "(" + strings.Join(s, ", ") + ")"
+	}
+	if len(t.Path) > 0 {
+		return string(t.Path[len(t.Path)-1])
+	}
+	return fmt.Sprintf("type %v", id)
+}
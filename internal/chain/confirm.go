@@ -0,0 +1,114 @@
+package chain
+
+import (
+	"strconv"
+	"strings"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Confirmation policy values in the configuration file
+const (
+	Confirm_InBlock   = "inblock"
+	Confirm_Finalized = "finalized"
+)
+
+// The block containing the extrinsic was retracted and the extrinsic
+// did not make it into the canonical chain before the deadline.
+var ErrTxRetracted = errors.New("extrinsic retracted by a reorg")
+
+// When a transaction is considered done
+type confirmPolicy struct {
+	// wait for the inclusion block to be finalized
+	finalized bool
+	// number of blocks on top of the inclusion block, 0 means in-block
+	blocks uint32
+}
+
+// Policy used by submitExtrinsic, set by Chain_Init
+var txPolicy confirmPolicy
+
+// Parse the cessChain.confirmation option:
+// "inblock" (default), "finalized" or a number of confirmations.
+func parseConfirmPolicy(s string) (confirmPolicy, error) {
+	var p confirmPolicy
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", Confirm_InBlock:
+		return p, nil
+	case Confirm_Finalized:
+		p.finalized = true
+		return p, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return p, errors.Errorf("invalid confirmation policy '%v', use '%v', '%v' or a number of blocks", s, Confirm_InBlock, Confirm_Finalized)
+	}
+	p.blocks = uint32(n)
+	return p, nil
+}
+
+func (p confirmPolicy) inBlock() bool {
+	return !p.finalized && p.blocks == 0
+}
+
+func (p confirmPolicy) String() string {
+	if p.finalized {
+		return Confirm_Finalized
+	}
+	if p.blocks == 0 {
+		return Confirm_InBlock
+	}
+	return strconv.FormatUint(uint64(p.blocks), 10) + " confirmations"
+}
+
+// Tracks the inclusion block of one extrinsic across reorgs
+type inclusion struct {
+	included  bool
+	retracted bool
+	hash      types.Hash
+	number    uint64
+}
+
+func (in *inclusion) setInBlock(api *gsrpc.SubstrateAPI, blockHash types.Hash) error {
+	header, err := api.RPC.Chain.GetHeader(blockHash)
+	if err != nil {
+		return errors.Wrap(err, "GetHeader err")
+	}
+	in.included = true
+	in.hash = blockHash
+	in.number = uint64(header.Number)
+	return nil
+}
+
+func (in *inclusion) setRetracted() {
+	in.included = false
+	in.retracted = true
+}
+
+// Whether the inclusion block has enough blocks on top of it and is still
+// part of the canonical chain. A block that is no longer canonical is
+// treated as retracted.
+func (in *inclusion) confirmed(api *gsrpc.SubstrateAPI, blocks uint32) (bool, error) {
+	if !in.included {
+		return false, nil
+	}
+	header, err := api.RPC.Chain.GetHeaderLatest()
+	if err != nil {
+		return false, errors.Wrap(err, "GetHeaderLatest err")
+	}
+	if uint64(header.Number) < in.number+uint64(blocks) {
+		return false, nil
+	}
+	canonical, err := api.RPC.Chain.GetBlockHash(in.number)
+	if err != nil {
+		return false, errors.Wrap(err, "GetBlockHash err")
+	}
+	if canonical != in.hash {
+		in.setRetracted()
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,155 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+)
+
+func TestParseConfirmPolicy(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want confirmPolicy
+		str  string
+	}{
+		{"", confirmPolicy{}, Confirm_InBlock},
+		{" InBlock ", confirmPolicy{}, Confirm_InBlock},
+		{"finalized", confirmPolicy{finalized: true}, Confirm_Finalized},
+		{"3", confirmPolicy{blocks: 3}, "3 confirmations"},
+		{"0", confirmPolicy{}, Confirm_InBlock},
+	} {
+		p, err := parseConfirmPolicy(c.in)
+		if err != nil || p != c.want || p.String() != c.str {
+			t.Errorf("parseConfirmPolicy(%q) = %v %v, want %v", c.in, p, err, c.str)
+		}
+	}
+	for _, in := range []string{"final", "-1", "4294967296"} {
+		_, err := parseConfirmPolicy(in)
+		if err == nil {
+			t.Errorf("parseConfirmPolicy(%q) accepted", in)
+		}
+	}
+}
+
+// Watch ext under the policy, the statuses are fed by the test
+func watchUnder(t *testing.T, policy confirmPolicy, n *fakeNode, ext types.Extrinsic) (chan<- types.ExtrinsicStatus, <-chan TxReceipt, <-chan error) {
+	api, meta := n.api, n.metadata
+	savedPolicy, savedInterval := txPolicy, confirmInterval
+	txPolicy, confirmInterval = policy, time.Millisecond*5
+	t.Cleanup(func() { txPolicy, confirmInterval = savedPolicy, savedInterval })
+
+	statuses := make(chan types.ExtrinsicStatus, 4)
+	receipts := make(chan TxReceipt, 1)
+	done := make(chan error, 1)
+	go func() {
+		var receipt TxReceipt
+		receipt.ExtrinsicHash, _ = extrinsicHash(ext)
+		err := watchExtrinsic(api, meta, statuses, nil, nil, &receipt, "Sminer.regnstk", nil)
+		receipts <- receipt
+		done <- err
+	}()
+	return statuses, receipts, done
+}
+
+// The block the watch confirmed, or fails if it is still waiting
+func confirmedIn(t *testing.T, receipts <-chan TxReceipt, done <-chan error) types.Hash {
+	select {
+	case r := <-receipts:
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		return r.BlockHash
+	case <-time.After(time.Second):
+		t.Fatal("not confirmed")
+	}
+	return types.Hash{}
+}
+
+func stillWaiting(t *testing.T, receipts <-chan TxReceipt) {
+	select {
+	case r := <-receipts:
+		t.Fatalf("confirmed in %v too early", r.BlockHash.Hex())
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestConfirmInBlock(t *testing.T) {
+	n, _, _ := startNode(t)
+	ext := testExtrinsic(t, 1)
+	statuses, receipts, done := watchUnder(t, confirmPolicy{}, n, ext)
+	block := n.produce(ext)
+	statuses <- types.ExtrinsicStatus{IsInBlock: true, AsInBlock: block}
+	if got := confirmedIn(t, receipts, done); got != block {
+		t.Fatalf("confirmed in %v, want %v", got.Hex(), block.Hex())
+	}
+}
+
+func TestConfirmFinalized(t *testing.T) {
+	n, _, _ := startNode(t)
+	ext := testExtrinsic(t, 1)
+	statuses, receipts, done := watchUnder(t, confirmPolicy{finalized: true}, n, ext)
+	block := n.produce(ext)
+	statuses <- types.ExtrinsicStatus{IsInBlock: true, AsInBlock: block}
+	n.advance(5)
+	stillWaiting(t, receipts)
+	statuses <- types.ExtrinsicStatus{IsFinalized: true, AsFinalized: block}
+	if got := confirmedIn(t, receipts, done); got != block {
+		t.Fatalf("confirmed in %v, want %v", got.Hex(), block.Hex())
+	}
+}
+
+func TestConfirmBlocks(t *testing.T) {
+	n, _, _ := startNode(t)
+	ext := testExtrinsic(t, 1)
+	statuses, receipts, done := watchUnder(t, confirmPolicy{blocks: 3}, n, ext)
+	block := n.produce(ext)
+	statuses <- types.ExtrinsicStatus{IsInBlock: true, AsInBlock: block}
+	n.advance(2)
+	stillWaiting(t, receipts)
+	n.advance(1)
+	if got := confirmedIn(t, receipts, done); got != block {
+		t.Fatalf("confirmed in %v, want %v", got.Hex(), block.Hex())
+	}
+}
+
+// The inclusion block is replaced by a reorg before it has its
+// confirmations, the extrinsic is only confirmed in its new block
+func TestConfirmRetractedBeforeBlocks(t *testing.T) {
+	n, _, _ := startNode(t)
+	n.advance(2)
+	ext := testExtrinsic(t, 1)
+	statuses, receipts, done := watchUnder(t, confirmPolicy{blocks: 3}, n, ext)
+	first := n.produce(ext)
+	statuses <- types.ExtrinsicStatus{IsInBlock: true, AsInBlock: first}
+	n.advance(1)
+	n.reorg(3)
+	n.advance(3)
+	stillWaiting(t, receipts)
+
+	statuses <- types.ExtrinsicStatus{IsRetracted: true, AsRetracted: first}
+	second := n.produce(ext)
+	statuses <- types.ExtrinsicStatus{IsInBlock: true, AsInBlock: second}
+	n.advance(2)
+	stillWaiting(t, receipts)
+	n.advance(1)
+	if got := confirmedIn(t, receipts, done); got != second {
+		t.Fatalf("confirmed in %v, want the new block %v", got.Hex(), second.Hex())
+	}
+}
+
+func TestInclusionNotCanonical(t *testing.T) {
+	n, _, _ := startNode(t)
+	block := n.produce(testExtrinsic(t, 1))
+	var in inclusion
+	err := in.setInBlock(n.api, block)
+	if err != nil || in.number != 1 {
+		t.Fatalf("included at %v: %v", in.number, err)
+	}
+	n.reorg(1)
+	n.advance(3)
+	ok, err := in.confirmed(n.api, 3)
+	if err != nil || ok || !in.retracted || in.included {
+		t.Fatalf("confirmed %v %v, retracted %v, included %v", ok, err, in.retracted, in.included)
+	}
+}
@@ -0,0 +1,348 @@
+package chain
+
+import (
+	"fmt"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/scale"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// sp_runtime::DispatchError variants
+const (
+	DispatchError_Other             = 0
+	DispatchError_CannotLookup      = 1
+	DispatchError_BadOrigin         = 2
+	DispatchError_Module            = 3
+	DispatchError_ConsumerRemaining = 4
+	DispatchError_NoProviders       = 5
+	DispatchError_Token             = 6
+	DispatchError_Arithmetic        = 7
+	DispatchError_Transactional     = 8
+	DispatchError_Exhausted         = 9
+	DispatchError_Corruption        = 10
+	DispatchError_Unavailable       = 11
+)
+
+var dispatchErrorNames = []string{"Other", "CannotLookup", "BadOrigin", "Module", "ConsumerRemaining", "NoProviders", "Token", "Arithmetic", "Transactional", "Exhausted", "Corruption", "Unavailable"}
+
+var tokenErrorNames = []string{"NoFunds", "WouldDie", "BelowMinimum", "CannotCreate", "UnknownAsset", "Frozen", "Unsupported"}
+
+var arithmeticErrorNames = []string{"Underflow", "Overflow", "DivisionByZero"}
+
+var transactionalErrorNames = []string{"LimitReached", "NoLayer"}
+
+// Module errors that depend on the state of the chain rather than on the
+// call, so the same call may pass a few blocks later. Any other module
+// error rejects the call itself and is permanent.
+var transientModuleErrors = map[string]map[string]bool{
+	"Balances": {
+		"InsufficientBalance":   true,
+		"LiquidityRestrictions": true,
+		"VestingBalance":        true,
+		"KeepAlive":             true,
+	},
+	"Sminer": {
+		"LockInNotOver": true,
+		"NoReward":      true,
+	},
+	"SegmentBook": {
+		"NoIntentSubmitYet": true,
+	},
+}
+
+// DispatchError as emitted in System.ExtrinsicFailed.
+// types.DispatchError only understands Module errors, this one decodes
+// every variant so the bytes of the following fields stay aligned. With
+// V14 metadata it is filled from the runtime type, which also covers the
+// [u8; 4] error of newer runtimes; the fixed decoder reads the u8 of the
+// older ones.
+type DispatchError struct {
+	Variant uint8
+	// pallet index of a Module error
+	Module uint8
+	// error index of a Module error, or the inner error of Token,
+	// Arithmetic and Transactional
+	Error uint8
+}
+
+func (d *DispatchError) Decode(decoder scale.Decoder) error {
+	b, err := decoder.ReadOneByte()
+	if err != nil {
+		return err
+	}
+	d.Variant = b
+	switch b {
+	case DispatchError_Module:
+		err = decoder.Decode(&d.Module)
+		if err != nil {
+			return err
+		}
+		return decoder.Decode(&d.Error)
+	case DispatchError_Token, DispatchError_Arithmetic, DispatchError_Transactional:
+		return decoder.Decode(&d.Error)
+	}
+	return nil
+}
+
+func (d DispatchError) Encode(encoder scale.Encoder) error {
+	err := encoder.PushByte(d.Variant)
+	if err != nil {
+		return err
+	}
+	switch d.Variant {
+	case DispatchError_Module:
+		err = encoder.PushByte(d.Module)
+		if err != nil {
+			return err
+		}
+		return encoder.PushByte(d.Error)
+	case DispatchError_Token, DispatchError_Arithmetic, DispatchError_Transactional:
+		return encoder.PushByte(d.Error)
+	}
+	return nil
+}
+
+// Fill the dispatch error from its value decoded with the runtime type:
+// a variant name, or a variant with its fields
+func (d *DispatchError) setRuntimeValue(v interface{}) error {
+	name, fields := variantOf(v)
+	variant, ok := indexOf(dispatchErrorNames, name)
+	if !ok {
+		return errors.Errorf("unknown DispatchError %v", name)
+	}
+	*d = DispatchError{Variant: variant}
+	var err error
+	switch variant {
+	case DispatchError_Module:
+		// Module(ModuleError) or, in older runtimes, Module { index, error }
+		if len(fields) == 1 {
+			if inner, ok := fields[0].Value.([]EventField); ok {
+				fields = inner
+			}
+		}
+		if len(fields) != 2 {
+			return errors.Errorf("ModuleError of %v fields", len(fields))
+		}
+		d.Module, err = firstByte(fields[0].Value)
+		if err != nil {
+			return errors.Wrap(err, "ModuleError index")
+		}
+		d.Error, err = firstByte(fields[1].Value)
+		return errors.Wrap(err, "ModuleError error")
+	case DispatchError_Token:
+		d.Error, err = innerIndex(fields, tokenErrorNames)
+	case DispatchError_Arithmetic:
+		d.Error, err = innerIndex(fields, arithmeticErrorNames)
+	case DispatchError_Transactional:
+		d.Error, err = innerIndex(fields, transactionalErrorNames)
+	}
+	return err
+}
+
+// Read a DispatchError, with its runtime type when the metadata has one
+func readDispatchError(d *scale.Decoder, meta *types.Metadata) (DispatchError, error) {
+	var de DispatchError
+	if meta != nil && meta.Version == 14 {
+		m := &meta.AsMetadataV14
+		if id, ok := typeByPath(m, "sp_runtime", "DispatchError"); ok {
+			v, err := decodeValue(d, m, id, 0)
+			if err != nil {
+				return de, err
+			}
+			err = de.setRuntimeValue(v)
+			return de, err
+		}
+	}
+	err := d.Decode(&de)
+	return de, err
+}
+
+// Find the id of a type of the registry by its path
+func typeByPath(m *types.MetadataV14, path ...string) (int64, bool) {
+	for _, t := range m.Lookup.Types {
+		if len(t.Type.Path) != len(path) {
+			continue
+		}
+		match := true
+		for i := range path {
+			if string(t.Type.Path[i]) != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return t.ID.Int64(), true
+		}
+	}
+	return 0, false
+}
+
+// Split a decoded enum value into its variant name and fields
+func variantOf(v interface{}) (string, []EventField) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case EventField:
+		fields, _ := x.Value.([]EventField)
+		return x.Name, fields
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// The index of the inner enum of a variant such as Token(TokenError)
+func innerIndex(fields []EventField, names []string) (uint8, error) {
+	if len(fields) != 1 {
+		return 0, errors.Errorf("%v inner fields", len(fields))
+	}
+	name, _ := variantOf(fields[0].Value)
+	i, ok := indexOf(names, name)
+	if !ok {
+		return 0, errors.Errorf("unknown inner error %v", name)
+	}
+	return i, nil
+}
+
+// The first byte of an integer or a byte array value
+func firstByte(v interface{}) (uint8, error) {
+	switch x := v.(type) {
+	case uint64:
+		return uint8(x), nil
+	case []byte:
+		if len(x) > 0 {
+			return x[0], nil
+		}
+	}
+	return 0, errors.Errorf("unexpected value %v", v)
+}
+
+func indexOf(names []string, name string) (uint8, bool) {
+	for i := range names {
+		if names[i] == name {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+type Event_System_ExtrinsicFailed struct {
+	Phase         types.Phase
+	DispatchError DispatchError
+	DispatchInfo  types.DispatchInfo
+	Topics        []types.Hash
+}
+
+// An extrinsic that was included but rejected by the runtime,
+// e.g. Sminer.AlreadyRegistered
+type RuntimeError struct {
+	Pallet string
+	Name   string
+	Docs   string
+	// the rejection depends on the call itself, sending it again will not help
+	Permanent bool
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Pallet == "" {
+		return e.Name
+	}
+	return e.Pallet + "." + e.Name
+}
+
+// Get the runtime error in err, if any
+func RuntimeErrorOf(err error) (*RuntimeError, bool) {
+	var rtErr *RuntimeError
+	ok := errors.As(err, &rtErr)
+	return rtErr, ok
+}
+
+// Whether err is a runtime rejection that will not change on resubmission
+func IsPermanent(err error) bool {
+	rtErr, ok := RuntimeErrorOf(err)
+	return ok && rtErr.Permanent
+}
+
+// Resolve the dispatch error to the pallet and error names of the runtime
+func decodeDispatchError(meta *types.Metadata, d DispatchError) *RuntimeError {
+	switch d.Variant {
+	case DispatchError_Module:
+		pallet, name, docs := moduleErrorName(meta, d.Module, d.Error)
+		e := moduleError(pallet, name)
+		e.Docs = docs
+		return e
+	case DispatchError_Token:
+		return &RuntimeError{Pallet: "Token", Name: enumName(tokenErrorNames, d.Error)}
+	case DispatchError_Arithmetic:
+		return &RuntimeError{Pallet: "Arithmetic", Name: enumName(arithmeticErrorNames, d.Error), Permanent: true}
+	case DispatchError_Transactional:
+		return &RuntimeError{Pallet: "Transactional", Name: enumName(transactionalErrorNames, d.Error), Permanent: true}
+	case DispatchError_CannotLookup, DispatchError_BadOrigin, DispatchError_Corruption:
+		return &RuntimeError{Name: enumName(dispatchErrorNames, d.Variant), Permanent: true}
+	}
+	return &RuntimeError{Name: enumName(dispatchErrorNames, d.Variant)}
+}
+
+// A module error, permanent unless transientModuleErrors lists it
+func moduleError(pallet, name string) *RuntimeError {
+	return &RuntimeError{Pallet: pallet, Name: name, Permanent: !transientModuleErrors[pallet][name]}
+}
+
+// Look up the names of a module error in the metadata.
+// Unknown indexes are reported as numbers.
+func moduleErrorName(meta *types.Metadata, module, index uint8) (string, string, string) {
+	pallet := fmt.Sprintf("Module(%v)", module)
+	name := fmt.Sprintf("Error(%v)", index)
+	if meta == nil {
+		return pallet, name, ""
+	}
+	switch {
+	case meta.Version == 14:
+		for _, mod := range meta.AsMetadataV14.Pallets {
+			if uint8(mod.Index) != module {
+				continue
+			}
+			pallet = string(mod.Name)
+			if !mod.HasErrors {
+				break
+			}
+			typ, ok := meta.AsMetadataV14.EfficientLookup[mod.Errors.Type.Int64()]
+			if !ok {
+				break
+			}
+			for _, v := range typ.Def.Variant.Variants {
+				if uint8(v.Index) == index {
+					return pallet, string(v.Name), joinDocs(v.Docs)
+				}
+			}
+		}
+	case meta.Version == 13:
+		for _, mod := range meta.AsMetadataV13.Modules {
+			if mod.Index != module {
+				continue
+			}
+			pallet = string(mod.Name)
+			if int(index) < len(mod.Errors) {
+				return pallet, string(mod.Errors[index].Name), joinDocs(mod.Errors[index].Documentation)
+			}
+		}
+	}
+	return pallet, name, ""
+}
+
+func enumName(names []string, i uint8) string {
+	if int(i) < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("Unknown(%v)", i)
+}
+
+func joinDocs(docs []types.Text) string {
+	s := ""
+	for i := 0; i < len(docs); i++ {
+		if i > 0 {
+			s += " "
+		}
+		s += string(docs[i])
+	}
+	return s
+}
@@ -0,0 +1,186 @@
+package chain
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"storage-mining/configs"
+	"storage-mining/internal/logger"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/scale"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Returned instead of a receipt in dry-run mode, once the extrinsic was
+// built, signed and accepted by the runtime
+var ErrDryRun = errors.New("dry run, not submitted")
+
+// Whether err reports a successful dry run
+func IsDryRun(err error) bool {
+	return errors.Is(err, ErrDryRun)
+}
+
+// sp_runtime::InvalidTransaction variants
+var invalidTxNames = []string{"Call", "Payment", "Future", "Stale", "BadProof", "AncientBirthBlock",
+	"ExhaustsResources", "Custom", "BadMandatory", "MandatoryDispatch", "BadSigner"}
+
+// sp_runtime::UnknownTransaction variants
+var unknownTxNames = []string{"CannotLookup", "NoUnsignedValidator", "Custom"}
+
+// Validate the signed extrinsic against the runtime without broadcasting
+// it. system_dryRun applies it to the best block; nodes that do not allow
+// this unsafe rpc are asked for its fee instead, which still checks that
+// it decodes and that the signer can pay.
+func dryRun(api *gsrpc.SubstrateAPI, meta *types.Metadata, ext types.Extrinsic, callName string, args []interface{}) error {
+	enc, err := types.EncodeToHexString(ext)
+	if err != nil {
+		return errors.Wrapf(err, "EncodeToHexString err [%v]", callName)
+	}
+	h, _ := extrinsicHash(ext)
+	logger.InfoLogger.Sugar().Infof("[dry-run][%v] call %v, nonce %v, hash %v, args %v",
+		callName, ext.Method.CallIndex, ext.Signature.Nonce.Int64(), h.Hex(), formatArgs(args))
+
+	applied, err := applyDryRun(api, meta, enc)
+	if !applied {
+		logger.InfoLogger.Sugar().Infof("[dry-run][%v] system_dryRun unavailable, fall back to payment_queryInfo: %v", callName, err)
+		fee, err := queryFee(api, enc)
+		if err != nil {
+			return errors.Wrapf(err, "[dry-run][%v] rejected", callName)
+		}
+		logger.InfoLogger.Sugar().Infof("[dry-run][%v] valid, fee %v TCESS", callName, PlanckToTokens(fee))
+		return ErrDryRun
+	}
+	if err != nil {
+		return errors.Wrapf(err, "[dry-run][%v] rejected", callName)
+	}
+	logger.InfoLogger.Sugar().Infof("[dry-run][%v] applied successfully", callName)
+	return ErrDryRun
+}
+
+// Apply the hex encoded extrinsic to the best block with system_dryRun.
+// applied is false if the node could not, err is then the rpc error,
+// otherwise it is the rejection of the runtime.
+func applyDryRun(api *gsrpc.SubstrateAPI, meta *types.Metadata, enc string) (bool, error) {
+	var res string
+	err := api.Client.Call(&res, "system_dryRun", enc)
+	if err != nil {
+		return false, err
+	}
+	b, err := types.HexDecodeString(res)
+	if err != nil {
+		return false, errors.Wrap(err, "HexDecodeString err")
+	}
+	return true, applyResult(meta, b)
+}
+
+// Ask the runtime whether it would accept the call from the identity
+// account, signed with its nonce in the best block, without broadcasting
+// it. Unlike a rejected extrinsic the answer costs no fee. checked is
+// false if the node does not allow system_dryRun.
+func dryRunCall(identifyAccountPhrase, callName string, args ...interface{}) (bool, error) {
+	signer, err := accountSigner(identifyAccountPhrase)
+	if err != nil {
+		return false, errors.Wrapf(err, "accountSigner err [%v]", callName)
+	}
+	api := getSubstrateAPI()
+	defer releaseSubstrateAPI()
+	ctx, err := getChainContext(api)
+	if err != nil {
+		return false, errors.Wrapf(err, "getChainContext err [%v]", callName)
+	}
+	c, err := types.NewCall(ctx.meta, callName, args...)
+	if err != nil {
+		return false, errors.Wrapf(err, "NewCall err [%v]", callName)
+	}
+	nonce, err := accountNonce(api, ctx.meta, signer.PublicKey())
+	if err != nil {
+		return false, errors.Wrapf(err, "accountNonce err [%v]", callName)
+	}
+	ext, err := signCall(api, ctx, signer, c, nonce, callName)
+	if err != nil {
+		return false, err
+	}
+	enc, err := types.EncodeToHexString(ext)
+	if err != nil {
+		return false, errors.Wrapf(err, "EncodeToHexString err [%v]", callName)
+	}
+	checked, err := applyDryRun(api, ctx.meta, enc)
+	if !checked {
+		logger.InfoLogger.Sugar().Infof("[%v] cannot be checked, system_dryRun unavailable: %v", callName, err)
+		return false, nil
+	}
+	return true, errors.Wrapf(err, "[%v] rejected by the runtime", callName)
+}
+
+// Decode an ApplyExtrinsicResult:
+// Result<Result<(), DispatchError>, TransactionValidityError>
+func applyResult(meta *types.Metadata, b []byte) error {
+	d := scale.NewDecoder(bytes.NewReader(b))
+	valid, err := d.ReadOneByte()
+	if err != nil {
+		return errors.Wrap(err, "invalid ApplyExtrinsicResult")
+	}
+	if valid == 0 {
+		ok, err := d.ReadOneByte()
+		if err != nil {
+			return errors.Wrap(err, "invalid ApplyExtrinsicResult")
+		}
+		if ok == 0 {
+			return nil
+		}
+		de, err := readDispatchError(d, meta)
+		if err != nil {
+			return errors.Wrap(err, "invalid ApplyExtrinsicResult")
+		}
+		return errors.Wrap(decodeDispatchError(meta, de), "dispatch failed")
+	}
+	kind, err := d.ReadOneByte()
+	if err != nil {
+		return errors.Wrap(err, "invalid ApplyExtrinsicResult")
+	}
+	v, err := d.ReadOneByte()
+	if err != nil {
+		return errors.Wrap(err, "invalid ApplyExtrinsicResult")
+	}
+	if kind == 0 {
+		return errors.Errorf("invalid transaction: %v", enumName(invalidTxNames, v))
+	}
+	return errors.Errorf("unknown transaction: %v", enumName(unknownTxNames, v))
+}
+
+// Print the call arguments, byte strings in hex
+func formatArgs(args []interface{}) string {
+	s := "("
+	for i, a := range args {
+		if i > 0 {
+			s += ", "
+		}
+		switch v := a.(type) {
+		case types.Bytes:
+			s += types.HexEncodeToString(v)
+		case []types.Bytes:
+			s += "["
+			for k := range v {
+				if k > 0 {
+					s += " "
+				}
+				s += types.HexEncodeToString(v[k])
+			}
+			s += "]"
+		default:
+			s += fmt.Sprintf("%v", a)
+		}
+	}
+	return s + ")"
+}
+
+// End a one-shot command whose transaction was only dry run
+func exitDryRun(what string, err error) {
+	if IsDryRun(err) {
+		fmt.Printf("\x1b[%dm[ok]\x1b[0m Dry run: the %v is valid, nothing was submitted\n", 42, what)
+		logger.InfoLogger.Sugar().Infof("[dry-run] %v valid", what)
+		os.Exit(configs.Exit_Normal)
+	}
+}
@@ -0,0 +1,157 @@
+package chain
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"storage-mining/tools"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Earnings of the miner in TCESS
+type EarningsInfo struct {
+	Beneficiary  string `json:"beneficiary"`
+	Earnings     string `json:"earnings"`
+	Locked       string `json:"locked"`
+	Withdrawable string `json:"withdrawable"`
+}
+
+// A withdrawal of earnings, appended to the withdrawal log
+type WithdrawalRecord struct {
+	Time          string `json:"time"`
+	Beneficiary   string `json:"beneficiary"`
+	Amount        string `json:"amount"`
+	ExtrinsicHash string `json:"extrinsicHash"`
+	BlockHash     string `json:"blockHash"`
+}
+
+// Read the earnings of the miner. Locked earnings are released by the
+// chain over time, the rest can be withdrawn.
+func GetEarnings() (EarningsInfo, error) {
+	var info EarningsInfo
+	mdata, err := Client.GetMinerDataOnChain(
+		keystore.Secret(),
+		configs.ChainModule_Sminer,
+		configs.ChainModule_Sminer_MinerItems,
+	)
+	if err != nil {
+		return info, err
+	}
+	if mdata.Peerid == 0 {
+		return info, errors.New("not registered")
+	}
+	earnings, locked := u128Int(mdata.Earnings), u128Int(mdata.Locked)
+	info.Beneficiary, err = tools.EncodeSS58(mdata.Beneficiary[:], configs.NetworkProfile.SS58Prefix)
+	if err != nil {
+		return info, err
+	}
+	info.Earnings = PlanckToTokens(earnings)
+	info.Locked = PlanckToTokens(locked)
+	info.Withdrawable = PlanckToTokens(withdrawable(earnings, locked))
+	return info, nil
+}
+
+func withdrawable(earnings, locked *big.Int) *big.Int {
+	v := new(big.Int).Sub(earnings, locked)
+	if v.Sign() < 0 {
+		v.SetInt64(0)
+	}
+	return v
+}
+
+// Withdraw the available earnings to the beneficiary account and record
+// the receipt in the withdrawal log
+func ClaimEarnings() (WithdrawalRecord, error) {
+	var rec WithdrawalRecord
+	mdata, err := Client.GetMinerDataOnChain(
+		keystore.Secret(),
+		configs.ChainModule_Sminer,
+		configs.ChainModule_Sminer_MinerItems,
+	)
+	if err != nil {
+		return rec, err
+	}
+	if mdata.Peerid == 0 {
+		return rec, errors.New("not registered")
+	}
+	if withdrawable(u128Int(mdata.Earnings), u128Int(mdata.Locked)).Sign() == 0 {
+		return rec, errors.New("no withdrawable earnings")
+	}
+	beneficiary, err := tools.EncodeSS58(mdata.Beneficiary[:], configs.NetworkProfile.SS58Prefix)
+	if err != nil {
+		return rec, err
+	}
+	receipt, err := Client.WithdrawEarnings(keystore.Secret())
+	if err != nil {
+		return rec, err
+	}
+	amount, ok := withdrawnAmount(receipt, mdata.Beneficiary)
+	if !ok {
+		// no transfer event of the extrinsic, the earnings it took are
+		// the amount
+		after, err := Client.GetMinerDataOnChain(
+			keystore.Secret(),
+			configs.ChainModule_Sminer,
+			configs.ChainModule_Sminer_MinerItems,
+		)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+		} else {
+			amount = new(big.Int).Sub(u128Int(mdata.Earnings), u128Int(after.Earnings))
+		}
+	}
+	rec = WithdrawalRecord{
+		Time:          time.Now().Format("2006-01-02 15:04:05"),
+		Beneficiary:   beneficiary,
+		Amount:        PlanckToTokens(amount),
+		ExtrinsicHash: receipt.ExtrinsicHash.Hex(),
+		BlockHash:     receipt.BlockHash.Hex(),
+	}
+	logger.InfoLogger.Sugar().Infof("[%v] withdrew %v TCESS to %v [%v][%v]", configs.MinerId_S, rec.Amount, rec.Beneficiary, rec.ExtrinsicHash, rec.BlockHash)
+	err = appendWithdrawalRecord(rec)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+	}
+	return rec, nil
+}
+
+// The tokens the extrinsic of the receipt transferred to the beneficiary,
+// false if its block has no such event
+func withdrawnAmount(receipt TxReceipt, beneficiary types.AccountID) (*big.Int, bool) {
+	amount := new(big.Int)
+	found := false
+	for _, v := range receipt.Events.Balances_Transfer {
+		if receipt.Index < 0 || !v.Phase.IsApplyExtrinsic || v.Phase.AsApplyExtrinsic != uint32(receipt.Index) {
+			continue
+		}
+		if v.To == beneficiary {
+			amount.Add(amount, u128Int(v.Value))
+			found = true
+		}
+	}
+	return amount, found
+}
+
+func appendWithdrawalRecord(rec WithdrawalRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "Marshal err")
+	}
+	f, err := os.OpenFile(filepath.Join(configs.MinerDataPath, configs.WithdrawalFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return errors.Wrap(err, "OpenFile err")
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "f.Write err")
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package chain
+
+import (
+	"storage-mining/configs"
+	"storage-mining/internal/logger"
+	"strings"
+	"sync"
+	"time"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// A configured RPC node and the result of its last health check
+type endpoint struct {
+	addr    string
+	api     *gsrpc.SubstrateAPI
+	genesis types.Hash
+	healthy bool
+	peers   uint64
+	syncing bool
+	best    uint64
+	latency time.Duration
+	checked time.Time
+	err     error
+}
+
+// Health of one RPC node, as reported by EndpointStatus
+type EndpointInfo struct {
+	Addr      string `json:"addr"`
+	InUse     bool   `json:"inUse"`
+	Healthy   bool   `json:"healthy"`
+	Peers     uint64 `json:"peers"`
+	BestBlock uint64 `json:"bestBlock"`
+	LatencyMs int64  `json:"latencyMs"`
+	Lag       uint64 `json:"lag"`
+	Checked   string `json:"checked"`
+	Err       string `json:"err,omitempty"`
+}
+
+var (
+	// protects endpoints, cur and inUse. r itself is replaced under wlock.
+	epLock    sync.Mutex
+	endpoints []*endpoint
+	cur       int
+	// the connection r points to
+	inUse *gsrpc.SubstrateAPI
+)
+
+var (
+	// watches of submitted extrinsics per connection. A connection that
+	// was replaced is closed when its last watch is done.
+	apiLock    sync.Mutex
+	apiUsers   = make(map[*gsrpc.SubstrateAPI]int)
+	apiRetired = make(map[*gsrpc.SubstrateAPI]bool)
+)
+
+// Addresses from cessChain.rpcAddr and cessChain.rpcAddrs, without duplicates
+func rpcAddrs() []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	all := append([]string{configs.Confile.CessChain.RpcAddr}, configs.Confile.CessChain.RpcAddrs...)
+	for _, v := range all {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		addrs = append(addrs, v)
+	}
+	return addrs
+}
+
+// Probe every configured endpoint and connect to the best one
+func connectEndpoints() error {
+	addrs := rpcAddrs()
+	if len(addrs) == 0 {
+		return errors.New("no rpc address configured")
+	}
+	for _, v := range addrs {
+		endpoints = append(endpoints, &endpoint{addr: v})
+	}
+	probeEndpoints()
+	epLock.Lock()
+	defer epLock.Unlock()
+	best := bestEndpoint()
+	if best < 0 {
+		return errors.Errorf("none of the rpc addresses is reachable: %v", endpoints[0].err)
+	}
+	cur = best
+	inUse = endpoints[cur].api
+	r = inUse
+	return nil
+}
+
+// Check the health of all endpoints in parallel, reconnecting the ones
+// without a connection
+func probeEndpoints() {
+	var wg sync.WaitGroup
+	epLock.Lock()
+	eps := make([]*endpoint, len(endpoints))
+	copy(eps, endpoints)
+	epLock.Unlock()
+	for _, ep := range eps {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			ep.probe()
+		}(ep)
+	}
+	wg.Wait()
+}
+
+func (e *endpoint) probe() {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	epLock.Lock()
+	api := e.api
+	epLock.Unlock()
+
+	var (
+		err     error
+		peers   uint64
+		syncing bool
+		best    uint64
+		start   = time.Now()
+		latency time.Duration
+	)
+	if api == nil {
+		api, err = gsrpc.NewSubstrateAPI(e.addr)
+	}
+	if err == nil {
+		peers, syncing, err = healthchek(api)
+	}
+	if err == nil {
+		latency = time.Since(start)
+		h, herr := api.RPC.Chain.GetHeaderLatest()
+		if herr != nil {
+			err = errors.Wrap(herr, "GetHeaderLatest err")
+		} else {
+			best = uint64(h.Number)
+		}
+	}
+	// a node of another chain is never used
+	epLock.Lock()
+	genesis := e.genesis
+	epLock.Unlock()
+	if err == nil && genesis == (types.Hash{}) {
+		genesis, err = api.RPC.Chain.GetBlockHash(0)
+		if err != nil {
+			err = errors.Wrap(err, "GetBlockHash err")
+		} else {
+			err = verifyGenesis(genesis)
+		}
+	}
+
+	epLock.Lock()
+	defer epLock.Unlock()
+	e.api = api
+	e.checked = time.Now()
+	e.err = err
+	if err == nil {
+		e.genesis = genesis
+	}
+	e.healthy = err == nil && peers > 0
+	if err != nil {
+		e.peers, e.syncing, e.best, e.latency = 0, false, 0, 0
+		e.genesis = types.Hash{}
+		// the next probe dials again, the connection in use is
+		// retired by failover once it is replaced
+		if e.api != nil && e.api != inUse {
+			retireAPI(e.api)
+		}
+		e.api = nil
+		return
+	}
+	e.peers, e.syncing, e.best, e.latency = peers, syncing, best, latency
+}
+
+// Whether the node in use reported it is syncing at its last probe
+func nodeSyncing() bool {
+	epLock.Lock()
+	defer epLock.Unlock()
+	if cur < 0 || cur >= len(endpoints) {
+		return false
+	}
+	return endpoints[cur].syncing
+}
+
+// Highest best block seen on any healthy endpoint, epLock must be held
+func maxBest() uint64 {
+	var m uint64
+	for _, v := range endpoints {
+		if v.healthy && v.best > m {
+			m = v.best
+		}
+	}
+	return m
+}
+
+// Health score of an endpoint, higher is better. Unhealthy endpoints
+// and endpoints lagging too far behind are ranked below all others.
+// epLock must be held.
+func (e *endpoint) score(top uint64) int64 {
+	if !e.healthy {
+		return -1 << 62
+	}
+	lag := int64(top - e.best)
+	s := -lag*1000 - e.latency.Milliseconds()
+	if lag > configs.MaxBlockLag {
+		s -= 1 << 40
+	}
+	peers := int64(e.peers)
+	if peers > 10 {
+		peers = 10
+	}
+	return s + peers*10
+}
+
+// Index of the endpoint with the highest score, -1 if none is healthy.
+// epLock must be held.
+func bestEndpoint() int {
+	top := maxBest()
+	best := -1
+	for i, v := range endpoints {
+		if !v.healthy {
+			continue
+		}
+		if best < 0 || v.score(top) > endpoints[best].score(top) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Whether the endpoint in use should be given up, epLock must be held
+func (e *endpoint) degraded(top uint64) bool {
+	return !e.healthy || int64(top-e.best) > configs.MaxBlockLag
+}
+
+// Switch to another endpoint when the one in use is unhealthy or lags
+// behind, or to a fresh connection of the same endpoint after it was
+// lost. The global api is replaced under wlock, so no chain call sees a
+// half switched state. The old connection stays open for the extrinsics
+// still watched on it.
+func failover() {
+	epLock.Lock()
+	top := maxBest()
+	next := cur
+	if endpoints[cur].degraded(top) {
+		best := bestEndpoint()
+		if best >= 0 && !endpoints[best].degraded(top) {
+			next = best
+		} else if best < 0 {
+			logger.ErrLogger.Sugar().Errorf("no healthy rpc endpoint: %v", endpoints[cur].err)
+		}
+	}
+	ep := endpoints[next]
+	if ep.api == nil || ep.api == inUse {
+		epLock.Unlock()
+		return
+	}
+	old, oldAddr := inUse, endpoints[cur].addr
+	cur = next
+	inUse = ep.api
+	orphaned := true
+	for _, v := range endpoints {
+		if v.api == old {
+			orphaned = false
+		}
+	}
+	epLock.Unlock()
+
+	wlock.Lock()
+	r = ep.api
+	wlock.Unlock()
+	if orphaned && old != nil {
+		retireAPI(old)
+	}
+	// another node may not know our pending transactions
+	nonces.resync()
+	logger.InfoLogger.Sugar().Infof("rpc endpoint switched from %v to %v", oldAddr, ep.addr)
+}
+
+// Address of the RPC endpoint in use
+func CurrentEndpoint() string {
+	epLock.Lock()
+	defer epLock.Unlock()
+	if len(endpoints) == 0 {
+		return ""
+	}
+	return endpoints[cur].addr
+}
+
+// Health of all configured RPC endpoints
+func EndpointStatus() []EndpointInfo {
+	epLock.Lock()
+	defer epLock.Unlock()
+	top := maxBest()
+	infos := make([]EndpointInfo, 0, len(endpoints))
+	for i, v := range endpoints {
+		info := EndpointInfo{
+			Addr:      v.addr,
+			InUse:     i == cur,
+			Healthy:   v.healthy,
+			Peers:     v.peers,
+			BestBlock: v.best,
+			LatencyMs: v.latency.Milliseconds(),
+			Checked:   v.checked.Format("2006-01-02 15:04:05"),
+		}
+		if v.healthy {
+			info.Lag = top - v.best
+		}
+		if v.err != nil {
+			info.Err = v.err.Error()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Keep the connection open until dropAPI, for a watch that goes on after
+// the api lock was released. Called with wlock held, so failover cannot
+// retire the connection in between.
+func holdAPI(api *gsrpc.SubstrateAPI) {
+	apiLock.Lock()
+	apiUsers[api]++
+	apiLock.Unlock()
+}
+
+// End a watch started with holdAPI
+func dropAPI(api *gsrpc.SubstrateAPI) {
+	apiLock.Lock()
+	defer apiLock.Unlock()
+	apiUsers[api]--
+	if apiUsers[api] > 0 {
+		return
+	}
+	delete(apiUsers, api)
+	if apiRetired[api] {
+		delete(apiRetired, api)
+		closeAPI(api)
+	}
+}
+
+// Close a connection that takes no new calls, once the watches still
+// running on it are done
+func retireAPI(api *gsrpc.SubstrateAPI) {
+	apiLock.Lock()
+	defer apiLock.Unlock()
+	if apiUsers[api] > 0 {
+		apiRetired[api] = true
+		return
+	}
+	closeAPI(api)
+}
+
+func closeAPI(api *gsrpc.SubstrateAPI) {
+	c, ok := api.Client.(interface{ Close() })
+	if ok {
+		c.Close()
+	}
+}
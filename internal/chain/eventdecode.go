@@ -0,0 +1,378 @@
+package chain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"storage-mining/internal/logger"
+	"sync"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/scale"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Nesting limit of the types walked, against recursive or corrupt metadata
+const maxTypeDepth = 64
+
+// An event of any pallet, decoded with the types of the runtime metadata
+type BlockEvent struct {
+	Phase  types.Phase
+	Pallet string
+	Name   string
+	// the fields by name, or by position for unnamed fields
+	Fields []EventField
+	// the encoded fields
+	Data   []byte
+	Topics []types.Hash
+}
+
+type EventField struct {
+	Name  string
+	Value interface{}
+	// the encoded value, for the fields of an event
+	Data []byte
+}
+
+// A field of a typed event that is filled from its value decoded with the
+// runtime type rather than from its bytes, for types whose encoding
+// differs between runtimes
+type runtimeValue interface {
+	setRuntimeValue(v interface{}) error
+}
+
+// Events whose typed struct does not match the runtime, warned once
+var eventMismatch sync.Map
+
+// Decode the System.Events of a block into the typed events of target.
+// With V14 metadata every event is walked with its runtime type, so an
+// event target does not declare, or no longer matches, is skipped instead
+// of failing the block. Older metadata carries no type information and
+// goes through the fixed decoder.
+func decodeEvents(meta *types.Metadata, raw []byte, target *MyEventRecords) error {
+	if meta.Version != 14 {
+		return types.EventRecordsRaw(raw).DecodeEventRecords(meta, target)
+	}
+	evs, err := DecodeBlockEvents(meta, raw)
+	v := reflect.ValueOf(target).Elem()
+	for i := 0; i < len(evs); i++ {
+		field := v.FieldByName(evs[i].Pallet + "_" + evs[i].Name)
+		if !field.IsValid() {
+			continue
+		}
+		holder := reflect.New(field.Type().Elem()).Elem()
+		derr := decodeTypedEvent(evs[i], holder)
+		if derr != nil {
+			name := evs[i].Pallet + "." + evs[i].Name
+			if _, warned := eventMismatch.LoadOrStore(name, true); !warned {
+				logger.ErrLogger.Sugar().Errorf("event %v does not match the runtime, skipped: %v", name, derr)
+			}
+			continue
+		}
+		field.Set(reflect.Append(field, holder))
+	}
+	return err
+}
+
+// Fill the struct of a typed event: Phase first, Topics last and the
+// fields in between, which have to take up exactly the encoded data.
+// A runtimeValue field takes the runtime value of the event field in the
+// same position.
+func decodeTypedEvent(ev BlockEvent, holder reflect.Value) error {
+	n := holder.NumField()
+	if n < 2 || holder.Field(0).Type() != reflect.TypeOf(types.Phase{}) || holder.Field(n-1).Type() != reflect.TypeOf([]types.Hash{}) {
+		return errors.Errorf("%v is not an event struct", holder.Type())
+	}
+	holder.Field(0).Set(reflect.ValueOf(ev.Phase))
+	r := bytes.NewReader(ev.Data)
+	d := scale.NewDecoder(r)
+	for j := 1; j < n-1; j++ {
+		if rv, ok := holder.Field(j).Addr().Interface().(runtimeValue); ok {
+			if len(ev.Fields) != n-2 {
+				return errors.Errorf("%v has %v fields, the runtime %v", holder.Type(), n-2, len(ev.Fields))
+			}
+			f := ev.Fields[j-1]
+			err := rv.setRuntimeValue(f.Value)
+			if err != nil {
+				return errors.Wrapf(err, "field %v", holder.Type().Field(j).Name)
+			}
+			_, err = r.Seek(int64(len(f.Data)), io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := d.Decode(holder.Field(j).Addr().Interface())
+		if err != nil {
+			return errors.Wrapf(err, "field %v", holder.Type().Field(j).Name)
+		}
+	}
+	if r.Len() != 0 {
+		return errors.Errorf("%v bytes left over", r.Len())
+	}
+	holder.Field(n - 1).Set(reflect.ValueOf(ev.Topics))
+	return nil
+}
+
+// Decode every event of a block with the types of V14 metadata. On an
+// error the events before it are returned.
+func DecodeBlockEvents(meta *types.Metadata, raw []byte) ([]BlockEvent, error) {
+	if meta.Version != 14 {
+		return nil, errors.Errorf("metadata V%v has no event types", meta.Version)
+	}
+	m := &meta.AsMetadataV14
+	r := bytes.NewReader(raw)
+	d := scale.NewDecoder(r)
+	n, err := d.DecodeUintCompact()
+	if err != nil {
+		return nil, errors.Wrap(err, "event count")
+	}
+	var evs []BlockEvent
+	for i := uint64(0); i < n.Uint64(); i++ {
+		var ev BlockEvent
+		err = d.Decode(&ev.Phase)
+		if err != nil {
+			return evs, errors.Wrapf(err, "phase of event #%v", i)
+		}
+		var id types.EventID
+		err = d.Decode(&id)
+		if err != nil {
+			return evs, errors.Wrapf(err, "id of event #%v", i)
+		}
+		pallet, variant, err := eventVariant(m, id)
+		if err != nil {
+			return evs, errors.Wrapf(err, "event #%v", i)
+		}
+		ev.Pallet, ev.Name = pallet, string(variant.Name)
+		start := offset(r)
+		for k, f := range variant.Fields {
+			at := offset(r)
+			v, err := decodeValue(d, m, f.Type.Int64(), 1)
+			if err != nil {
+				return evs, errors.Wrapf(err, "event #%v %v.%v", i, ev.Pallet, ev.Name)
+			}
+			ev.Fields = append(ev.Fields, EventField{Name: fieldName(k, f), Value: v, Data: raw[at:offset(r)]})
+		}
+		ev.Data = raw[start:offset(r)]
+		err = d.Decode(&ev.Topics)
+		if err != nil {
+			return evs, errors.Wrapf(err, "topics of event #%v", i)
+		}
+		evs = append(evs, ev)
+	}
+	return evs, nil
+}
+
+func offset(r *bytes.Reader) int64 {
+	return r.Size() - int64(r.Len())
+}
+
+// Find the pallet and the event variant of an event id
+func eventVariant(m *types.MetadataV14, id types.EventID) (string, *types.Si1Variant, error) {
+	for _, p := range m.Pallets {
+		if !p.HasEvents || uint8(p.Index) != id[0] {
+			continue
+		}
+		t, ok := m.EfficientLookup[p.Events.Type.Int64()]
+		if !ok || !t.Def.IsVariant {
+			return "", nil, errors.Errorf("no event type for pallet %v", p.Name)
+		}
+		for k := range t.Def.Variant.Variants {
+			if uint8(t.Def.Variant.Variants[k].Index) == id[1] {
+				return string(p.Name), &t.Def.Variant.Variants[k], nil
+			}
+		}
+		return "", nil, errors.Errorf("unknown event %v of pallet %v", id[1], p.Name)
+	}
+	return "", nil, errors.Errorf("unknown pallet %v", id[0])
+}
+
+func decodeFields(d *scale.Decoder, m *types.MetadataV14, fields []types.Si1Field, depth int) ([]EventField, error) {
+	var list []EventField
+	for k, f := range fields {
+		v, err := decodeValue(d, m, f.Type.Int64(), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, EventField{Name: fieldName(k, f), Value: v})
+	}
+	return list, nil
+}
+
+// The name of a field, or its position if it has none
+func fieldName(k int, f types.Si1Field) string {
+	if f.HasName {
+		return string(f.Name)
+	}
+	return fmt.Sprintf("%v", k)
+}
+
+// Decode a value of any type of the registry: structs and enums into
+// fields, sequences into slices ([]byte for bytes), integers into uint64,
+// int64 or *big.Int
+func decodeValue(d *scale.Decoder, m *types.MetadataV14, id int64, depth int) (interface{}, error) {
+	if depth > maxTypeDepth {
+		return nil, errors.New("types nested too deep")
+	}
+	t, ok := m.EfficientLookup[id]
+	if !ok {
+		return nil, errors.Errorf("unknown type %v", id)
+	}
+	def := t.Def
+	switch {
+	case def.IsComposite:
+		fields, err := decodeFields(d, m, def.Composite.Fields, depth)
+		if err != nil {
+			return nil, err
+		}
+		// a new type is the value it wraps
+		if len(fields) == 1 && !def.Composite.Fields[0].HasName {
+			return fields[0].Value, nil
+		}
+		return fields, nil
+	case def.IsVariant:
+		b, err := d.ReadOneByte()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range def.Variant.Variants {
+			if uint8(v.Index) != b {
+				continue
+			}
+			fields, err := decodeFields(d, m, v.Fields, depth)
+			if err != nil {
+				return nil, err
+			}
+			if len(fields) == 0 {
+				return string(v.Name), nil
+			}
+			return EventField{Name: string(v.Name), Value: fields}, nil
+		}
+		return nil, errors.Errorf("unknown variant %v of type %v", b, id)
+	case def.IsSequence:
+		n, err := d.DecodeUintCompact()
+		if err != nil {
+			return nil, err
+		}
+		return decodeList(d, m, def.Sequence.Type.Int64(), n.Uint64(), depth)
+	case def.IsArray:
+		return decodeList(d, m, def.Array.Type.Int64(), uint64(def.Array.Len), depth)
+	case def.IsTuple:
+		var list []interface{}
+		for _, e := range def.Tuple {
+			v, err := decodeValue(d, m, e.Int64(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case def.IsPrimitive:
+		return decodePrimitive(d, def.Primitive.Si0TypeDefPrimitive)
+	case def.IsCompact:
+		n, err := d.DecodeUintCompact()
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	case def.IsBitSequence:
+		n, err := d.DecodeUintCompact()
+		if err != nil {
+			return nil, err
+		}
+		store, ok := m.EfficientLookup[def.BitSequence.BitStoreType.Int64()]
+		if !ok || !store.Def.IsPrimitive {
+			return nil, errors.Errorf("unknown bit store of type %v", id)
+		}
+		size := primitiveSize(store.Def.Primitive.Si0TypeDefPrimitive)
+		if size == 0 {
+			return nil, errors.Errorf("unsupported bit store of type %v", id)
+		}
+		words := (n.Uint64() + uint64(size*8) - 1) / uint64(size*8)
+		b := make([]byte, words*uint64(size))
+		err = d.Read(b)
+		return b, err
+	}
+	return nil, errors.Errorf("unsupported definition of type %v", id)
+}
+
+func decodeList(d *scale.Decoder, m *types.MetadataV14, elem int64, n uint64, depth int) (interface{}, error) {
+	if t, ok := m.EfficientLookup[elem]; ok && t.Def.IsPrimitive && t.Def.Primitive.Si0TypeDefPrimitive == types.IsU8 {
+		if n > uint64(maxEventBytes) {
+			return nil, errors.Errorf("byte sequence of %v", n)
+		}
+		b := make([]byte, n)
+		err := d.Read(b)
+		return b, err
+	}
+	var list []interface{}
+	for i := uint64(0); i < n; i++ {
+		v, err := decodeValue(d, m, elem, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// Upper bound of a byte sequence in the events of a block
+const maxEventBytes = 16 << 20
+
+func primitiveSize(p types.Si0TypeDefPrimitive) int {
+	switch p {
+	case types.IsBool, types.IsU8, types.IsI8:
+		return 1
+	case types.IsU16, types.IsI16:
+		return 2
+	case types.IsChar, types.IsU32, types.IsI32:
+		return 4
+	case types.IsU64, types.IsI64:
+		return 8
+	case types.IsU128, types.IsI128:
+		return 16
+	case types.IsU256, types.IsI256:
+		return 32
+	}
+	return 0
+}
+
+func decodePrimitive(d *scale.Decoder, p types.Si0TypeDefPrimitive) (interface{}, error) {
+	if p == types.IsStr {
+		var s types.Text
+		err := d.Decode(&s)
+		return string(s), err
+	}
+	size := primitiveSize(p)
+	if size == 0 {
+		return nil, errors.Errorf("unsupported primitive %v", p)
+	}
+	b := make([]byte, size)
+	err := d.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	// little endian
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	v := new(big.Int).SetBytes(b)
+	switch p {
+	case types.IsBool:
+		return v.Sign() != 0, nil
+	case types.IsU8, types.IsU16, types.IsU32, types.IsU64, types.IsChar:
+		return v.Uint64(), nil
+	case types.IsU128, types.IsU256:
+		return v, nil
+	}
+	// two's complement
+	if b[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(size*8)))
+	}
+	if size <= 8 {
+		return v.Int64(), nil
+	}
+	return v, nil
+}
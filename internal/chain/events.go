@@ -0,0 +1,172 @@
+package chain
+
+import (
+	"storage-mining/configs"
+	"storage-mining/internal/logger"
+	"sync"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Proof kinds of the SegmentBook
+const (
+	Proof_Vpa = "VPA"
+	Proof_Vpb = "VPB"
+	Proof_Vpc = "VPC"
+	Proof_Vpd = "VPD"
+)
+
+// Other kinds of miner events
+const (
+	// challenge random of one of our segments
+	Event_ParamSet = "ParamSet"
+	// periodic task of the Sminer pallet, a new challenge window
+	Event_TimedTask = "TimedTask"
+	// the file slices assigned to the miner changed
+	Event_HoldSlice = "HoldSlice"
+)
+
+// An event of the chain that concerns the miner. For the proof kinds it
+// tells that a proof of one of our segments was submitted or verified.
+type MinerEvent struct {
+	Kind      string
+	Verified  bool
+	PeerId    uint64
+	SegmentId uint64
+	// challenge random of Event_ParamSet
+	Random uint32
+	Block  types.Hash
+	// block number of Event_TimedTask
+	Number uint64
+}
+
+// Follow the System.Events of new blocks and the MinerHoldSlice storage of
+// the miner in one subscription, and pass on the events of peerid.
+// The channel is closed when the subscription ends.
+func SubscribeMinerEvents(identifyAccountPhrase string, peerid uint64) (<-chan MinerEvent, func(), error) {
+	api := getSubstrateAPI()
+	meta, err := getMetadata(api)
+	if err != nil {
+		releaseSubstrateAPI()
+		return nil, nil, err
+	}
+	pub, err := accountPublicKey(identifyAccountPhrase)
+	if err != nil {
+		releaseSubstrateAPI()
+		return nil, nil, err
+	}
+	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
+	if err != nil {
+		releaseSubstrateAPI()
+		return nil, nil, errors.Wrap(err, "CreateStorageKey System Events err")
+	}
+	keys, err := types.CreateStorageKey(meta, configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_MinerHoldSlice, pub)
+	if err != nil {
+		releaseSubstrateAPI()
+		return nil, nil, errors.Wrap(err, "CreateStorageKey MinerHoldSlice err")
+	}
+	sub, err := api.RPC.State.SubscribeStorageRaw([]types.StorageKey{keye, keys})
+	releaseSubstrateAPI()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "SubscribeStorageRaw err")
+	}
+
+	var (
+		ch    = make(chan MinerEvent, 64)
+		quit  = make(chan struct{})
+		once  sync.Once
+		first = true
+	)
+	send := func(v MinerEvent) bool {
+		select {
+		case ch <- v:
+			return true
+		case <-quit:
+			return false
+		}
+	}
+	go func() {
+		defer close(ch)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case set := <-sub.Chan():
+				for _, change := range set.Changes {
+					if types.HexEncodeToString(change.StorageKey) == keys.Hex() {
+						// the first set holds the current value, not a change
+						if !first && !send(MinerEvent{Kind: Event_HoldSlice, PeerId: peerid, Block: set.Block}) {
+							return
+						}
+						continue
+					}
+					if !change.HasStorageData {
+						continue
+					}
+					var events MyEventRecords
+					err := decodeEvents(meta, change.StorageData, &events)
+					if err != nil {
+						logger.ErrLogger.Sugar().Errorf("[%v] decodeEvents err: %v", set.Block.Hex(), err)
+					}
+					for _, v := range minerEvents(&events, peerid) {
+						v.Block = set.Block
+						if v.Kind == Event_TimedTask {
+							v.Number = blockNumber(api, set.Block)
+						}
+						if !send(v) {
+							return
+						}
+					}
+				}
+				first = false
+			case err := <-sub.Err():
+				logger.ErrLogger.Sugar().Errorf("System.Events subscription err: %v", err)
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return ch, func() { once.Do(func() { close(quit) }) }, nil
+}
+
+// Number of the block, 0 if the header cannot be read
+func blockNumber(api *gsrpc.SubstrateAPI, blockHash types.Hash) uint64 {
+	h, err := api.RPC.Chain.GetHeader(blockHash)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v] GetHeader err: %v", blockHash.Hex(), err)
+		return 0
+	}
+	return uint64(h.Number)
+}
+
+// Pick the events of peerid out of the block events
+func minerEvents(events *MyEventRecords, peerid uint64) []MinerEvent {
+	var result []MinerEvent
+	add := func(evs []Event_VPABCD_Submit_Verify, kind string, verified bool) {
+		for i := 0; i < len(evs); i++ {
+			if uint64(evs[i].PeerId) == peerid {
+				result = append(result, MinerEvent{Kind: kind, Verified: verified, PeerId: peerid, SegmentId: uint64(evs[i].SegmentId)})
+			}
+		}
+	}
+	for i := 0; i < len(events.SegmentBook_ParamSet); i++ {
+		v := events.SegmentBook_ParamSet[i]
+		if uint64(v.PeerId) == peerid {
+			result = append(result, MinerEvent{Kind: Event_ParamSet, PeerId: peerid, SegmentId: uint64(v.SegmentId), Random: uint32(v.Random)})
+		}
+	}
+	add(events.SegmentBook_VPASubmitted, Proof_Vpa, false)
+	add(events.SegmentBook_VPBSubmitted, Proof_Vpb, false)
+	add(events.SegmentBook_VPCSubmitted, Proof_Vpc, false)
+	add(events.SegmentBook_VPDSubmitted, Proof_Vpd, false)
+	add(events.SegmentBook_VPAVerified, Proof_Vpa, true)
+	add(events.SegmentBook_VPBVerified, Proof_Vpb, true)
+	add(events.SegmentBook_VPCVerified, Proof_Vpc, true)
+	add(events.SegmentBook_VPDVerified, Proof_Vpd, true)
+	if len(events.Sminer_TimedTask) > 0 {
+		result = append(result, MinerEvent{Kind: Event_TimedTask, PeerId: peerid})
+	}
+	return result
+}
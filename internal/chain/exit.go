@@ -0,0 +1,239 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stages of the exit flow
+const (
+	ExitStage_None = ""
+	// the exit extrinsic is being submitted
+	ExitStage_Requested = "requested"
+	// exited, the collateral is locked until UnlockBlock, or until the
+	// runtime accepts the withdrawal when it is 0
+	ExitStage_Exited = "exited"
+	// the collateral is withdrawn, nothing left to do
+	ExitStage_Withdrawn = "withdrawn"
+)
+
+// Progress of the exit flow, saved in the miner data directory so an
+// interrupted exit continues after a restart
+type ExitProgress struct {
+	Stage        string `json:"stage"`
+	RequestTime  string `json:"requestTime"`
+	ExitBlock    uint64 `json:"exitBlock"`
+	UnlockBlock  uint64 `json:"unlockBlock"`
+	WithdrawTime string `json:"withdrawTime"`
+	LastErr      string `json:"lastErr,omitempty"`
+}
+
+var (
+	exitLock     sync.Mutex
+	exitProgress ExitProgress
+)
+
+// Whether the miner is leaving the network. No new segments are
+// accepted, the stored ones are proven until the collateral is released.
+func Exiting() bool {
+	exitLock.Lock()
+	defer exitLock.Unlock()
+	return exitProgress.Stage != ExitStage_None
+}
+
+// Get the progress of the exit flow
+func GetExitProgress() ExitProgress {
+	exitLock.Lock()
+	defer exitLock.Unlock()
+	return exitProgress
+}
+
+func exitFilePath() string {
+	return filepath.Join(configs.MinerDataPath, configs.ExitFile)
+}
+
+// Read the exit progress from the miner data directory, the miner is
+// not exiting when there is none
+func LoadExitProgress() error {
+	exitLock.Lock()
+	defer exitLock.Unlock()
+	exitProgress = ExitProgress{}
+	b, err := ioutil.ReadFile(exitFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "ReadFile err")
+	}
+	err = json.Unmarshal(b, &exitProgress)
+	if err != nil {
+		return errors.Wrapf(err, "Unmarshal %v err", exitFilePath())
+	}
+	return nil
+}
+
+// Update the progress and write it to disk, through a temporary file so
+// a crash never leaves a truncated file behind
+func saveExitProgress(update func(p *ExitProgress)) error {
+	exitLock.Lock()
+	defer exitLock.Unlock()
+	update(&exitProgress)
+	b, err := json.MarshalIndent(exitProgress, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "MarshalIndent err")
+	}
+	tmp := exitFilePath() + ".tmp"
+	err = ioutil.WriteFile(tmp, b, os.ModePerm)
+	if err != nil {
+		return errors.Wrap(err, "WriteFile err")
+	}
+	return errors.Wrap(os.Rename(tmp, exitFilePath()), "Rename err")
+}
+
+// Submit the exit extrinsic unless it is already confirmed
+func StartExit() error {
+	p := GetExitProgress()
+	if p.Stage == ExitStage_Exited || p.Stage == ExitStage_Withdrawn {
+		return nil
+	}
+	if configs.DryRun {
+		// no progress is saved for an exit that is not submitted
+		_, err := Client.ExitMining(keystore.Secret())
+		return err
+	}
+	err := saveExitProgress(func(p *ExitProgress) {
+		p.Stage = ExitStage_Requested
+		p.RequestTime = time.Now().Format("2006-01-02 15:04:05")
+	})
+	if err != nil {
+		return err
+	}
+	logger.InfoLogger.Sugar().Infof("[%v] submit %v", configs.MinerId_S, configs.ChainTx_Sminer_ExitMining)
+	ok, rejected := Client.ExitMining(keystore.Secret())
+	if rejected != nil {
+		// a restart after the exit was confirmed but before it was saved:
+		// the runtime rejects the second exit, the Sminer storage tells
+		// whether there was a first one
+		if p.Stage != ExitStage_Requested || !IsPermanent(rejected) {
+			return rejected
+		}
+		logger.InfoLogger.Sugar().Infof("[%v] exit rejected, look it up on the chain: %v", configs.MinerId_S, rejected)
+	} else if !ok {
+		return errors.Errorf("%v failed", configs.ChainTx_Sminer_ExitMining)
+	}
+	exitBlock, exited, err := Client.GetExitBlockOnChain(keystore.Secret())
+	if err != nil {
+		if rejected != nil {
+			return rejected
+		}
+		// the exit is confirmed, only the block it took effect at is unknown
+		logger.ErrLogger.Sugar().Errorf("[%v] %v", configs.MinerId_S, err)
+		exitBlock, err = Client.GetBlockHeight()
+		if err != nil {
+			return err
+		}
+	} else if !exited {
+		if rejected != nil {
+			return rejected
+		}
+		return errors.Errorf("%v is confirmed but the miner has not exited", configs.ChainTx_Sminer_ExitMining)
+	}
+	// without the lock-in period of the runtime the withdrawal is tried
+	// until the runtime accepts it
+	lockBlocks, known, err := Client.GetExitLockBlocks()
+	if err != nil {
+		return err
+	}
+	unlockBlock := uint64(0)
+	if known {
+		unlockBlock = exitBlock + lockBlocks
+	}
+	return saveExitProgress(func(p *ExitProgress) {
+		p.Stage = ExitStage_Exited
+		p.ExitBlock = exitBlock
+		p.UnlockBlock = unlockBlock
+		p.LastErr = ""
+	})
+}
+
+// Wait for the lock-in period to end, then withdraw the collateral and
+// stop the program
+func exitMonitor() {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	wait := time.Minute * configs.TimeToRetryWithdraw_M
+	for {
+		p := GetExitProgress()
+		if p.Stage == ExitStage_Withdrawn {
+			fmt.Printf("\x1b[%dm[ok]\x1b[0m Exited the cess mining network, collateral withdrawn at %v\n", 42, p.WithdrawTime)
+			logger.InfoLogger.Sugar().Infof("[%v] exit completed", configs.MinerId_S)
+			os.Exit(configs.Exit_Normal)
+		}
+		height, err := Client.GetBlockHeight()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+		} else if height >= p.UnlockBlock {
+			checked, err := withdrawCollateral()
+			if err == nil {
+				continue
+			}
+			logger.ErrLogger.Sugar().Errorf("[%v] withdraw: %v", configs.MinerId_S, err)
+			// neither the lock-in period nor a dry run told that the
+			// collateral is released, every rejection was paid for
+			if !checked && p.UnlockBlock == 0 && wait < time.Minute*configs.MaxTimeToRetryWithdraw_M {
+				wait *= 2
+			}
+		} else {
+			logger.InfoLogger.Sugar().Infof("[%v] collateral locked until block %v, now %v", configs.MinerId_S, p.UnlockBlock, height)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// A rejected withdrawal means the chain has not released the collateral
+// yet, it is retried after TimeToRetryWithdraw_M
+func WithdrawCollateral() error {
+	_, err := withdrawCollateral()
+	return err
+}
+
+// The withdrawal is dry run first, it is only submitted if the runtime
+// accepts it or the node cannot tell. checked reports a dry run.
+func withdrawCollateral() (bool, error) {
+	checked, err := Client.CheckWithdraw(keystore.Secret())
+	if err == nil {
+		var ok bool
+		ok, err = Client.Withdraw(keystore.Secret())
+		if err == nil && !ok {
+			err = errors.Errorf("%v failed", configs.ChainTx_Sminer_Withdraw)
+		}
+	}
+	if err != nil {
+		serr := saveExitProgress(func(p *ExitProgress) {
+			p.LastErr = err.Error()
+		})
+		if serr != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", serr)
+		}
+		return checked, err
+	}
+	return checked, saveExitProgress(func(p *ExitProgress) {
+		p.Stage = ExitStage_Withdrawn
+		p.WithdrawTime = time.Now().Format("2006-01-02 15:04:05")
+		p.LastErr = ""
+	})
+}
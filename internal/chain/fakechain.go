@@ -0,0 +1,669 @@
+package chain
+
+import (
+	"math/big"
+	"math/rand"
+	"storage-mining/configs"
+	"storage-mining/tools"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// In-memory cess chain for running the mining workflow without a node.
+// It keeps the Sminer and SegmentBook state of its miners, answers
+// intents with random challenges and verifies submitted proofs.
+type FakeChain struct {
+	lock sync.Mutex
+	rnd  *rand.Rand
+	// miners by identify account phrase
+	miners  map[string]*CessChain_MinerItems
+	lastPid uint64
+	lastSeg uint64
+	// challenge of the latest intent, by segment id
+	challenges map[uint64]ParamInfo
+	sizeTypes  map[uint64]uint8
+	// SegmentBook storage by peer id
+	conProofA map[uint64][]IpostParaInfo
+	holdSlice map[uint64][]UnsealedCidInfo
+	conProofC map[uint64][]FpostParaInfo
+	subs      map[uint64][]chan MinerEvent
+	heads     []chan ChainHead
+	// best block and the block each exited miner left at, by peer id
+	height uint64
+	exits  map[uint64]uint64
+	// errors returned once by the next call of a transaction or storage item
+	failures map[string][]error
+	// Decides whether a submitted proof is accepted, all proofs are
+	// accepted if nil
+	Verify func(kind string, peerid, segmentid uint64, proof []byte) bool
+	// Blocks the collateral stays locked after exiting, 0 for a runtime
+	// that does not tell
+	ExitLockBlocks uint64
+	// Target block time, 0 for a runtime that does not tell
+	BlockTime time.Duration
+	// Calls the fake runtime does not have
+	MissingCalls map[string]bool
+	// The node does not dry run extrinsics
+	NoDryRun bool
+	// Withdrawals submitted, accepted or not
+	Withdrawals int
+}
+
+// Create an empty fake chain, the seed makes the challenges reproducible
+func NewFakeChain(seed int64) *FakeChain {
+	return &FakeChain{
+		rnd:            rand.New(rand.NewSource(seed)),
+		miners:         make(map[string]*CessChain_MinerItems),
+		challenges:     make(map[uint64]ParamInfo),
+		sizeTypes:      make(map[uint64]uint8),
+		conProofA:      make(map[uint64][]IpostParaInfo),
+		holdSlice:      make(map[uint64][]UnsealedCidInfo),
+		conProofC:      make(map[uint64][]FpostParaInfo),
+		subs:           make(map[uint64][]chan MinerEvent),
+		failures:       make(map[string][]error),
+		exits:          make(map[uint64]uint64),
+		MissingCalls:   make(map[string]bool),
+		ExitLockBlocks: 100,
+		BlockTime:      time.Second * 6,
+	}
+}
+
+// Make the next call of a transaction or storage item fail with err,
+// e.g. Fail(configs.ChainTx_SegmentBook_SubmitToVpa, &TxError{...})
+func (f *FakeChain) Fail(name string, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failures[name] = append(f.failures[name], err)
+}
+
+// Assign a file slice to a miner the way the scheduler does. The slice is
+// reported by the MinerHoldSlice storage until its Vpc is verified.
+func (f *FakeChain) AddFileSlice(peerid uint64, hash, shardhash string, uncid [][]byte) uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.lastSeg++
+	info := UnsealedCidInfo{
+		PeerId:    types.NewU64(peerid),
+		SegmentId: types.NewU64(f.lastSeg),
+		Uncid:     make([]types.Bytes, len(uncid)),
+		Rand:      types.NewU32(f.random()),
+		Hash:      types.NewBytes([]byte(hash)),
+		Shardhash: types.NewBytes([]byte(shardhash)),
+	}
+	for i := 0; i < len(uncid); i++ {
+		info.Uncid[i] = types.NewBytes(uncid[i])
+	}
+	f.holdSlice[peerid] = append(f.holdSlice[peerid], info)
+	f.emit(MinerEvent{Kind: Event_HoldSlice, PeerId: peerid})
+	return f.lastSeg
+}
+
+// Run the periodic task of the Sminer pallet, which opens a new
+// challenge window for all miners
+func (f *FakeChain) TimedTask() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for peerid := range f.subs {
+		f.emit(MinerEvent{Kind: Event_TimedTask, PeerId: peerid, Number: f.height})
+	}
+}
+
+// Produce n empty blocks, the subscribers see the last head
+func (f *FakeChain) Advance(n uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.height += n
+	publishHead(f.heads, ChainHead{Number: f.height, Time: time.Now()})
+}
+
+func (f *FakeChain) GetExitBlockOnChain(identifyAccountPhrase string) (uint64, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainModule_Sminer_MinerColling); err != nil {
+		return 0, false, err
+	}
+	block, ok := f.exits[f.peerid(identifyAccountPhrase)]
+	return block, ok, nil
+}
+
+func (f *FakeChain) GetExitLockBlocks() (uint64, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.ExitLockBlocks, f.ExitLockBlocks > 0, nil
+}
+
+func (f *FakeChain) GetBlockTime() (time.Duration, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.BlockTime, f.BlockTime > 0, nil
+}
+
+func (f *FakeChain) GetBlockHeight() (uint64, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.height, nil
+}
+
+func (f *FakeChain) HasCall(callName string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return !f.MissingCalls[callName], nil
+}
+
+func (f *FakeChain) GetMinerDataOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) (CessChain_MinerItems, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(chainModuleMethod); err != nil {
+		return CessChain_MinerItems{}, err
+	}
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return CessChain_MinerItems{}, nil
+	}
+	return *m, nil
+}
+
+func (f *FakeChain) GetSeedNumOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) (ParamInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(chainModuleMethod); err != nil {
+		return ParamInfo{}, err
+	}
+	peerid := f.peerid(identifyAccountPhrase)
+	var latest ParamInfo
+	for _, v := range f.challenges {
+		if uint64(v.PeerId) == peerid && v.SegmentId > latest.SegmentId {
+			latest = v
+		}
+	}
+	if latest.SegmentId == 0 {
+		return latest, errors.New("paramdata data is empty")
+	}
+	return latest, nil
+}
+
+func (f *FakeChain) GetVpaPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]IpostParaInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(chainModuleMethod); err != nil {
+		return nil, err
+	}
+	return append([]IpostParaInfo(nil), f.conProofA[f.peerid(identifyAccountPhrase)]...), nil
+}
+
+func (f *FakeChain) GetunsealcidOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]UnsealedCidInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(chainModuleMethod); err != nil {
+		return nil, err
+	}
+	return append([]UnsealedCidInfo(nil), f.holdSlice[f.peerid(identifyAccountPhrase)]...), nil
+}
+
+func (f *FakeChain) GetVpcPostOnChain(identifyAccountPhrase, chainModule, chainModuleMethod string) ([]FpostParaInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(chainModuleMethod); err != nil {
+		return nil, err
+	}
+	return append([]FpostParaInfo(nil), f.conProofC[f.peerid(identifyAccountPhrase)]...), nil
+}
+
+func (f *FakeChain) RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr string, pledgeTokens uint64, port, fileport uint32) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainTx_Sminer_Register); err != nil {
+		return false, err
+	}
+	if _, ok := f.miners[identifyAccountPhrase]; ok {
+		return false, moduleError(configs.ChainModule_Sminer, "AlreadyRegistered")
+	}
+	ipint, err := tools.InetAtoN(ipAddr)
+	if err != nil {
+		return false, errors.Wrap(err, "InetAtoN err")
+	}
+	income, err := types.HexDecodeString(incomeAccountPublicKey)
+	if err != nil {
+		return false, errors.Wrap(err, "HexDecodeString err")
+	}
+	collaterals, ok := new(big.Int).SetString(strconv.FormatUint(pledgeTokens, 10)+configs.TokenAccuracy, 10)
+	if !ok {
+		return false, errors.New("SetString err")
+	}
+	f.lastPid++
+	f.miners[identifyAccountPhrase] = &CessChain_MinerItems{
+		Peerid:      types.NewU64(f.lastPid),
+		Beneficiary: types.NewAccountID(income),
+		Ip:          types.NewU32(uint32(ipint)),
+		Collaterals: types.NewU128(*collaterals),
+		Earnings:    types.NewU128(*big.NewInt(0)),
+		Locked:      types.NewU128(*big.NewInt(0)),
+	}
+	return true, nil
+}
+
+func (f *FakeChain) IntentSubmitToChain(identifyAccountPhrase, TransactionName string, segsizetype, segtype uint8, peerid uint64, unsealedcid [][]byte, hash, shardhash []byte) (uint64, uint32, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(TransactionName); err != nil {
+		return 0, 0, err
+	}
+	if err := f.checkMiner(peerid); err != nil {
+		return 0, 0, err
+	}
+	f.lastSeg++
+	f.sizeTypes[f.lastSeg] = segsizetype
+	return f.lastSeg, f.challenge(peerid, f.lastSeg), nil
+}
+
+func (f *FakeChain) IntentSubmitPostToChain(identifyAccountPhrase, TransactionName string, segmentid uint64, segsizetype, segtype uint8) (uint32, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(TransactionName); err != nil {
+		return 0, err
+	}
+	peerid := f.peerid(identifyAccountPhrase)
+	if !f.hasSegment(peerid, segmentid) {
+		return 0, moduleError(configs.ChainModule_SegmentBook, "NotExistInVPA")
+	}
+	return f.challenge(peerid, segmentid), nil
+}
+
+func (f *FakeChain) SegmentSubmitToVpaOrVpb(identifyAccountPhrase, TransactionName string, peerid, segmentid uint64, proofs, cid []byte) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(TransactionName); err != nil {
+		return false, err
+	}
+	kind := Proof_Vpa
+	if TransactionName == configs.ChainTx_SegmentBook_SubmitToVpb {
+		kind = Proof_Vpb
+	}
+	if err := f.answer(peerid, segmentid); err != nil {
+		return false, err
+	}
+	f.emit(MinerEvent{Kind: kind, PeerId: peerid, SegmentId: segmentid})
+	if !f.verify(kind, peerid, segmentid, proofs) {
+		return true, nil
+	}
+	if kind == Proof_Vpa {
+		f.conProofA[peerid] = append(f.conProofA[peerid], IpostParaInfo{
+			PeerId:    types.NewU64(peerid),
+			SegmentId: types.NewU64(segmentid),
+			SealedCid: types.NewBytes(cid),
+			SizeType:  sizeOf(f.sizeTypes[segmentid]),
+		})
+	}
+	f.emit(MinerEvent{Kind: kind, Verified: true, PeerId: peerid, SegmentId: segmentid})
+	return true, nil
+}
+
+func (f *FakeChain) SegmentSubmitToVpc(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainTx_SegmentBook_SubmitToVpc); err != nil {
+		return false, err
+	}
+	slices := f.holdSlice[peerid]
+	idx := -1
+	for i := 0; i < len(slices); i++ {
+		if uint64(slices[i].SegmentId) == segmentid {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return false, moduleError(configs.ChainModule_SegmentBook, "NotExistInVPC")
+	}
+	f.emit(MinerEvent{Kind: Proof_Vpc, PeerId: peerid, SegmentId: segmentid})
+	var proof []byte
+	for i := 0; i < len(proofs); i++ {
+		proof = append(proof, proofs[i]...)
+	}
+	if !f.verify(Proof_Vpc, peerid, segmentid, proof) {
+		return true, nil
+	}
+	f.holdSlice[peerid] = append(slices[:idx:idx], slices[idx+1:]...)
+	f.conProofC[peerid] = append(f.conProofC[peerid], FpostParaInfo{
+		PeerId:    types.NewU64(peerid),
+		SegmentId: types.NewU64(segmentid),
+		SealedCid: sealcid,
+		Hash:      slices[idx].Hash,
+		SizeType:  sizeOf(configs.SegMentType_8M),
+	})
+	f.emit(MinerEvent{Kind: Proof_Vpc, Verified: true, PeerId: peerid, SegmentId: segmentid})
+	return true, nil
+}
+
+func (f *FakeChain) SegmentSubmitToVpd(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainTx_SegmentBook_SubmitToVpd); err != nil {
+		return false, err
+	}
+	if err := f.answer(peerid, segmentid); err != nil {
+		return false, err
+	}
+	f.emit(MinerEvent{Kind: Proof_Vpd, PeerId: peerid, SegmentId: segmentid})
+	var proof []byte
+	for i := 0; i < len(proofs); i++ {
+		proof = append(proof, proofs[i]...)
+	}
+	if f.verify(Proof_Vpd, peerid, segmentid, proof) {
+		f.emit(MinerEvent{Kind: Proof_Vpd, Verified: true, PeerId: peerid, SegmentId: segmentid})
+	}
+	return true, nil
+}
+
+func (f *FakeChain) UpdateAddress(identifyAccountPhrase, ipAddr string, port, fileport uint32) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainTx_Sminer_UpdateAddress); err != nil {
+		return false, err
+	}
+	if f.MissingCalls[configs.ChainTx_Sminer_UpdateAddress] {
+		return false, errors.Errorf("NewCall err [%v]", configs.ChainTx_Sminer_UpdateAddress)
+	}
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return false, moduleError(configs.ChainModule_Sminer, "NotMiner")
+	}
+	ipint, err := tools.InetAtoN(ipAddr)
+	if err != nil {
+		return false, errors.Wrap(err, "InetAtoN err")
+	}
+	m.Ip = types.NewU32(uint32(ipint))
+	return true, nil
+}
+
+// Take a penalty from the collateral of a miner
+func (f *FakeChain) Slash(identifyAccountPhrase string, amount *big.Int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return
+	}
+	v := new(big.Int).Sub(u128Int(m.Collaterals), amount)
+	if v.Sign() < 0 {
+		v.SetInt64(0)
+	}
+	m.Collaterals = types.NewU128(*v)
+}
+
+func (f *FakeChain) RenewalTokens(identifyAccountPhrase string, tokens *big.Int) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainTx_Sminer_IncreaseCollateral); err != nil {
+		return false, err
+	}
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return false, moduleError(configs.ChainModule_Sminer, "NotMiner")
+	}
+	m.Collaterals = types.NewU128(*new(big.Int).Add(u128Int(m.Collaterals), tokens))
+	return true, nil
+}
+
+// Pay a reward to a miner, the locked part is released by Release
+func (f *FakeChain) Reward(identifyAccountPhrase string, amount, locked *big.Int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return
+	}
+	m.Earnings = types.NewU128(*new(big.Int).Add(u128Int(m.Earnings), amount))
+	m.Locked = types.NewU128(*new(big.Int).Add(u128Int(m.Locked), locked))
+}
+
+// Release locked earnings of a miner
+func (f *FakeChain) Release(identifyAccountPhrase string, amount *big.Int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return
+	}
+	v := new(big.Int).Sub(u128Int(m.Locked), amount)
+	if v.Sign() < 0 {
+		v.SetInt64(0)
+	}
+	m.Locked = types.NewU128(*v)
+}
+
+func (f *FakeChain) WithdrawEarnings(identifyAccountPhrase string) (TxReceipt, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var receipt TxReceipt
+	if err := f.failure(configs.ChainTx_Sminer_WithdrawEarnings); err != nil {
+		return receipt, err
+	}
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return receipt, moduleError(configs.ChainModule_Sminer, "NotMiner")
+	}
+	locked := u128Int(m.Locked)
+	if withdrawable(u128Int(m.Earnings), locked).Sign() == 0 {
+		return receipt, moduleError(configs.ChainModule_Sminer, "NoReward")
+	}
+	amount := withdrawable(u128Int(m.Earnings), locked)
+	m.Earnings = types.NewU128(*locked)
+	f.height++
+	receipt.ExtrinsicHash = f.hash()
+	receipt.BlockHash = f.hash()
+	receipt.Events.Balances_Transfer = append(receipt.Events.Balances_Transfer, types.EventBalancesTransfer{
+		Phase: types.Phase{IsApplyExtrinsic: true, AsApplyExtrinsic: uint32(receipt.Index)},
+		To:    m.Beneficiary,
+		Value: types.NewU128(*amount),
+	})
+	receipt.Result.IsSuccess = true
+	return receipt, nil
+}
+
+func (f *FakeChain) ExitMining(identifyAccountPhrase string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainTx_Sminer_ExitMining); err != nil {
+		return false, err
+	}
+	peerid := f.peerid(identifyAccountPhrase)
+	if peerid == 0 {
+		return false, moduleError(configs.ChainModule_Sminer, "NotMiner")
+	}
+	if _, ok := f.exits[peerid]; ok {
+		return false, moduleError(configs.ChainModule_Sminer, "AlreadyExit")
+	}
+	f.exits[peerid] = f.height
+	return true, nil
+}
+
+func (f *FakeChain) Withdraw(identifyAccountPhrase string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.failure(configs.ChainTx_Sminer_Withdraw); err != nil {
+		return false, err
+	}
+	f.Withdrawals++
+	peerid := f.peerid(identifyAccountPhrase)
+	if err := f.checkWithdraw(peerid); err != nil {
+		return false, err
+	}
+	delete(f.exits, peerid)
+	delete(f.miners, identifyAccountPhrase)
+	delete(f.conProofA, peerid)
+	delete(f.holdSlice, peerid)
+	delete(f.conProofC, peerid)
+	return true, nil
+}
+
+func (f *FakeChain) CheckWithdraw(identifyAccountPhrase string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.NoDryRun {
+		return false, nil
+	}
+	return true, f.checkWithdraw(f.peerid(identifyAccountPhrase))
+}
+
+func (f *FakeChain) checkWithdraw(peerid uint64) error {
+	exitBlock, ok := f.exits[peerid]
+	if !ok {
+		return moduleError(configs.ChainModule_Sminer, "NotExisted")
+	}
+	if f.height < exitBlock+f.ExitLockBlocks {
+		return moduleError(configs.ChainModule_Sminer, "LockInNotOver")
+	}
+	return nil
+}
+
+func (f *FakeChain) SubscribeMinerEvents(identifyAccountPhrase string, peerid uint64) (<-chan MinerEvent, func(), error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ch := make(chan MinerEvent, 256)
+	f.subs[peerid] = append(f.subs[peerid], ch)
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.lock.Lock()
+			defer f.lock.Unlock()
+			subs := f.subs[peerid]
+			for i := 0; i < len(subs); i++ {
+				if subs[i] == ch {
+					f.subs[peerid] = append(subs[:i:i], subs[i+1:]...)
+					break
+				}
+			}
+			close(ch)
+		})
+	}, nil
+}
+
+func (f *FakeChain) SubscribeHeads() (<-chan ChainHead, func(), error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ch := make(chan ChainHead, 1)
+	f.heads = append(f.heads, ch)
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.lock.Lock()
+			defer f.lock.Unlock()
+			for i := 0; i < len(f.heads); i++ {
+				if f.heads[i] == ch {
+					f.heads = append(f.heads[:i:i], f.heads[i+1:]...)
+					break
+				}
+			}
+			close(ch)
+		})
+	}, nil
+}
+
+// The remaining methods expect f.lock to be held
+
+func (f *FakeChain) failure(name string) error {
+	errs := f.failures[name]
+	if len(errs) == 0 {
+		return nil
+	}
+	f.failures[name] = errs[1:]
+	return errs[0]
+}
+
+func (f *FakeChain) peerid(identifyAccountPhrase string) uint64 {
+	m, ok := f.miners[identifyAccountPhrase]
+	if !ok {
+		return 0
+	}
+	return uint64(m.Peerid)
+}
+
+func (f *FakeChain) checkMiner(peerid uint64) error {
+	for _, v := range f.miners {
+		if uint64(v.Peerid) == peerid {
+			return nil
+		}
+	}
+	return moduleError(configs.ChainModule_Sminer, "NotMiner")
+}
+
+func (f *FakeChain) hasSegment(peerid, segmentid uint64) bool {
+	for _, v := range f.conProofA[peerid] {
+		if uint64(v.SegmentId) == segmentid {
+			return true
+		}
+	}
+	for _, v := range f.conProofC[peerid] {
+		if uint64(v.SegmentId) == segmentid {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FakeChain) hash() types.Hash {
+	var h types.Hash
+	f.rnd.Read(h[:])
+	return h
+}
+
+func (f *FakeChain) random() uint32 {
+	for {
+		n := f.rnd.Uint32()
+		if n != 0 {
+			return n
+		}
+	}
+}
+
+// Issue a new challenge for the segment
+func (f *FakeChain) challenge(peerid, segmentid uint64) uint32 {
+	n := f.random()
+	f.challenges[segmentid] = ParamInfo{
+		PeerId:    types.NewU64(peerid),
+		SegmentId: types.NewU64(segmentid),
+		Rand:      types.NewU32(n),
+	}
+	f.emit(MinerEvent{Kind: Event_ParamSet, PeerId: peerid, SegmentId: segmentid, Random: n})
+	return n
+}
+
+// Consume the challenge the proof answers
+func (f *FakeChain) answer(peerid, segmentid uint64) error {
+	c, ok := f.challenges[segmentid]
+	if !ok || uint64(c.PeerId) != peerid {
+		return moduleError(configs.ChainModule_SegmentBook, "NoIntentSubmitYet")
+	}
+	delete(f.challenges, segmentid)
+	return nil
+}
+
+func (f *FakeChain) verify(kind string, peerid, segmentid uint64, proof []byte) bool {
+	if f.Verify == nil {
+		return true
+	}
+	return f.Verify(kind, peerid, segmentid, proof)
+}
+
+// Events are dropped for subscribers that do not keep up, like a node
+// does for a slow websocket client
+func (f *FakeChain) emit(ev MinerEvent) {
+	for _, ch := range f.subs[ev.PeerId] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// SizeType of a segment, in MB
+func sizeOf(segsizetype uint8) types.U128 {
+	if segsizetype == configs.SegMentType_512M {
+		return types.NewU128(*big.NewInt(512))
+	}
+	return types.NewU128(*big.NewInt(8))
+}
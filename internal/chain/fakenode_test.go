@@ -0,0 +1,290 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"storage-mining/internal/logger"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"go.uber.org/zap"
+)
+
+// The node of a FakeChain for the code that talks to the rpc directly:
+// blocks with their extrinsics, the transaction pool and the account
+// nonce, served over http. Every block moves the FakeChain on by one.
+type fakeNode struct {
+	lock  sync.Mutex
+	chain *FakeChain
+	meta  string
+	// canonical block hashes by number, and every block seen by hash
+	canonical []types.Hash
+	blocks    map[types.Hash]fakeBlock
+	finalized uint64
+	pending   []types.Extrinsic
+	// next nonce of the identity account, system_accountNextIndex fails
+	// while it is negative
+	nonce int64
+	forks int
+	// the connection and decoded metadata of startNode
+	api      *gsrpc.SubstrateAPI
+	metadata *types.Metadata
+}
+
+type fakeBlock struct {
+	header types.Header
+	exts   []types.Extrinsic
+}
+
+// Start a node with the genesis block and connect to it
+func newFakeNode(t *testing.T, chain *FakeChain) (*fakeNode, *gsrpc.SubstrateAPI) {
+	n := &fakeNode{chain: chain, meta: nodeMetadata(t), blocks: make(map[types.Hash]fakeBlock)}
+	n.addBlock(nil)
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	api, err := gsrpc.NewSubstrateAPI(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n, api
+}
+
+// A node on a new FakeChain and its decoded metadata, with the logs
+// discarded
+func startNode(t *testing.T) (*fakeNode, *gsrpc.SubstrateAPI, *types.Metadata) {
+	quietLogs()
+	n, api := newFakeNode(t, NewFakeChain(1))
+	n.api, n.metadata = api, new(types.Metadata)
+	err := types.DecodeFromHexString(n.meta, n.metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n, api, n.metadata
+}
+
+func quietLogs() {
+	logger.InfoLogger = zap.NewNop()
+	logger.ErrLogger = zap.NewNop()
+}
+
+// The cess metadata with the System storage the submission reads
+func nodeMetadata(t *testing.T) string {
+	b, err := ioutil.ReadFile("cess/metadata.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta types.Metadata
+	err = types.DecodeFromHexString(strings.TrimSpace(string(b)), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &meta.AsMetadataV14
+	u8 := types.NewSi1LookupTypeIDFromUInt(uint64(len(m.Lookup.Types)))
+	bytes := types.NewSi1LookupTypeIDFromUInt(uint64(len(m.Lookup.Types) + 1))
+	m.Lookup.Types = append(m.Lookup.Types,
+		types.PortableTypeV14{ID: u8, Type: types.Si1Type{Def: types.Si1TypeDef{
+			IsPrimitive: true,
+			Primitive:   types.Si1TypeDefPrimitive{Si0TypeDefPrimitive: types.IsU8},
+		}}},
+		types.PortableTypeV14{ID: bytes, Type: types.Si1Type{Def: types.Si1TypeDef{
+			IsSequence: true,
+			Sequence:   types.Si1TypeDefSequence{Type: u8},
+		}}},
+	)
+	m.Pallets = append(m.Pallets, types.PalletMetadataV14{
+		Name:       "System",
+		HasStorage: true,
+		Storage: types.StorageMetadataV14{Prefix: "System", Items: []types.StorageEntryMetadataV14{{
+			Name:     "Events",
+			Modifier: types.StorageFunctionModifierV0{IsDefault: true},
+			Type:     types.StorageEntryTypeV14{IsPlainType: true, AsPlainType: bytes},
+		}}},
+		Index: 0,
+	})
+	s, err := types.EncodeToHexString(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Add a block on top of the canonical chain, n.lock is held
+func (n *fakeNode) addBlock(exts []types.Extrinsic) types.Hash {
+	header := types.Header{Number: types.BlockNumber(len(n.canonical))}
+	if len(n.canonical) > 0 {
+		header.ParentHash = n.canonical[len(n.canonical)-1]
+	}
+	// blocks of a fork differ in their state root
+	header.StateRoot = types.NewHash([]byte(fmt.Sprintf("%032d", n.forks)))
+	h, err := types.GetHash(header)
+	if err != nil {
+		panic(err)
+	}
+	n.blocks[h] = fakeBlock{header: header, exts: exts}
+	n.canonical = append(n.canonical, h)
+	if len(n.canonical) > 1 {
+		n.chain.Advance(1)
+	}
+	return h
+}
+
+// Produce a block with the extrinsics, taken out of the pool
+func (n *fakeNode) produce(exts ...types.Extrinsic) types.Hash {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for _, e := range exts {
+		h, _ := extrinsicHash(e)
+		for i := 0; i < len(n.pending); i++ {
+			if p, _ := extrinsicHash(n.pending[i]); p == h {
+				n.pending = append(n.pending[:i], n.pending[i+1:]...)
+				break
+			}
+		}
+	}
+	return n.addBlock(exts)
+}
+
+// Produce empty blocks
+func (n *fakeNode) advance(count int) {
+	for i := 0; i < count; i++ {
+		n.produce()
+	}
+}
+
+// Replace the blocks from number on with empty blocks of another fork
+func (n *fakeNode) reorg(number uint64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	count := len(n.canonical) - int(number)
+	n.canonical = n.canonical[:number]
+	n.forks++
+	for i := 0; i < count; i++ {
+		header := types.Header{Number: types.BlockNumber(len(n.canonical)), ParentHash: n.canonical[len(n.canonical)-1]}
+		header.StateRoot = types.NewHash([]byte(fmt.Sprintf("%032d", n.forks)))
+		h, _ := types.GetHash(header)
+		n.blocks[h] = fakeBlock{header: header}
+		n.canonical = append(n.canonical, h)
+	}
+}
+
+func (n *fakeNode) submit(ext types.Extrinsic) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.pending = append(n.pending, ext)
+}
+
+func (n *fakeNode) setNonce(nonce int64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.nonce = nonce
+}
+
+func (n *fakeNode) best() types.Hash {
+	return n.canonical[len(n.canonical)-1]
+}
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	n.lock.Lock()
+	result, err := n.call(req.Method, req.Params)
+	n.lock.Unlock()
+	if err != nil {
+		res["error"] = rpcError{Code: 1010, Message: err.Error()}
+	} else {
+		res["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Answer a request, n.lock is held
+func (n *fakeNode) call(method string, params []json.RawMessage) (interface{}, error) {
+	var hash types.Hash
+	if len(params) > 0 && method != "chain_getBlockHash" && method != "system_accountNextIndex" {
+		var s string
+		json.Unmarshal(params[len(params)-1], &s)
+		hash, _ = types.NewHashFromHexString(s)
+	}
+	if hash == (types.Hash{}) {
+		hash = n.best()
+	}
+	switch method {
+	case "state_getMetadata":
+		return n.meta, nil
+	case "chain_getBlockHash":
+		if len(params) == 0 {
+			return n.best().Hex(), nil
+		}
+		var number uint64
+		json.Unmarshal(params[0], &number)
+		if number >= uint64(len(n.canonical)) {
+			return nil, nil
+		}
+		return n.canonical[number].Hex(), nil
+	case "chain_getFinalizedHead":
+		return n.canonical[n.finalized].Hex(), nil
+	case "chain_getHeader":
+		b, ok := n.blocks[hash]
+		if !ok {
+			return nil, nil
+		}
+		return b.header, nil
+	case "chain_getBlock":
+		b, ok := n.blocks[hash]
+		if !ok {
+			return nil, nil
+		}
+		exts := b.exts
+		if exts == nil {
+			exts = []types.Extrinsic{}
+		}
+		return map[string]interface{}{"block": map[string]interface{}{"header": b.header, "extrinsics": exts}}, nil
+	case "author_pendingExtrinsics":
+		if n.pending == nil {
+			return []types.Extrinsic{}, nil
+		}
+		return n.pending, nil
+	case "system_accountNextIndex":
+		if n.nonce < 0 {
+			return nil, fmt.Errorf("Method not found")
+		}
+		return n.nonce, nil
+	case "state_getStorage":
+		// no events
+		return "0x00", nil
+	}
+	return nil, fmt.Errorf("Method not found: %v", method)
+}
+
+// An unsigned extrinsic the node tells apart by its nonce argument
+func testExtrinsic(t *testing.T, nonce uint32) types.Extrinsic {
+	b, err := types.EncodeToBytes(types.NewU32(nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.NewExtrinsic(types.Call{CallIndex: types.CallIndex{SectionIndex: 10, MethodIndex: 2}, Args: b})
+}
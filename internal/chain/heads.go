@@ -0,0 +1,150 @@
+package chain
+
+import (
+	"storage-mining/configs"
+	"storage-mining/internal/logger"
+	"sync"
+	"time"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/pkg/errors"
+)
+
+// Delay before subscribing to new heads again after a failure
+const headWatchRetry = time.Second * 5
+
+// A new best block of the chain
+type ChainHead struct {
+	Number uint64
+	// local time the header was received
+	Time time.Time
+}
+
+var (
+	headLock sync.Mutex
+	head     ChainHead
+	headSubs []chan ChainHead
+)
+
+// Latest head seen by the tracker. ok is false before the first head and
+// while the chain is stalled.
+func LatestHead() (ChainHead, bool) {
+	headLock.Lock()
+	defer headLock.Unlock()
+	if head.Number == 0 || time.Since(head.Time) > time.Second*configs.TimeToStallHead_S {
+		return head, false
+	}
+	return head, true
+}
+
+// Receive the new heads. A slow reader only misses intermediate heads,
+// it always gets the latest one.
+func SubscribeHeads() (<-chan ChainHead, func()) {
+	ch := make(chan ChainHead, 1)
+	headLock.Lock()
+	headSubs = append(headSubs, ch)
+	headLock.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			headLock.Lock()
+			defer headLock.Unlock()
+			for i := 0; i < len(headSubs); i++ {
+				if headSubs[i] == ch {
+					headSubs = append(headSubs[:i:i], headSubs[i+1:]...)
+					break
+				}
+			}
+			close(ch)
+		})
+	}
+}
+
+// Hand the head to the subscribers, replacing one they have not read yet
+func publishHead(subs []chan ChainHead, h ChainHead) {
+	for _, ch := range subs {
+		select {
+		case ch <- h:
+			continue
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- h:
+		default:
+		}
+	}
+}
+
+func setHead(number uint64) {
+	headLock.Lock()
+	defer headLock.Unlock()
+	// a shorter fork or a node behind after a failover, keep waiting
+	// for the chain to reach the known height again
+	if number <= head.Number && time.Since(head.Time) < time.Second*configs.TimeToStallHead_S {
+		return
+	}
+	head = ChainHead{Number: number, Time: time.Now()}
+	publishHead(headSubs, head)
+}
+
+// Follow the new heads of the node in use. The subscription is renewed
+// after an error, a failover or when no head arrives for
+// TimeToStallHead_S.
+func trackHeads() {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	for {
+		err := followHeads()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+		}
+		time.Sleep(headWatchRetry)
+	}
+}
+
+func followHeads() error {
+	api := getSubstrateAPI()
+	sub, err := api.RPC.Chain.SubscribeNewHeads()
+	releaseSubstrateAPI()
+	if err != nil {
+		return errors.Wrap(err, "SubscribeNewHeads err")
+	}
+	defer sub.Unsubscribe()
+	stall := time.NewTimer(time.Second * configs.TimeToStallHead_S)
+	defer stall.Stop()
+	for {
+		select {
+		case h := <-sub.Chan():
+			stall.Reset(time.Second * configs.TimeToStallHead_S)
+			if !apiInUse(api) {
+				return errors.New("rpc endpoint switched, subscribe to new heads again")
+			}
+			// the heads of a syncing node are old blocks, the state is
+			// the one of the last endpoint probe
+			if nodeSyncing() {
+				logger.InfoLogger.Sugar().Infof("node syncing at block %v, proofs wait", h.Number)
+				continue
+			}
+			setHead(uint64(h.Number))
+		case err = <-sub.Err():
+			return errors.Wrap(err, "NewHeads subscription err")
+		case <-stall.C:
+			return errors.Errorf("no new head for %v s", configs.TimeToStallHead_S)
+		}
+	}
+}
+
+// Whether api is still the connection in use
+func apiInUse(api *gsrpc.SubstrateAPI) bool {
+	wlock.Lock()
+	defer wlock.Unlock()
+	return api == r
+}
@@ -0,0 +1,474 @@
+package chain
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/hash"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Status of a transaction in the journal
+const (
+	// refused before reaching the transaction pool
+	Journal_Rejected  = "rejected"
+	Journal_Submitted = "submitted"
+	Journal_Resumed   = "resumed"
+	Journal_InBlock   = "inblock"
+	Journal_Retracted = "retracted"
+	Journal_Finalized = "finalized"
+	// the receipt was collected, the dispatch succeeded
+	Journal_Confirmed = "confirmed"
+	Journal_Failed    = "failed"
+)
+
+// Time format of the journal
+const journalTime = "2006-01-02 15:04:05"
+
+// An entry of the transaction journal. The entries of one transaction
+// share its hash, the last one holds its current status.
+type JournalEntry struct {
+	Time    string `json:"time"`
+	Call    string `json:"call"`
+	Segment uint64 `json:"segment,omitempty"`
+	// blake2b-256 of the encoded call
+	Args  string `json:"args,omitempty"`
+	Nonce uint64 `json:"nonce"`
+	Hash  string `json:"hash,omitempty"`
+	// first block the extrinsic is no longer valid at, 0 if immortal
+	Expires uint64   `json:"expires,omitempty"`
+	Status  string   `json:"status"`
+	Block   string   `json:"block,omitempty"`
+	Events  []string `json:"events,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// the signed extrinsic, to resume the submission after a restart
+	Extrinsic string `json:"extrinsic,omitempty"`
+}
+
+// Position of the segment id in the arguments of the calls having one
+var segmentArg = map[string]int{
+	configs.ChainTx_SegmentBook_IntentSubmitPost: 0,
+	configs.ChainTx_SegmentBook_SubmitToVpa:      1,
+	configs.ChainTx_SegmentBook_SubmitToVpb:      1,
+	configs.ChainTx_SegmentBook_SubmitToVpc:      1,
+	configs.ChainTx_SegmentBook_SubmitToVpd:      1,
+}
+
+var journalLock sync.Mutex
+
+func journalPath() string {
+	return filepath.Join(configs.LogfilePathPrefix, configs.JournalFile)
+}
+
+// Append an entry to the journal. The journal is never rewritten.
+func appendJournal(e JournalEntry) {
+	e.Time = time.Now().Format(journalTime)
+	b, err := json.Marshal(e)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("journal: %v", err)
+		return
+	}
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	f, err := os.OpenFile(journalPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("journal: %v", err)
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("journal: %v", err)
+	}
+}
+
+// Journal of one transaction
+type journalTx struct {
+	e JournalEntry
+}
+
+// Record a transaction refused before it reached the pool
+func journalRejected(callName string, args []interface{}, err error) {
+	appendJournal(JournalEntry{Call: callName, Segment: segmentOf(callName, args), Status: Journal_Rejected, Error: err.Error()})
+}
+
+// Record a transaction put into the pool
+func journalSubmitted(callName string, args []interface{}, ext types.Extrinsic) *journalTx {
+	j := newJournalTx(callName, args, ext)
+	e := j.e
+	e.Status = Journal_Submitted
+	e.Extrinsic, _ = types.EncodeToHexString(ext)
+	appendJournal(e)
+	return j
+}
+
+// Journal of a signed extrinsic, nothing is recorded yet
+func newJournalTx(callName string, args []interface{}, ext types.Extrinsic) *journalTx {
+	j := &journalTx{e: JournalEntry{Call: callName, Segment: segmentOf(callName, args)}}
+	j.e.Nonce = uint64(ext.Signature.Nonce.Int64())
+	j.e.Expires = eraExpiry(ext.Signature.Era, atomic.LoadUint64(&eraBase))
+	if h, err := extrinsicHash(ext); err == nil {
+		j.e.Hash = h.Hex()
+	}
+	if b, err := types.EncodeToBytes(ext.Method); err == nil {
+		if h, err := hash.NewBlake2b256(nil); err == nil {
+			h.Write(b)
+			j.e.Args = types.HexEncodeToString(h.Sum(nil))
+		}
+	}
+	return j
+}
+
+// Record a status change, with the block it refers to
+func (j *journalTx) update(status string, block types.Hash) {
+	if j == nil {
+		return
+	}
+	e := j.e
+	e.Status = status
+	if block != (types.Hash{}) {
+		e.Block = block.Hex()
+	}
+	appendJournal(e)
+}
+
+// Record the outcome of the transaction
+func (j *journalTx) finish(receipt *TxReceipt, err error) {
+	if j == nil {
+		return
+	}
+	e := j.e
+	e.Status = Journal_Confirmed
+	if err != nil {
+		e.Status = Journal_Failed
+		e.Error = err.Error()
+	}
+	if receipt.BlockHash != (types.Hash{}) {
+		e.Block = receipt.BlockHash.Hex()
+		e.Events = eventNames(&receipt.Events, receipt.Index)
+	}
+	appendJournal(e)
+}
+
+func segmentOf(callName string, args []interface{}) uint64 {
+	i, ok := segmentArg[callName]
+	if !ok || i >= len(args) {
+		return 0
+	}
+	v, _ := args[i].(types.U64)
+	return uint64(v)
+}
+
+// Names of the events emitted by the extrinsic at index idx of the block
+func eventNames(events *MyEventRecords, idx int) []string {
+	var names []string
+	if idx < 0 {
+		return names
+	}
+	v := reflect.ValueOf(events).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.Slice {
+			continue
+		}
+		for k := 0; k < f.Len(); k++ {
+			ph := f.Index(k).FieldByName("Phase")
+			if !ph.IsValid() {
+				break
+			}
+			p, ok := ph.Interface().(types.Phase)
+			if ok && p.IsApplyExtrinsic && int(p.AsApplyExtrinsic) == idx {
+				names = append(names, v.Type().Field(i).Name)
+			}
+		}
+	}
+	return names
+}
+
+// Filter of the journal query. Zero values match everything.
+type JournalFilter struct {
+	Segment uint64
+	Since   time.Time
+	Until   time.Time
+}
+
+func (q JournalFilter) match(e JournalEntry) bool {
+	if q.Segment != 0 && e.Segment != q.Segment {
+		return false
+	}
+	if q.Since.IsZero() && q.Until.IsZero() {
+		return true
+	}
+	t, err := time.ParseInLocation(journalTime, e.Time, time.Local)
+	if err != nil {
+		return false
+	}
+	if !q.Since.IsZero() && t.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && t.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Read the journal entries matching the filter, oldest first
+func QueryJournal(q JournalFilter) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	err := readJournal(func(e JournalEntry) {
+		if q.match(e) {
+			e.Extrinsic = ""
+			entries = append(entries, e)
+		}
+	})
+	return entries, err
+}
+
+func readJournal(fn func(e JournalEntry)) error {
+	f, err := os.Open(journalPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "Open err")
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var e JournalEntry
+		// a line cut short by a crash is skipped
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			fn(e)
+		}
+	}
+	return errors.Wrap(sc.Err(), "read journal err")
+}
+
+// The submitted entries of the transactions without an outcome
+func pendingJournal() ([]JournalEntry, error) {
+	var (
+		order   []string
+		pending = make(map[string]*JournalEntry)
+	)
+	err := readJournal(func(e JournalEntry) {
+		if e.Hash == "" {
+			return
+		}
+		switch e.Status {
+		case Journal_Submitted:
+			if _, ok := pending[e.Hash]; !ok {
+				order = append(order, e.Hash)
+			}
+			s := e
+			pending[e.Hash] = &s
+		case Journal_Confirmed, Journal_Failed:
+			pending[e.Hash] = nil
+		}
+	})
+	var list []JournalEntry
+	for _, h := range order {
+		if pending[h] != nil && pending[h].Extrinsic != "" {
+			list = append(list, *pending[h])
+		}
+	}
+	return list, err
+}
+
+// Take up the transactions the journal left without an outcome, e.g. after
+// a crash. Each one is looked up in the latest blocks, otherwise the same
+// signed extrinsic is submitted again. The watch goes on in the background.
+func resumeJournal() {
+	if configs.DryRun {
+		return
+	}
+	list, err := pendingJournal()
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("journal: %v", err)
+	}
+	if len(list) == 0 {
+		return
+	}
+	logger.InfoLogger.Sugar().Infof("Resume %v pending transactions from the journal", len(list))
+	for _, e := range list {
+		resumeTx(e)
+	}
+	// the resubmitted nonces are in the pool now
+	nonces.resync()
+}
+
+func resumeTx(e JournalEntry) {
+	var (
+		ext     types.Extrinsic
+		receipt TxReceipt
+	)
+	j := &journalTx{e: JournalEntry{Call: e.Call, Segment: e.Segment, Args: e.Args, Nonce: e.Nonce, Hash: e.Hash, Expires: e.Expires}}
+	err := types.DecodeFromHexString(e.Extrinsic, &ext)
+	if err != nil {
+		j.finish(&receipt, errors.Wrap(err, "DecodeFromHexString err"))
+		return
+	}
+	receipt.ExtrinsicHash, err = types.NewHashFromHexString(e.Hash)
+	if err != nil {
+		j.finish(&receipt, errors.Wrap(err, "NewHashFromHexString err"))
+		return
+	}
+	api := getSubstrateAPI()
+	meta, err := getMetadata(api)
+	if err != nil {
+		releaseSubstrateAPI()
+		logger.ErrLogger.Sugar().Errorf("[%v][%v] resume: %v", e.Call, e.Hash, err)
+		return
+	}
+	// the blocks are searched without the lock
+	holdAPI(api)
+	releaseSubstrateAPI()
+	defer dropAPI(api)
+
+	blockHash, found, err := locateExtrinsic(api, receipt.ExtrinsicHash, reconcileDepth)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v][%v] resume: %v", e.Call, e.Hash, err)
+		return
+	}
+	if found {
+		keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
+		if err == nil {
+			err = collectReceipt(api, meta, keye, blockHash, nil, &receipt, e.Call)
+		}
+		logger.InfoLogger.Sugar().Infof("[%v][%v] resume: found in block %v", e.Call, e.Hash, blockHash.Hex())
+		j.finish(&receipt, err)
+		return
+	}
+
+	// a proof is only sent again while it answers an open challenge
+	// and its extrinsic is still valid
+	if _, ok := segmentArg[e.Call]; ok && e.Call != configs.ChainTx_SegmentBook_IntentSubmitPost {
+		landed, open, err := proofState(e)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[%v][%v] resume: %v", e.Call, e.Hash, err)
+			return
+		}
+		if landed {
+			logger.InfoLogger.Sugar().Infof("[%v][%v] resume: the proof of segment %v is in the verification pool", e.Call, e.Hash, e.Segment)
+			j.finish(&receipt, nil)
+			return
+		}
+		if !open {
+			j.finish(&receipt, errors.Errorf("the challenge of segment %v is no longer open", e.Segment))
+			return
+		}
+	}
+	if e.Expires == 0 {
+		j.finish(&receipt, errors.New("not in the latest blocks and signed without a validity window"))
+		return
+	}
+	header, err := api.RPC.Chain.GetHeaderLatest()
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v][%v] resume: %v", e.Call, e.Hash, errors.Wrap(err, "GetHeaderLatest err"))
+		return
+	}
+	if uint64(header.Number) >= e.Expires {
+		j.finish(&receipt, errors.Errorf("not in the latest blocks and expired at block %v", e.Expires))
+		return
+	}
+
+	sub, serr := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
+	if serr == nil {
+		logger.InfoLogger.Sugar().Infof("[%v][%v] resume: submitted again", e.Call, e.Hash)
+		j.update(Journal_Resumed, types.Hash{})
+		holdAPI(api)
+		go func() {
+			defer dropAPI(api)
+			defer func() {
+				err := recover()
+				if err != nil {
+					logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+				}
+			}()
+			defer sub.Unsubscribe()
+			err := watchExtrinsic(api, meta, sub.Chan(), sub.Err(), nil, &receipt, e.Call, j)
+			j.finish(&receipt, err)
+		}()
+		return
+	}
+	pending, err := isPending(api, receipt.ExtrinsicHash)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v][%v] resume: %v", e.Call, e.Hash, err)
+		return
+	}
+	if pending {
+		// already in the pool, it cannot be watched again
+		holdAPI(api)
+		go func() {
+			defer dropAPI(api)
+			awaitInclusion(api, meta, &receipt, e.Call, j)
+		}()
+		return
+	}
+	j.finish(&receipt, errors.Errorf("not in the last %v blocks and refused by the pool: %v", reconcileDepth, serr))
+}
+
+// Verification pool and challenge of the proof calls
+var proofStorage = map[string][2]string{
+	configs.ChainTx_SegmentBook_SubmitToVpa: {configs.ChainModule_SegmentBook_VerPoolA, configs.ChainModule_SegmentBook_ParamSetA},
+	configs.ChainTx_SegmentBook_SubmitToVpb: {configs.ChainModule_SegmentBook_VerPoolB, configs.ChainModule_SegmentBook_ParamSetB},
+	configs.ChainTx_SegmentBook_SubmitToVpc: {configs.ChainModule_SegmentBook_VerPoolC, ""},
+	configs.ChainTx_SegmentBook_SubmitToVpd: {configs.ChainModule_SegmentBook_VerPoolD, configs.ChainModule_SegmentBook_ParamSetD},
+}
+
+// The segment state of a proof left without an outcome. landed is true
+// if it waits in the verification pool, open is false once the challenge
+// it answers went to another segment.
+func proofState(e JournalEntry) (bool, bool, error) {
+	items, ok := proofStorage[e.Call]
+	if !ok {
+		return false, true, nil
+	}
+	landed, err := GetProofSubmittedOnChain(keystore.Secret(), configs.ChainModule_SegmentBook, items[0], e.Segment)
+	if err != nil || landed || items[1] == "" {
+		return landed, true, err
+	}
+	p, err := GetSeedNumOnChain(keystore.Secret(), configs.ChainModule_SegmentBook, items[1])
+	if err != nil {
+		return false, true, err
+	}
+	return false, uint64(p.SegmentId) == e.Segment, nil
+}
+
+// Look for a pooled extrinsic in the new blocks until it is included or
+// TimeToWaitConfirm_S passes
+func awaitInclusion(api *gsrpc.SubstrateAPI, meta *types.Metadata, receipt *TxReceipt, callName string, j *journalTx) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	deadline := time.Now().Add(time.Second * configs.TimeToWaitConfirm_S)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second * 6)
+		blockHash, found, err := locateExtrinsic(api, receipt.ExtrinsicHash, reconcileDepth)
+		if err != nil || !found {
+			continue
+		}
+		keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
+		if err == nil {
+			err = collectReceipt(api, meta, keye, blockHash, nil, receipt, callName)
+		}
+		j.finish(receipt, err)
+		return
+	}
+	// left pending, the next start looks again
+	logger.InfoLogger.Sugar().Infof("[%v][%v] resume: still not included", callName, receipt.ExtrinsicHash.Hex())
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"storage-mining/configs"
+	"storage-mining/internal/keystore"
 	"storage-mining/internal/logger"
 	"strings"
 	"sync"
@@ -24,19 +25,29 @@ func Chain_Init() {
 		ok      bool
 		isfirst bool
 	)
-	r, err = gsrpc.NewSubstrateAPI(configs.Confile.CessChain.RpcAddr)
+	txPolicy, err = parseConfirmPolicy(configs.Confile.CessChain.Confirmation)
 	if err != nil {
 		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
 		logger.ErrLogger.Sugar().Errorf("%v", err)
-		os.Exit(configs.Exit_Normal)
+		os.Exit(configs.Exit_ConfFileFormatError)
 	}
 	wlock = new(sync.Mutex)
+	err = connectEndpoints()
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		os.Exit(configs.Exit_Normal)
+	}
+	logger.InfoLogger.Sugar().Infof("Connected to %v", CurrentEndpoint())
+	checkRuntimeOrExit()
 	// api.c = make(chan bool, 1)
 	// api.c <- true
 	//go waitBlock(api.c)
 	go substrateAPIKeepAlive()
+	go runtimeVersionWatch()
+	go trackHeads()
 	mData, err := GetMinerDataOnChain(
-		configs.Confile.MinerData.IdAccountPhraseOrSeed,
+		keystore.Secret(),
 		configs.ChainModule_Sminer,
 		configs.ChainModule_Sminer_MinerItems,
 	)
@@ -46,25 +57,43 @@ func Chain_Init() {
 		os.Exit(configs.Exit_Normal)
 	}
 
+	if mData.Peerid == 0 && configs.MinerEvent_Exit {
+		fmt.Printf("\x1b[%dm[note]\x1b[0m Unregistered miners cannot use the logout function\n", 43)
+		os.Exit(configs.Exit_Normal)
+	}
+
+	if mData.Peerid == 0 && (configs.MinerEvent_Earnings || configs.MinerEvent_Withdraw) {
+		fmt.Printf("\x1b[%dm[note]\x1b[0m Unregistered miners have no earnings\n", 43)
+		os.Exit(configs.Exit_Normal)
+	}
+
 	if mData.Peerid > 0 {
 		fmt.Printf("\x1b[%dm[ok]\x1b[0m Already registered [C%v]\n", 42, mData.Peerid)
 		logger.InfoLogger.Sugar().Infof("Already registered [C%v]", mData.Peerid)
+		if !configs.MinerEvent_Exit {
+			syncMinerAddress(mData)
+		}
 	} else {
+		if configs.Confile.MinerData.IncomeAccountPubkey == "" {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m Set incomeAccountPubkey in the configuration file to register\n", 41)
+			os.Exit(configs.Exit_RegisterToChain)
+		}
 		logger.InfoLogger.Info("Start registration......")
-		logger.InfoLogger.Sugar().Infof("    RpcAddr:%v", configs.Confile.CessChain.RpcAddr)
+		logger.InfoLogger.Sugar().Infof("    RpcAddr:%v", CurrentEndpoint())
+		logger.InfoLogger.Sugar().Infof("    Confirmation:%v", txPolicy)
 		logger.InfoLogger.Sugar().Infof("    PledgeTokens:%v", configs.Confile.MinerData.PledgeTokens)
 		logger.InfoLogger.Sugar().Infof("    ServiceIpAddress:%v", configs.Confile.MinerData.ServiceIpAddr)
-		logger.InfoLogger.Sugar().Infof("    IdentifyAccountPhraseOrSeed:%v", configs.Confile.MinerData.IdAccountPhraseOrSeed)
+		logger.InfoLogger.Sugar().Infof("    IdentifyAccount:%v", identityAddress())
 		logger.InfoLogger.Sugar().Infof("    IncomeAccountPublicKey:%v", configs.Confile.MinerData.IncomeAccountPubkey)
 		ok, err = RegisterToChain(
-			configs.Confile.MinerData.IdAccountPhraseOrSeed,
+			keystore.Secret(),
 			configs.Confile.MinerData.IncomeAccountPubkey,
 			configs.Confile.MinerData.ServiceIpAddr,
-			configs.ChainTx_Sminer_Register,
 			configs.Confile.MinerData.PledgeTokens,
 			configs.Confile.MinerData.ServicePort,
 			configs.Confile.MinerData.FilePort,
 		)
+		exitDryRun("registration", err)
 		if !ok || err != nil {
 			logger.InfoLogger.Sugar().Infof("Registration failed......,err:%v", err)
 			logger.ErrLogger.Sugar().Errorf("%v", err)
@@ -73,7 +102,7 @@ func Chain_Init() {
 		}
 		isfirst = true
 		mData, err = GetMinerDataOnChain(
-			configs.Confile.MinerData.IdAccountPhraseOrSeed,
+			keystore.Secret(),
 			configs.ChainModule_Sminer,
 			configs.ChainModule_Sminer_MinerItems,
 		)
@@ -136,30 +165,12 @@ func Chain_Init() {
 	fmt.Printf("\x1b[%dm[ok]\x1b[0m Your data is stored in %v\n", 42, path)
 }
 
+// Check the health of the rpc endpoints and fail over when the one in
+// use is lost or falls behind
 func substrateAPIKeepAlive() {
-	var (
-		err     error
-		count_r uint8  = 0
-		peer    uint64 = 0
-	)
-
-	for range time.Tick(time.Second * 25) {
-		if count_r <= 1 {
-			peer, err = healthchek(r)
-			//fmt.Println(peer, err)
-			if err != nil || peer == 0 {
-				count_r++
-			}
-		}
-		if count_r > 1 {
-			count_r = 2
-			r, err = gsrpc.NewSubstrateAPI(configs.Confile.CessChain.RpcAddr)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-			} else {
-				count_r = 0
-			}
-		}
+	for range time.Tick(time.Second * configs.TimeToCheckEndpoints_S) {
+		probeEndpoints()
+		failover()
 	}
 }
 
@@ -170,7 +181,7 @@ func substrateAPIKeepAlive() {
 // 	}
 // }
 
-func healthchek(a *gsrpc.SubstrateAPI) (uint64, error) {
+func healthchek(a *gsrpc.SubstrateAPI) (uint64, bool, error) {
 	defer func() {
 		err := recover()
 		if err != nil {
@@ -178,7 +189,7 @@ func healthchek(a *gsrpc.SubstrateAPI) (uint64, error) {
 		}
 	}()
 	h, err := a.RPC.System.Health()
-	return uint64(h.Peers), err
+	return uint64(h.Peers), bool(h.IsSyncing), err
 }
 
 // func SubstrateAPI_Read() *gsrpc.SubstrateAPI {
@@ -198,22 +209,108 @@ func releaseSubstrateAPI() {
 }
 
 func Chain_Main() {
+	err := LoadExitProgress()
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		os.Exit(configs.Exit_MinerExit)
+	}
+	if configs.MinerEvent_Earnings {
+		info, err := GetEarnings()
+		if err != nil {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+			os.Exit(configs.Exit_GetMinerDataOnChain)
+		}
+		fmt.Printf("Beneficiary:  %v\n", info.Beneficiary)
+		fmt.Printf("Earnings:     %v TCESS\n", info.Earnings)
+		fmt.Printf("Locked:       %v TCESS\n", info.Locked)
+		fmt.Printf("Withdrawable: %v TCESS\n", info.Withdrawable)
+		os.Exit(configs.Exit_Normal)
+	}
+	if configs.MinerEvent_Withdraw {
+		if !callAvailable(configs.ChainTx_Sminer_WithdrawEarnings, "withdrawing the earnings") {
+			os.Exit(configs.Exit_Withdraw)
+		}
+		rec, err := ClaimEarnings()
+		exitDryRun("withdrawal", err)
+		if err != nil {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m Failed to withdraw earnings: %v\n", 41, err)
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			os.Exit(configs.Exit_Withdraw)
+		}
+		fmt.Printf("\x1b[%dm[ok]\x1b[0m Withdrew %v TCESS to %v\n", 42, rec.Amount, rec.Beneficiary)
+		fmt.Printf("     Extrinsic %v in block %v\n", rec.ExtrinsicHash, rec.BlockHash)
+		os.Exit(configs.Exit_Normal)
+	}
+	resumeJournal()
 	if configs.MinerEvent_Exit {
 		if configs.MinerId_I == 0 {
 			fmt.Printf("\x1b[%dm[note]\x1b[0m Unregistered miners cannot use the logout function\n", 43)
 			os.Exit(configs.Exit_Normal)
 		}
-		//TODO:
-		fmt.Printf("\x1b[%dm[note]\x1b[0m The logout function is under development...\n", 43)
-		os.Exit(configs.Exit_Normal)
+		// the collateral of an exited miner is only released by withdraw
+		if !callAvailable(configs.ChainTx_Sminer_ExitMining, "the exit") ||
+			!callAvailable(configs.ChainTx_Sminer_Withdraw, "the exit") {
+			os.Exit(configs.Exit_MinerExit)
+		}
+		err = StartExit()
+		exitDryRun("exit", err)
+		if err != nil {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m Failed to exit the cess mining network: %v\n", 41, err)
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			os.Exit(configs.Exit_MinerExit)
+		}
+	}
+	if Exiting() {
+		p := GetExitProgress()
+		if p.Stage == ExitStage_Requested {
+			// interrupted while submitting, finish the exit first
+			err = StartExit()
+			if err != nil {
+				fmt.Printf("\x1b[%dm[err]\x1b[0m Failed to exit the cess mining network: %v\n", 41, err)
+				logger.ErrLogger.Sugar().Errorf("%v", err)
+				os.Exit(configs.Exit_MinerExit)
+			}
+			p = GetExitProgress()
+		}
+		if p.UnlockBlock > 0 {
+			fmt.Printf("\x1b[%dm[note]\x1b[0m Exiting the cess mining network, the collateral is released at block %v\n", 43, p.UnlockBlock)
+		} else {
+			fmt.Printf("\x1b[%dm[note]\x1b[0m Exiting the cess mining network, the collateral is withdrawn when the lock-in period of the chain is over\n", 43)
+		}
+		logger.InfoLogger.Sugar().Infof("[%v] exiting since block %v, unlock at block %v", configs.MinerId_S, p.ExitBlock, p.UnlockBlock)
+		if callAvailable(configs.ChainTx_Sminer_Withdraw, "withdrawing the collateral") {
+			go exitMonitor()
+		}
 	}
 	if configs.MinerEvent_RenewalTokens {
 		if configs.MinerId_I == 0 {
 			fmt.Printf("\x1b[%dm[note]\x1b[0m Unregistered miners cannot renewal tokens\n", 43)
 			os.Exit(configs.Exit_Normal)
 		}
-		//TODO:
-		fmt.Printf("\x1b[%dm[note]\x1b[0m The renewal function is under development...\n", 43)
+		if Exiting() {
+			fmt.Printf("\x1b[%dm[note]\x1b[0m The miner is exiting, the collateral cannot be renewed\n", 43)
+			os.Exit(configs.Exit_Normal)
+		}
+		if !callAvailable(configs.ChainTx_Sminer_IncreaseCollateral, "the collateral top-up") {
+			os.Exit(configs.Exit_RenewalTokens)
+		}
+		amount, err := RenewCollateral()
+		exitDryRun("collateral top-up", err)
+		if err != nil {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m Failed to renewal tokens: %v\n", 41, err)
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			os.Exit(configs.Exit_RenewalTokens)
+		}
+		if amount.Sign() == 0 {
+			fmt.Printf("\x1b[%dm[ok]\x1b[0m The collateral already reaches %v TCESS\n", 42, collateralTarget())
+		} else {
+			fmt.Printf("\x1b[%dm[ok]\x1b[0m Renewal %v TCESS, the collateral reaches %v TCESS\n", 42, PlanckToTokens(amount), collateralTarget())
+		}
 		os.Exit(configs.Exit_Normal)
 	}
+	if configs.Confile.MinerData.CollateralThreshold > 0 && !Exiting() &&
+		callAvailable(configs.ChainTx_Sminer_IncreaseCollateral, "the collateral top-up") {
+		go collateralMonitor()
+	}
 }
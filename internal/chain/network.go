@@ -0,0 +1,61 @@
+package chain
+
+import (
+	"storage-mining/configs"
+	"strings"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// The node serves another chain than the network profile
+var ErrWrongNetwork = errors.New("wrong network")
+
+// Neither the network profile nor the configuration file has the
+// genesis hash of the chain
+var ErrUnknownGenesis = errors.New("unknown genesis hash")
+
+// Genesis hash the chain must have: genesisHash of the configuration
+// file, else the one of the network profile. ok is false when any
+// genesis is accepted, as on a dev chain.
+func ExpectedGenesis() (types.Hash, bool, error) {
+	s := strings.TrimSpace(configs.Confile.CessChain.GenesisHash)
+	if s == "" {
+		s = configs.NetworkProfile.GenesisHash
+	}
+	if s == "" {
+		if configs.NetworkProfile.AnyGenesis {
+			return types.Hash{}, false, nil
+		}
+		return types.Hash{}, false, errors.Wrapf(ErrUnknownGenesis, "the %v network has none, set genesisHash", configs.NetworkName)
+	}
+	h, err := types.NewHashFromHexString(s)
+	if err != nil {
+		return h, false, errors.Wrapf(err, "genesis hash '%v'", s)
+	}
+	return h, true, nil
+}
+
+// Genesis hash of the chain of the node at addr
+func GenesisAt(addr string) (types.Hash, error) {
+	api, err := gsrpc.NewSubstrateAPI(addr)
+	if err != nil {
+		return types.Hash{}, errors.Wrap(err, "NewSubstrateAPI err")
+	}
+	defer closeAPI(api)
+	h, err := api.RPC.Chain.GetBlockHash(0)
+	return h, errors.Wrap(err, "GetBlockHash err")
+}
+
+// Check the genesis hash of a node against the network profile
+func verifyGenesis(h types.Hash) error {
+	want, ok, err := ExpectedGenesis()
+	if err != nil || !ok {
+		return err
+	}
+	if h != want {
+		return errors.Wrapf(ErrWrongNetwork, "genesis %v, %v has %v", h.Hex(), configs.NetworkName, want.Hex())
+	}
+	return nil
+}
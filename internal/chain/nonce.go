@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"strings"
+	"sync"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Number of times a transaction is re-signed after a nonce error
+const maxNonceRetry = 3
+
+// Local nonce allocator for the identity account.
+// Nonces are handed out sequentially so that several extrinsics can be
+// in the transaction pool at the same time; the allocator goes back to
+// the chain only on first use or after a nonce error.
+type nonceManager struct {
+	lock   sync.Mutex
+	synced bool
+	next   uint64
+}
+
+var nonces = new(nonceManager)
+
+// Get the next nonce to sign with
+func (n *nonceManager) allocate(api *gsrpc.SubstrateAPI, meta *types.Metadata, pub []byte) (uint64, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if !n.synced {
+		next, err := chainNonce(api, meta, pub)
+		if err != nil {
+			return 0, err
+		}
+		n.next = next
+		n.synced = true
+	}
+	nonce := n.next
+	n.next++
+	return nonce, nil
+}
+
+// Give back a nonce whose extrinsic never reached the pool.
+// Only the most recent nonce can be reused; otherwise there is now a gap
+// and the allocator has to resync with the chain.
+func (n *nonceManager) release(nonce uint64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.synced && n.next == nonce+1 {
+		n.next = nonce
+		return
+	}
+	n.synced = false
+}
+
+// Drop the local state, the next allocation reads the nonce from the chain
+func (n *nonceManager) resync() {
+	n.lock.Lock()
+	n.synced = false
+	n.lock.Unlock()
+}
+
+// Read the next usable nonce from the chain, including the transactions
+// already in the pool. Falls back to System.Account if the node does not
+// serve system_accountNextIndex.
+func chainNonce(api *gsrpc.SubstrateAPI, meta *types.Metadata, pub []byte) (uint64, error) {
+	var next uint64
+	addr, err := accountAddress(pub)
+	if err != nil {
+		return 0, errors.Wrap(err, "accountAddress err")
+	}
+	err = api.Client.Call(&next, "system_accountNextIndex", addr)
+	if err == nil {
+		return next, nil
+	}
+	return accountNonce(api, meta, pub)
+}
+
+// The nonce of the account in the best block, without the pool
+func accountNonce(api *gsrpc.SubstrateAPI, meta *types.Metadata, pub []byte) (uint64, error) {
+	var accountInfo types.AccountInfo
+	key, err := types.CreateStorageKey(meta, "System", "Account", pub)
+	if err != nil {
+		return 0, errors.Wrap(err, "CreateStorageKey System Account err")
+	}
+	ok, err := api.RPC.State.GetStorageLatest(key, &accountInfo)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetStorageLatest err")
+	}
+	if !ok {
+		return 0, errors.New("GetStorageLatest return value is empty")
+	}
+	return uint64(accountInfo.Nonce), nil
+}
+
+// Whether the pool rejected the extrinsic because of its nonce
+func isNonceError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Transaction is outdated") ||
+		strings.Contains(msg, "Priority is too low") ||
+		strings.Contains(msg, "Transaction is in the future") ||
+		strings.Contains(msg, "Stale")
+}
@@ -0,0 +1,131 @@
+package chain
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+var testPub = make([]byte, 32)
+
+func TestNonceConcurrentAllocate(t *testing.T) {
+	n, api, meta := startNode(t)
+	n.setNonce(7)
+	m := new(nonceManager)
+	var (
+		lock sync.Mutex
+		got  []int
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := m.allocate(api, meta, testPub)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lock.Lock()
+			got = append(got, int(nonce))
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Ints(got)
+	for i := 0; i < len(got); i++ {
+		if got[i] != 7+i {
+			t.Fatalf("nonces %v, want 7 to 56 once each", got)
+		}
+	}
+}
+
+func TestNonceRelease(t *testing.T) {
+	n, api, meta := startNode(t)
+	n.setNonce(7)
+	m := new(nonceManager)
+	a, _ := m.allocate(api, meta, testPub)
+	b, _ := m.allocate(api, meta, testPub)
+	// the latest nonce is handed out again
+	m.release(b)
+	c, err := m.allocate(api, meta, testPub)
+	if err != nil || a != 7 || c != b {
+		t.Fatalf("allocated %v, %v after releasing %v: %v", a, c, b, err)
+	}
+	// an older one leaves a gap, the next nonce comes from the chain,
+	// where the extrinsic of c is pending
+	n.setNonce(9)
+	m.release(a)
+	d, err := m.allocate(api, meta, testPub)
+	if err != nil || d != 9 {
+		t.Fatalf("allocated %v after releasing %v, want 9: %v", d, a, err)
+	}
+}
+
+func TestNonceResync(t *testing.T) {
+	n, api, meta := startNode(t)
+	saved := nonces
+	nonces = new(nonceManager)
+	defer func() { nonces = saved }()
+	n.setNonce(3)
+	nonce, err := nonces.allocate(api, meta, testPub)
+	if err != nil || nonce != 3 {
+		t.Fatalf("allocated %v: %v", nonce, err)
+	}
+
+	// another signer of the account took nonces 3 to 9, the extrinsic
+	// waits in the future queue of the pool
+	n.setNonce(10)
+	ext := testExtrinsic(t, 3)
+	n.submit(ext)
+	statuses := make(chan types.ExtrinsicStatus, 2)
+	statuses <- types.ExtrinsicStatus{IsFuture: true}
+	statuses <- types.ExtrinsicStatus{IsInBlock: true, AsInBlock: n.produce(ext)}
+	var receipt TxReceipt
+	receipt.ExtrinsicHash, _ = extrinsicHash(ext)
+	err = watchExtrinsic(api, meta, statuses, nil, nil, &receipt, "Sminer.regnstk", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err = nonces.allocate(api, meta, testPub)
+	if err != nil || nonce != 10 {
+		t.Fatalf("allocated %v after a Future status, want 10: %v", nonce, err)
+	}
+
+	// the pool refuses a stale nonce, signAndSubmit resyncs and signs again
+	n.setNonce(12)
+	stale := errors.Wrap(fmt.Errorf("1010: Invalid Transaction: Transaction is outdated"), "SubmitAndWatchExtrinsic err")
+	if !isNonceError(stale) {
+		t.Fatalf("%v is not a nonce error", stale)
+	}
+	nonces.resync()
+	nonce, err = nonces.allocate(api, meta, testPub)
+	if err != nil || nonce != 12 {
+		t.Fatalf("allocated %v after a stale nonce, want 12: %v", nonce, err)
+	}
+}
+
+func TestIsNonceError(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fmt.Errorf("1010: Invalid Transaction: Transaction is outdated"), true},
+		{fmt.Errorf("1014: Priority is too low: (140 vs 140)"), true},
+		{fmt.Errorf("1010: Invalid Transaction: Transaction is in the future"), true},
+		{fmt.Errorf("Invalid Transaction: Stale"), true},
+		{errors.Wrap(fmt.Errorf("1014: Priority is too low: (1 vs 1)"), "SubmitAndWatchExtrinsic err"), true},
+		{fmt.Errorf("1010: Invalid Transaction: Inability to pay some fees , e.g. account balance too low"), false},
+		{fmt.Errorf("1002: Verification Error: Runtime error: Execution failed"), false},
+		{fmt.Errorf("websocket: close 1006 (abnormal closure)"), false},
+	} {
+		if got := isNonceError(c.err); got != c.want {
+			t.Errorf("isNonceError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
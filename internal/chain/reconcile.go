@@ -0,0 +1,92 @@
+package chain
+
+import (
+	"storage-mining/internal/logger"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Number of recent blocks searched for a transaction that timed out
+const reconcileDepth = 50
+
+// Decide what happened to a transaction whose watch ended without a
+// result (timeout, a retracted block or a broken subscription).
+// If the extrinsic is found in a recent block the receipt is completed
+// and nil is returned. If it is still in the pool the cause is returned
+// as a terminal error. If it is neither on chain nor pending, it was lost
+// and the error is retryable.
+func reconcile(api *gsrpc.SubstrateAPI, meta *types.Metadata, keye types.StorageKey, matcher EventMatcher, receipt *TxReceipt, callName string, cause *TxError) error {
+	blockHash, found, err := locateExtrinsic(api, receipt.ExtrinsicHash, reconcileDepth)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v][%v] reconcile: %v", callName, receipt.ExtrinsicHash.Hex(), err)
+		return cause
+	}
+	if found {
+		logger.InfoLogger.Sugar().Infof("[%v][%v] %v, but found in block %v", callName, receipt.ExtrinsicHash.Hex(), cause.Status, blockHash.Hex())
+		return collectReceipt(api, meta, keye, blockHash, matcher, receipt, callName)
+	}
+	pending, err := isPending(api, receipt.ExtrinsicHash)
+	if err != nil || pending {
+		return cause
+	}
+	cause.Retryable = true
+	return cause
+}
+
+// Search the extrinsic in the latest blocks, walking back from the best block
+func locateExtrinsic(api *gsrpc.SubstrateAPI, extHash types.Hash, depth int) (types.Hash, bool, error) {
+	blockHash, err := api.RPC.Chain.GetBlockHashLatest()
+	if err != nil {
+		return blockHash, false, errors.Wrap(err, "GetBlockHashLatest err")
+	}
+	for i := 0; i < depth; i++ {
+		block, err := api.RPC.Chain.GetBlock(blockHash)
+		if err != nil {
+			return blockHash, false, errors.Wrap(err, "GetBlock err")
+		}
+		for j := 0; j < len(block.Block.Extrinsics); j++ {
+			h, err := extrinsicHash(block.Block.Extrinsics[j])
+			if err == nil && h == extHash {
+				return blockHash, true, nil
+			}
+		}
+		if block.Block.Header.Number == 0 {
+			break
+		}
+		blockHash = block.Block.Header.ParentHash
+	}
+	return blockHash, false, nil
+}
+
+// Whether the extrinsic is still in the transaction pool of the node
+func isPending(api *gsrpc.SubstrateAPI, extHash types.Hash) (bool, error) {
+	xts, err := api.RPC.Author.PendingExtrinsics()
+	if err != nil {
+		return false, errors.Wrap(err, "PendingExtrinsics err")
+	}
+	for i := 0; i < len(xts); i++ {
+		h, err := extrinsicHash(xts[i])
+		if err == nil && h == extHash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Check the expected storage when a transaction could not be reconciled
+// through its extrinsic hash. Returns true if the check shows the
+// operation took effect on chain.
+func reconcileWithStorage(err error, check func() (bool, error)) bool {
+	status := TxStatusOf(err)
+	if status != TxStatus_Timeout && status != TxStatus_WatchLost && status != TxStatus_Retracted {
+		return false
+	}
+	ok, cerr := check()
+	if cerr != nil {
+		logger.ErrLogger.Sugar().Errorf("reconcile with storage: %v", cerr)
+		return false
+	}
+	return ok
+}
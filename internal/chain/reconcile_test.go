@@ -0,0 +1,120 @@
+package chain
+
+import (
+	"testing"
+
+	"storage-mining/configs"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Reconcile ext after its watch ended with status
+func reconcileTx(t *testing.T, n *fakeNode, ext types.Extrinsic, status string) (TxReceipt, error) {
+	keye, err := types.CreateStorageKey(n.metadata, "System", "Events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var receipt TxReceipt
+	receipt.ExtrinsicHash, _ = extrinsicHash(ext)
+	cause := &TxError{Call: configs.ChainTx_Sminer_Register, Hash: receipt.ExtrinsicHash, Status: status}
+	err = reconcile(n.api, n.metadata, keye, nil, &receipt, configs.ChainTx_Sminer_Register, cause)
+	return receipt, err
+}
+
+func TestReconcileFound(t *testing.T) {
+	n, _, _ := startNode(t)
+	ext := testExtrinsic(t, 1)
+	n.advance(3)
+	block := n.produce(testExtrinsic(t, 2), ext)
+	// the oldest block still searched
+	n.advance(reconcileDepth - 1)
+	receipt, err := reconcileTx(t, n, ext, TxStatus_Timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.BlockHash != block || receipt.Index != 1 {
+		t.Fatalf("found in %v at %v, want %v at 1", receipt.BlockHash.Hex(), receipt.Index, block.Hex())
+	}
+}
+
+func TestReconcileBeyondDepth(t *testing.T) {
+	n, _, _ := startNode(t)
+	ext := testExtrinsic(t, 1)
+	n.advance(3)
+	n.produce(ext)
+	n.advance(reconcileDepth)
+	_, err := reconcileTx(t, n, ext, TxStatus_Timeout)
+	if TxStatusOf(err) != TxStatus_Timeout || !IsRetryable(err) {
+		t.Fatalf("an extrinsic out of reach is not lost: %v", err)
+	}
+}
+
+func TestReconcilePending(t *testing.T) {
+	n, _, _ := startNode(t)
+	ext := testExtrinsic(t, 1)
+	n.submit(ext)
+	n.advance(2)
+	_, err := reconcileTx(t, n, ext, TxStatus_WatchLost)
+	if TxStatusOf(err) != TxStatus_WatchLost || IsRetryable(err) {
+		t.Fatalf("a pending extrinsic is sent again: %v", err)
+	}
+	// neither included nor pending, it was lost
+	n.produce(testExtrinsic(t, 2))
+	n.lock.Lock()
+	n.pending = nil
+	n.lock.Unlock()
+	_, err = reconcileTx(t, n, ext, TxStatus_WatchLost)
+	if !IsRetryable(err) {
+		t.Fatalf("a lost extrinsic is not sent again: %v", err)
+	}
+}
+
+func TestReconcileWithStorage(t *testing.T) {
+	quietLogs()
+	f := NewFakeChain(1)
+	const (
+		registered = "registered"
+		other      = "other"
+	)
+	_, err := f.RegisterToChain(registered, "0xd43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d", "127.0.0.1", 2000, 15001, 15002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registeredOn := func(account string) func() (bool, error) {
+		return func() (bool, error) {
+			mdata, err := f.GetMinerDataOnChain(account, configs.ChainModule_Sminer, configs.ChainModule_Sminer_MinerItems)
+			return mdata.Peerid > 0, err
+		}
+	}
+	for _, status := range []string{TxStatus_Timeout, TxStatus_WatchLost, TxStatus_Retracted} {
+		err := errors.Wrap(&TxError{Call: configs.ChainTx_Sminer_Register, Status: status}, "submit")
+		if !reconcileWithStorage(err, registeredOn(registered)) {
+			t.Errorf("%v: the registration on the chain is not found", status)
+		}
+		if reconcileWithStorage(err, registeredOn(other)) {
+			t.Errorf("%v: a registration is found that did not happen", status)
+		}
+	}
+
+	// the outcome of the other statuses is known, the storage is not read
+	for _, err := range []error{
+		&TxError{Status: TxStatus_Invalid},
+		&TxError{Status: TxStatus_Dropped, Retryable: true},
+		&TxError{Status: TxStatus_Refused},
+		errors.New("SubmitAndWatchExtrinsic err"),
+	} {
+		if reconcileWithStorage(err, func() (bool, error) {
+			t.Errorf("%v: the storage is read", err)
+			return true, nil
+		}) {
+			t.Errorf("%v: reconciled", err)
+		}
+	}
+
+	// a failed read is not taken as success
+	f.Fail(configs.ChainModule_Sminer_MinerItems, errors.New("GetStorageLatest err"))
+	if reconcileWithStorage(&TxError{Status: TxStatus_Timeout}, registeredOn(registered)) {
+		t.Error("reconciled without reading the storage")
+	}
+}
@@ -0,0 +1,89 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"storage-mining/internal/signer"
+	"strings"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Timeout of a request to the signing service
+const remoteSignTimeout = time.Second * 20
+
+// Signer of a remote signing service, the secret never reaches this host
+type remoteSigner struct {
+	url    string
+	token  string
+	client *http.Client
+	pub    []byte
+}
+
+// Connect to the signing service and get the account it signs for
+func NewRemoteSigner(url, token string) (Signer, error) {
+	s := &remoteSigner{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		client: &http.Client{Timeout: remoteSignTimeout},
+	}
+	var acc signer.AccountResp
+	err := s.call(http.MethodGet, signer.Path_Account, nil, &acc)
+	if err != nil {
+		return nil, err
+	}
+	s.pub, err = types.HexDecodeString(acc.PublicKey)
+	if err != nil || len(s.pub) != 32 {
+		return nil, errors.Errorf("invalid public key %v from the signing service", acc.PublicKey)
+	}
+	return s, nil
+}
+
+func (s *remoteSigner) PublicKey() []byte {
+	return s.pub
+}
+
+func (s *remoteSigner) Sign(callName string, payload []byte) ([]byte, error) {
+	var resp signer.SignResp
+	err := s.call(http.MethodPost, signer.Path_Sign, signer.SignReq{Call: callName, Payload: types.HexEncodeToString(payload)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := types.HexDecodeString(resp.Signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signature from the signing service")
+	}
+	return sig, nil
+}
+
+func (s *remoteSigner) call(method, path string, req, resp interface{}) error {
+	var body bytes.Buffer
+	if req != nil {
+		err := json.NewEncoder(&body).Encode(req)
+		if err != nil {
+			return errors.Wrap(err, "Encode err")
+		}
+	}
+	r, err := http.NewRequest(method, s.url+path, &body)
+	if err != nil {
+		return errors.Wrap(err, "NewRequest err")
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		r.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	res, err := s.client.Do(r)
+	if err != nil {
+		return errors.Wrap(err, "signing service err")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var e signer.SignResp
+		json.NewDecoder(res.Body).Decode(&e)
+		return errors.Errorf("signing service: %v %v", res.Status, e.Error)
+	}
+	return errors.Wrap(json.NewDecoder(res.Body).Decode(resp), "Decode err")
+}
@@ -0,0 +1,111 @@
+package chain
+
+import (
+	"math/big"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Collateral of the miner compared with the configured target
+type CollateralState struct {
+	Collaterals *big.Int
+	// locked earnings, they do not count as collateral
+	Locked *big.Int
+	Target *big.Int
+	// missing to reach the target, 0 if there is enough
+	Shortfall *big.Int
+}
+
+// Target of the top-up, collateralTarget or else pledgeTokens, in TCESS
+func collateralTarget() uint64 {
+	if configs.Confile.MinerData.CollateralTarget > 0 {
+		return configs.Confile.MinerData.CollateralTarget
+	}
+	return configs.Confile.MinerData.PledgeTokens
+}
+
+// Read the collateral of the miner and compare it with the target
+func GetCollateralState() (CollateralState, error) {
+	var st CollateralState
+	mdata, err := Client.GetMinerDataOnChain(
+		keystore.Secret(),
+		configs.ChainModule_Sminer,
+		configs.ChainModule_Sminer_MinerItems,
+	)
+	if err != nil {
+		return st, err
+	}
+	st.Target, err = TokensToPlanck(collateralTarget())
+	if err != nil {
+		return st, err
+	}
+	st.Collaterals = u128Int(mdata.Collaterals)
+	st.Locked = u128Int(mdata.Locked)
+	st.Shortfall = new(big.Int).Sub(st.Target, st.Collaterals)
+	if st.Shortfall.Sign() < 0 {
+		st.Shortfall.SetInt64(0)
+	}
+	return st, nil
+}
+
+// Top up the collateral to the target. Returns the amount pledged, 0 if
+// the collateral already reaches the target.
+func RenewCollateral() (*big.Int, error) {
+	st, err := GetCollateralState()
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoLogger.Sugar().Infof("[%v] collateral %v TCESS, target %v TCESS, locked earnings %v TCESS",
+		configs.MinerId_S, PlanckToTokens(st.Collaterals), PlanckToTokens(st.Target), PlanckToTokens(st.Locked))
+	if st.Shortfall.Sign() == 0 {
+		return st.Shortfall, nil
+	}
+	ok, err := Client.RenewalTokens(keystore.Secret(), st.Shortfall)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Errorf("%v failed", configs.ChainTx_Sminer_IncreaseCollateral)
+	}
+	logger.InfoLogger.Sugar().Infof("[%v] collateral topped up by %v TCESS", configs.MinerId_S, PlanckToTokens(st.Shortfall))
+	return st.Shortfall, nil
+}
+
+// Top up automatically when the collateral falls below
+// collateralThreshold, e.g. after a penalty
+func collateralMonitor() {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	threshold, err := TokensToPlanck(configs.Confile.MinerData.CollateralThreshold)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		return
+	}
+	for range time.Tick(time.Minute * configs.TimeToCheckCollateral_M) {
+		if Exiting() {
+			return
+		}
+		st, err := GetCollateralState()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		if st.Collaterals.Cmp(threshold) >= 0 {
+			continue
+		}
+		logger.InfoLogger.Sugar().Infof("[%v] collateral %v TCESS is below %v TCESS",
+			configs.MinerId_S, PlanckToTokens(st.Collaterals), configs.Confile.MinerData.CollateralThreshold)
+		_, err = RenewCollateral()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[%v] %v", configs.ChainTx_Sminer_IncreaseCollateral, err)
+		}
+	}
+}
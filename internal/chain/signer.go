@@ -0,0 +1,125 @@
+package chain
+
+import (
+	"fmt"
+	"storage-mining/configs"
+	"storage-mining/internal/keystore"
+	"storage-mining/tools"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Signs the extrinsics of the identity account
+type Signer interface {
+	// public key of the account
+	PublicKey() []byte
+	// sign the encoded payload of an extrinsic of the call
+	Sign(callName string, payload []byte) ([]byte, error)
+}
+
+// Signer of a remote signing service. When set, it signs in place of the
+// keyring for an empty identity account phrase.
+var RemoteSigner Signer
+
+// Signer with the secret of the account in memory
+type keyringSigner struct {
+	keyring signature.KeyringPair
+}
+
+func NewKeyringSigner(identifyAccountPhrase string) (Signer, error) {
+	keyring, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "KeyringPairFromSecret err")
+	}
+	return keyringSigner{keyring: keyring}, nil
+}
+
+func (s keyringSigner) PublicKey() []byte {
+	return s.keyring.PublicKey
+}
+
+func (s keyringSigner) Sign(callName string, payload []byte) ([]byte, error) {
+	return signature.Sign(payload, s.keyring.URI)
+}
+
+// Get the signer of the identity account
+func accountSigner(identifyAccountPhrase string) (Signer, error) {
+	if identifyAccountPhrase == "" && RemoteSigner != nil {
+		return RemoteSigner, nil
+	}
+	return NewKeyringSigner(identifyAccountPhrase)
+}
+
+// Get the public key of the identity account
+func accountPublicKey(identifyAccountPhrase string) ([]byte, error) {
+	s, err := accountSigner(identifyAccountPhrase)
+	if err != nil {
+		return nil, err
+	}
+	return s.PublicKey(), nil
+}
+
+// SS58 address of the public key, as taken by the node rpc
+func accountAddress(pub []byte) (string, error) {
+	return tools.EncodeSS58(pub, 0)
+}
+
+// Address of the identity account on the network in use, for display
+func identityAddress() string {
+	pub, err := accountPublicKey(keystore.Secret())
+	if err != nil {
+		return ""
+	}
+	addr, _ := tools.EncodeSS58(pub, configs.NetworkProfile.SS58Prefix)
+	return addr
+}
+
+// Same as types.Extrinsic.Sign, with the payload signed by the signer
+func signExtrinsic(ext *types.Extrinsic, signer Signer, callName string, o types.SignatureOptions) error {
+	if ext.Type() != types.ExtrinsicVersion4 {
+		return fmt.Errorf("unsupported extrinsic version: %v (isSigned: %v, type: %v)", ext.Version, ext.IsSigned(), ext.Type())
+	}
+	mb, err := types.EncodeToBytes(ext.Method)
+	if err != nil {
+		return err
+	}
+	era := o.Era
+	if !o.Era.IsMortalEra {
+		era = types.ExtrinsicEra{IsImmortalEra: true}
+	}
+	payload := types.ExtrinsicPayloadV4{
+		ExtrinsicPayloadV3: types.ExtrinsicPayloadV3{
+			Method:      mb,
+			Era:         era,
+			Nonce:       o.Nonce,
+			Tip:         o.Tip,
+			SpecVersion: o.SpecVersion,
+			GenesisHash: o.GenesisHash,
+			BlockHash:   o.BlockHash,
+		},
+		TransactionVersion: o.TransactionVersion,
+	}
+	b, err := types.EncodeToBytes(payload)
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(callName, b)
+	if err != nil {
+		return err
+	}
+	if len(sig) != 64 {
+		return errors.Errorf("invalid signature length %v", len(sig))
+	}
+	ext.Signature = types.ExtrinsicSignatureV4{
+		Signer:    types.NewMultiAddressFromAccountID(signer.PublicKey()),
+		Signature: types.MultiSignature{IsSr25519: true, AsSr25519: types.NewSignature(sig)},
+		Era:       era,
+		Nonce:     o.Nonce,
+		Tip:       o.Tip,
+	}
+	// mark the extrinsic as signed
+	ext.Version |= types.ExtrinsicBitSigned
+	return nil
+}
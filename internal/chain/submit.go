@@ -0,0 +1,478 @@
+package chain
+
+import (
+	"math/big"
+	"math/bits"
+	"storage-mining/configs"
+	"storage-mining/internal/logger"
+	"sync/atomic"
+	"time"
+
+	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/hash"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/rpc/author"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Dispatch result of an extrinsic in its block
+type DispatchResult struct {
+	IsSuccess bool
+	IsFailed  bool
+	Error     DispatchError
+}
+
+// Transaction receipt
+type TxReceipt struct {
+	ExtrinsicHash types.Hash
+	BlockHash     types.Hash
+	Events        MyEventRecords
+	Result        DispatchResult
+	Matched       bool
+	// index of the extrinsic in its block, -1 if unknown
+	Index int
+}
+
+// Report whether the expected event is in the block events
+type EventMatcher func(events *MyEventRecords) bool
+
+// Sign and submit a transaction, then wait for it to be confirmed.
+// All chain-mutating calls go through here. The funds are checked once,
+// before the first submission. Retryable outcomes are
+// submitted again with an increasing backoff. An extrinsic that got lost
+// is sent again as it was signed, so its nonce keeps it from being
+// applied twice should the first submission still be included; it is
+// only re-signed once its nonce was taken.
+func submitExtrinsic(identifyAccountPhrase, callName string, matcher EventMatcher, args ...interface{}) (TxReceipt, error) {
+	return submitSpending(identifyAccountPhrase, callName, nil, matcher, args...)
+}
+
+// submitExtrinsic for a call that also reserves or transfers spend tokens
+// of the identity account, such as the pledge of the registration
+func submitSpending(identifyAccountPhrase, callName string, spend *big.Int, matcher EventMatcher, args ...interface{}) (TxReceipt, error) {
+	// refuse early when the fee cannot be paid, a failed check itself
+	// does not stop the transaction
+	_, err := Preflight(identifyAccountPhrase, callName, spend, args...)
+	if IsInsufficientFunds(err) {
+		journalRejected(callName, args, err)
+		return TxReceipt{}, err
+	}
+	if err != nil {
+		logPreflight(callName, err)
+	}
+
+	var lost *types.Extrinsic
+	backoff := txRetryBackoff
+	for try := 0; ; try++ {
+		receipt, ext, err := submitOnce(identifyAccountPhrase, callName, matcher, lost, args...)
+		if err == nil || !IsRetryable(err) || try >= maxTxRetry {
+			return receipt, err
+		}
+		lost = nil
+		if IsResendable(err) {
+			lost = &ext
+		}
+		logger.InfoLogger.Sugar().Infof("[%v] resubmit in %v: %v", callName, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Submit the transaction once and watch its status. A lost extrinsic is
+// put back into the pool as it is, otherwise the call is signed with a new
+// nonce. The api lock is only held while signing and submitting, so
+// several transactions can wait for their blocks at the same time.
+func submitOnce(identifyAccountPhrase, callName string, matcher EventMatcher, lost *types.Extrinsic, args ...interface{}) (TxReceipt, types.Extrinsic, error) {
+	var (
+		receipt TxReceipt
+		api     *gsrpc.SubstrateAPI
+		meta    *types.Metadata
+		ext     types.Extrinsic
+		sub     *author.ExtrinsicStatusSubscription
+		err     error
+	)
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	if lost != nil {
+		ext = *lost
+		api, meta, sub, err = resubmit(ext, callName)
+		if err != nil && api != nil {
+			defer dropAPI(api)
+			return receipt, ext, refused(api, meta, matcher, &receipt, callName, args, ext, err)
+		}
+	} else {
+		api, meta, ext, sub, err = signAndSubmit(identifyAccountPhrase, callName, args...)
+		if err != nil && !IsDryRun(err) {
+			journalRejected(callName, args, err)
+		}
+	}
+	if err != nil {
+		return receipt, ext, err
+	}
+	defer dropAPI(api)
+	defer sub.Unsubscribe()
+
+	receipt.ExtrinsicHash, err = extrinsicHash(ext)
+	if err != nil {
+		return receipt, ext, errors.Wrapf(err, "extrinsicHash err [%v]", callName)
+	}
+	j := journalSubmitted(callName, args, ext)
+	err = watchExtrinsic(api, meta, sub.Chan(), sub.Err(), matcher, &receipt, callName, j)
+	j.finish(&receipt, err)
+	return receipt, ext, err
+}
+
+// Put a lost extrinsic back into the pool as it was signed. The connection
+// is held for the watch, or for the lookup if the pool refused it.
+func resubmit(ext types.Extrinsic, callName string) (*gsrpc.SubstrateAPI, *types.Metadata, *author.ExtrinsicStatusSubscription, error) {
+	api := getSubstrateAPI()
+	defer releaseSubstrateAPI()
+	meta, err := getMetadata(api)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "getMetadata err [%v]", callName)
+	}
+	holdAPI(api)
+	sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
+	if err != nil {
+		return api, meta, nil, errors.Wrapf(err, "SubmitAndWatchExtrinsic err [%v]", callName)
+	}
+	return api, meta, sub, nil
+}
+
+// The pool refused to take a lost extrinsic back. If it was included after
+// all its receipt is collected. If it is neither on chain nor pending, its
+// nonce went to another extrinsic or it no longer validates, and the call
+// can be signed again.
+func refused(api *gsrpc.SubstrateAPI, meta *types.Metadata, matcher EventMatcher, receipt *TxReceipt, callName string, args []interface{}, ext types.Extrinsic, serr error) error {
+	var err error
+	j := newJournalTx(callName, args, ext)
+	cause := &TxError{Call: callName, Status: TxStatus_Refused, Err: serr}
+	receipt.ExtrinsicHash, err = extrinsicHash(ext)
+	if err != nil {
+		return cause
+	}
+	cause.Hash = receipt.ExtrinsicHash
+	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
+	if err != nil {
+		return cause
+	}
+	err = reconcile(api, meta, keye, matcher, receipt, callName, cause)
+	j.finish(receipt, err)
+	return err
+}
+
+// How often the confirmations of the inclusion block are counted
+var confirmInterval = time.Second * 3
+
+// Follow the status of a submitted extrinsic, read from the channels of
+// its subscription, until it is confirmed as the policy requires, and
+// journal the transitions
+func watchExtrinsic(api *gsrpc.SubstrateAPI, meta *types.Metadata, statuses <-chan types.ExtrinsicStatus, errs <-chan error, matcher EventMatcher, receipt *TxReceipt, callName string, j *journalTx) error {
+	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
+	if err != nil {
+		return errors.Wrapf(err, "CreateStorageKey System Events err [%v]", callName)
+	}
+
+	var (
+		incl      inclusion
+		confirmTk = time.NewTicker(confirmInterval)
+		timeout   = time.NewTimer(time.Second * configs.TimeToWaitEvents_S)
+	)
+	defer confirmTk.Stop()
+	defer timeout.Stop()
+	for {
+		select {
+		case status := <-statuses:
+			switch {
+			case status.IsFuture:
+				// a nonce before ours never reached the pool
+				nonces.resync()
+			case status.IsInBlock:
+				j.update(Journal_InBlock, status.AsInBlock)
+				if txPolicy.inBlock() {
+					return collectReceipt(api, meta, keye, status.AsInBlock, matcher, receipt, callName)
+				}
+				err = incl.setInBlock(api, status.AsInBlock)
+				if err != nil {
+					logger.ErrLogger.Sugar().Errorf("[%v] %v", callName, err)
+				}
+				timeout.Reset(time.Second * configs.TimeToWaitConfirm_S)
+			case status.IsRetracted:
+				j.update(Journal_Retracted, status.AsRetracted)
+				logger.InfoLogger.Sugar().Infof("[%v][%v] block %v retracted, waiting for re-inclusion", callName, receipt.ExtrinsicHash.Hex(), status.AsRetracted.Hex())
+				incl.setRetracted()
+			case status.IsFinalized:
+				j.update(Journal_Finalized, status.AsFinalized)
+				return collectReceipt(api, meta, keye, status.AsFinalized, matcher, receipt, callName)
+			default:
+				txErr := statusError(status, callName, receipt.ExtrinsicHash)
+				if txErr != nil {
+					nonces.resync()
+					return txErr
+				}
+			}
+		case <-confirmTk.C:
+			if txPolicy.finalized || txPolicy.blocks == 0 {
+				continue
+			}
+			ok, err := incl.confirmed(api, txPolicy.blocks)
+			if err != nil {
+				logger.ErrLogger.Sugar().Errorf("[%v] %v", callName, err)
+				continue
+			}
+			if ok {
+				return collectReceipt(api, meta, keye, incl.hash, matcher, receipt, callName)
+			}
+		case err = <-errs:
+			nonces.resync()
+			return reconcile(api, meta, keye, matcher, receipt, callName,
+				&TxError{Call: callName, Hash: receipt.ExtrinsicHash, Status: TxStatus_WatchLost, Err: errors.Wrap(err, "Subscription err")})
+		case <-timeout.C:
+			nonces.resync()
+			cause := &TxError{Call: callName, Hash: receipt.ExtrinsicHash, Status: TxStatus_Timeout, Err: errors.New("SubmitAndWatchExtrinsic timeout")}
+			if incl.retracted && !incl.included {
+				// the retracted block may still have a sibling with it
+				cause = &TxError{Call: callName, Hash: receipt.ExtrinsicHash, Status: TxStatus_Retracted, Err: ErrTxRetracted}
+			}
+			return reconcile(api, meta, keye, matcher, receipt, callName, cause)
+		}
+	}
+}
+
+// Fill the receipt with the events and dispatch result from the block.
+// An extrinsic rejected by the runtime is reported as a RuntimeError.
+func collectReceipt(api *gsrpc.SubstrateAPI, meta *types.Metadata, keye types.StorageKey, blockHash types.Hash, matcher EventMatcher, receipt *TxReceipt, callName string) error {
+	receipt.BlockHash = blockHash
+	h, err := api.RPC.State.GetStorageRaw(keye, blockHash)
+	if err != nil {
+		return errors.Wrapf(err, "GetStorageRaw err [%v]", callName)
+	}
+	err = decodeEvents(meta, *h, &receipt.Events)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v][%v] decodeEvents err: %v", callName, blockHash.Hex(), err)
+	}
+	if matcher != nil {
+		receipt.Matched = matcher(&receipt.Events)
+	}
+	receipt.Result = dispatchResult(api, receipt)
+	if receipt.Result.IsFailed {
+		return errors.Wrapf(decodeDispatchError(meta, receipt.Result.Error), "[%v][%v] dispatch failed", callName, receipt.ExtrinsicHash.Hex())
+	}
+	return nil
+}
+
+// Build and sign the extrinsic with a locally allocated nonce and put it
+// into the transaction pool. Nonce errors from the pool are retried after
+// resyncing the nonce with the chain. In dry-run mode the extrinsic is
+// only validated and ErrDryRun is returned.
+func signAndSubmit(identifyAccountPhrase, callName string, args ...interface{}) (*gsrpc.SubstrateAPI, *types.Metadata, types.Extrinsic, *author.ExtrinsicStatusSubscription, error) {
+	var ext types.Extrinsic
+	api := getSubstrateAPI()
+	defer releaseSubstrateAPI()
+
+	signer, err := accountSigner(identifyAccountPhrase)
+	if err != nil {
+		return nil, nil, ext, nil, errors.Wrapf(err, "accountSigner err [%v]", callName)
+	}
+
+	ctx, err := getChainContext(api)
+	if err != nil {
+		return nil, nil, ext, nil, errors.Wrapf(err, "getChainContext err [%v]", callName)
+	}
+
+	c, err := types.NewCall(ctx.meta, callName, args...)
+	if err != nil {
+		return nil, nil, ext, nil, errors.Wrapf(err, "NewCall err [%v]", callName)
+	}
+
+	for try := 0; ; try++ {
+		nonce, err := nonces.allocate(api, ctx.meta, signer.PublicKey())
+		if err != nil {
+			return nil, nil, ext, nil, errors.Wrapf(err, "allocate nonce err [%v]", callName)
+		}
+
+		// Sign the transaction
+		ext, err = signCall(api, ctx, signer, c, nonce, callName)
+		if err != nil {
+			nonces.release(nonce)
+			return nil, nil, ext, nil, err
+		}
+
+		if configs.DryRun {
+			nonces.release(nonce)
+			return nil, nil, ext, nil, dryRun(api, ctx.meta, ext, callName, args)
+		}
+
+		// Do the transfer and track the actual status
+		sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
+		if err == nil {
+			// the watch outlives the lock
+			holdAPI(api)
+			return api, ctx.meta, ext, sub, nil
+		}
+		if isNonceError(err) && try < maxNonceRetry {
+			logger.InfoLogger.Sugar().Infof("[%v] nonce %v rejected, resync: %v", callName, nonce, err)
+			nonces.resync()
+			continue
+		}
+		nonces.release(nonce)
+		// signed for an outdated runtime, rebuild the call with the new metadata
+		if try < maxNonceRetry && runtimeUpgraded(api) {
+			ctx, err = getChainContext(api)
+			if err != nil {
+				return nil, nil, ext, nil, errors.Wrapf(err, "getChainContext err [%v]", callName)
+			}
+			c, err = types.NewCall(ctx.meta, callName, args...)
+			if err != nil {
+				return nil, nil, ext, nil, errors.Wrapf(err, "NewCall err [%v]", callName)
+			}
+			continue
+		}
+		return nil, nil, ext, nil, errors.Wrapf(err, "SubmitAndWatchExtrinsic err [%v]", callName)
+	}
+}
+
+// Sign the call with the nonce, mortal from the finalized block
+func signCall(api *gsrpc.SubstrateAPI, ctx *chainContext, signer Signer, c types.Call, nonce uint64, callName string) (types.Extrinsic, error) {
+	ext := types.NewExtrinsic(c)
+	birth, birthHash, err := finalizedBirth(api)
+	if err != nil {
+		return ext, errors.Wrapf(err, "finalizedBirth err [%v]", callName)
+	}
+	o := types.SignatureOptions{
+		BlockHash:          birthHash,
+		Era:                mortalEra(birth),
+		GenesisHash:        ctx.genesisHash,
+		Nonce:              types.NewUCompactFromUInt(nonce),
+		SpecVersion:        ctx.rv.SpecVersion,
+		Tip:                types.NewUCompactFromUInt(0),
+		TransactionVersion: ctx.rv.TransactionVersion,
+	}
+	err = signExtrinsic(&ext, signer, callName, o)
+	if err != nil {
+		return ext, errors.Wrapf(err, "Sign err [%v]", callName)
+	}
+	return ext, nil
+}
+
+// The finalized block a transaction is signed at, its era starts there
+func finalizedBirth(api *gsrpc.SubstrateAPI) (uint64, types.Hash, error) {
+	h, err := api.RPC.Chain.GetFinalizedHead()
+	if err != nil {
+		return 0, h, errors.Wrap(err, "GetFinalizedHead err")
+	}
+	header, err := api.RPC.Chain.GetHeader(h)
+	if err != nil {
+		return 0, h, errors.Wrap(err, "GetHeader err")
+	}
+	birth := uint64(header.Number)
+	for {
+		base := atomic.LoadUint64(&eraBase)
+		if base >= birth || atomic.CompareAndSwapUint64(&eraBase, base, birth) {
+			break
+		}
+	}
+	return birth, h, nil
+}
+
+// Latest block a transaction was signed at. Any block from the birth of
+// a recent transaction on resolves the phase of its era.
+var eraBase uint64
+
+// Mortal era of TxMortalPeriod_B blocks starting at block birth
+func mortalEra(birth uint64) types.ExtrinsicEra {
+	period := uint64(configs.TxMortalPeriod_B)
+	quantize := period >> 12
+	if quantize < 1 {
+		quantize = 1
+	}
+	low := uint64(bits.TrailingZeros64(period)) - 1
+	if low < 1 {
+		low = 1
+	}
+	if low > 15 {
+		low = 15
+	}
+	enc := low | (birth%period/quantize)<<4
+	return types.ExtrinsicEra{
+		IsMortalEra: true,
+		AsMortalEra: types.MortalEra{First: byte(enc), Second: byte(enc >> 8)},
+	}
+}
+
+// First block the extrinsic of the era is no longer valid at, given a
+// block at or after its birth and inside its period. 0 if it is immortal.
+func eraExpiry(era types.ExtrinsicEra, ref uint64) uint64 {
+	if !era.IsMortalEra {
+		return 0
+	}
+	enc := uint64(era.AsMortalEra.First) | uint64(era.AsMortalEra.Second)<<8
+	period := uint64(2) << (enc % 16)
+	quantize := period >> 12
+	if quantize < 1 {
+		quantize = 1
+	}
+	phase := (enc >> 4) * quantize
+	if ref < phase {
+		return phase + period
+	}
+	return (ref-phase)/period*period + phase + period
+}
+
+// Blake2-256 hash of the encoded extrinsic, as used by the transaction pool
+func extrinsicHash(ext types.Extrinsic) (types.Hash, error) {
+	enc, err := types.EncodeToBytes(ext)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	h, err := hash.NewBlake2b256(nil)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	h.Write(enc)
+	return types.NewHash(h.Sum(nil)), nil
+}
+
+// Find the index of the extrinsic in the block
+func extrinsicIndex(api *gsrpc.SubstrateAPI, blockHash, extHash types.Hash) (int, error) {
+	block, err := api.RPC.Chain.GetBlock(blockHash)
+	if err != nil {
+		return -1, errors.Wrap(err, "GetBlock err")
+	}
+	for i := 0; i < len(block.Block.Extrinsics); i++ {
+		h, err := extrinsicHash(block.Block.Extrinsics[i])
+		if err != nil {
+			continue
+		}
+		if h == extHash {
+			return i, nil
+		}
+	}
+	return -1, errors.New("extrinsic not found in block")
+}
+
+// Get the dispatch result of the extrinsic from the System events of its block.
+// If the extrinsic cannot be located, the event matcher decides.
+func dispatchResult(api *gsrpc.SubstrateAPI, receipt *TxReceipt) DispatchResult {
+	idx, err := extrinsicIndex(api, receipt.BlockHash, receipt.ExtrinsicHash)
+	receipt.Index = idx
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v] %v", receipt.ExtrinsicHash.Hex(), err)
+		return DispatchResult{IsSuccess: receipt.Matched}
+	}
+	for _, v := range receipt.Events.System_ExtrinsicFailed {
+		if v.Phase.IsApplyExtrinsic && v.Phase.AsApplyExtrinsic == uint32(idx) {
+			return DispatchResult{IsFailed: true, Error: v.DispatchError}
+		}
+	}
+	for _, v := range receipt.Events.System_ExtrinsicSuccess {
+		if v.Phase.IsApplyExtrinsic && v.Phase.AsApplyExtrinsic == uint32(idx) {
+			return DispatchResult{IsSuccess: true}
+		}
+	}
+	return DispatchResult{IsSuccess: receipt.Matched}
+}
@@ -0,0 +1,49 @@
+package chain
+
+import (
+	"math/big"
+	"storage-mining/configs"
+	"strconv"
+	"strings"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Convert TCESS to the smallest unit of the chain
+func TokensToPlanck(tokens uint64) (*big.Int, error) {
+	v, ok := new(big.Int).SetString(strconv.FormatUint(tokens, 10)+configs.TokenAccuracy, 10)
+	if !ok {
+		return nil, errors.New("SetString err")
+	}
+	return v, nil
+}
+
+// Format an amount of the smallest unit as TCESS, e.g. "12.5"
+func PlanckToTokens(v *big.Int) string {
+	if v == nil {
+		return "0"
+	}
+	neg := v.Sign() < 0
+	s := new(big.Int).Abs(v).String()
+	decimals := len(configs.TokenAccuracy)
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-decimals], strings.TrimRight(s[len(s)-decimals:], "0")
+	if frac != "" {
+		whole += "." + frac
+	}
+	if neg {
+		whole = "-" + whole
+	}
+	return whole
+}
+
+// Get the big.Int of a U128, nil counts as zero
+func u128Int(v types.U128) *big.Int {
+	if v.Int == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(v.Int)
+}
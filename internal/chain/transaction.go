@@ -1,29 +1,27 @@
 package chain
 
 import (
-	"fmt"
 	"math/big"
 
 	"storage-mining/configs"
-	"storage-mining/internal/logger"
+	"storage-mining/internal/chain/cess"
 	"storage-mining/tools"
 	"strconv"
-	"time"
 
-	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/pkg/errors"
 )
 
-// custom event type
-type Event_SegmentBook_ParamSet struct {
-	Phase     types.Phase
-	PeerId    types.U64
-	SegmentId types.U64
-	Random    types.U32
-	Topics    []types.Hash
-}
+// The events of the cess pallets, in the layout generated from the
+// runtime metadata
+type (
+	Event_SegmentBook_ParamSet = cess.Event_SegmentBook_ParamSet
+	Event_Sminer_TimedTask     = cess.Event_Sminer_TimedTask
+	Event_Sminer_Registered    = cess.Event_Sminer_Registered
+)
 
+// The submitted and verified events of the four proofs, which share the
+// layout of Event_SegmentBook_VPASubmitted
 type Event_VPABCD_Submit_Verify struct {
 	Phase     types.Phase
 	PeerId    types.U64
@@ -31,21 +29,9 @@ type Event_VPABCD_Submit_Verify struct {
 	Topics    []types.Hash
 }
 
-type Event_Sminer_TimedTask struct {
-	Phase  types.Phase
-	Topics []types.Hash
-}
-
-type Event_Sminer_Registered struct {
-	Phase   types.Phase
-	PeerAcc types.AccountID
-	Staking types.U128
-	Topics  []types.Hash
-}
-
 type MyEventRecords struct {
 	System_ExtrinsicSuccess  []types.EventSystemExtrinsicSuccess
-	System_ExtrinsicFailed   []types.EventSystemExtrinsicFailed
+	System_ExtrinsicFailed   []Event_System_ExtrinsicFailed
 	SegmentBook_ParamSet     []Event_SegmentBook_ParamSet
 	SegmentBook_VPASubmitted []Event_VPABCD_Submit_Verify
 	SegmentBook_VPBSubmitted []Event_VPABCD_Submit_Verify
@@ -57,22 +43,11 @@ type MyEventRecords struct {
 	SegmentBook_VPDVerified  []Event_VPABCD_Submit_Verify
 	Sminer_TimedTask         []Event_Sminer_TimedTask
 	Sminer_Registered        []Event_Sminer_Registered
+	Balances_Transfer        []types.EventBalancesTransfer
 }
 
 // miner register
-func RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr, TransactionName string, pledgeTokens uint64, port, fileport uint32) (bool, error) {
-	var (
-		err         error
-		accountInfo types.AccountInfo
-	)
-	api := getSubstrateAPI()
-	defer func() {
-		releaseSubstrateAPI()
-		err := recover()
-		if err != nil {
-			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
-		}
-	}()
+func RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr string, pledgeTokens uint64, port, fileport uint32) (bool, error) {
 	ipint, err := tools.InetAtoN(ipAddr)
 	if err != nil {
 		return false, errors.Wrap(err, "InetAtoN err")
@@ -86,14 +61,9 @@ func RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr, Tran
 	}
 	amount := types.NewUCompact(realTokens)
 
-	keyring, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
+	pub, err := accountPublicKey(identifyAccountPhrase)
 	if err != nil {
-		return false, errors.Wrap(err, "KeyringPairFromSecret err")
-	}
-
-	meta, err := api.RPC.State.GetMetadataLatest()
-	if err != nil {
-		return false, errors.Wrap(err, "GetMetadataLatest err")
+		return false, err
 	}
 
 	incomeAccount, err := types.NewMultiAddressFromHexAccountID(incomeAccountPublicKey)
@@ -101,713 +71,325 @@ func RegisterToChain(identifyAccountPhrase, incomeAccountPublicKey, ipAddr, Tran
 		return false, errors.Wrap(err, "NewMultiAddressFromHexAccountID err")
 	}
 
-	c, err := types.NewCall(meta, TransactionName, incomeAccount, types.NewU32(uint32(ipint)), types.NewU32(port), types.NewU32(fileport), amount)
-	if err != nil {
-		return false, errors.Wrap(err, "NewCall err")
-	}
-
-	ext := types.NewExtrinsic(c)
-	if err != nil {
-		return false, errors.Wrap(err, "NewExtrinsic err")
-	}
-
-	genesisHash, err := api.RPC.Chain.GetBlockHash(0)
-	if err != nil {
-		return false, errors.Wrap(err, "GetBlockHash err")
-	}
-
-	rv, err := api.RPC.State.GetRuntimeVersionLatest()
-	if err != nil {
-		return false, errors.Wrap(err, "GetRuntimeVersionLatest err")
-	}
-
-	key, err := types.CreateStorageKey(meta, "System", "Account", keyring.PublicKey)
-	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey System  Account err")
-	}
-
-	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
-	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey System Events err")
-	}
-
-	ok, err = api.RPC.State.GetStorageLatest(key, &accountInfo)
-	if err != nil {
-		return false, errors.Wrap(err, "GetStorageLatest err")
-	}
-	if !ok {
-		return false, errors.New("GetStorageLatest return value is empty")
-	}
-
-	o := types.SignatureOptions{
-		BlockHash:          genesisHash,
-		Era:                types.ExtrinsicEra{IsMortalEra: false},
-		GenesisHash:        genesisHash,
-		Nonce:              types.NewUCompactFromUInt(uint64(accountInfo.Nonce)),
-		SpecVersion:        rv.SpecVersion,
-		Tip:                types.NewUCompactFromUInt(0),
-		TransactionVersion: rv.TransactionVersion,
-	}
-
-	// Sign the transaction
-	err = ext.Sign(keyring, o)
-	if err != nil {
-		return false, errors.Wrap(err, "Sign err")
-	}
-
-	// Do the transfer and track the actual status
-	sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
-	if err != nil {
-		return false, errors.Wrap(err, "SubmitAndWatchExtrinsic err")
-	}
-	defer sub.Unsubscribe()
-
-	timeout := time.After(time.Second * configs.TimeToWaitEvents_S)
-	for {
-		select {
-		case status := <-sub.Chan():
-			if status.IsInBlock {
-				events := MyEventRecords{}
-				h, err := api.RPC.State.GetStorageRaw(keye, status.AsInBlock)
-				if err != nil {
-					return false, err
-				}
-				err = types.EventRecordsRaw(*h).DecodeEventRecords(meta, &events)
-				if err != nil {
-					fmt.Println("+++ DecodeEvent err: ", err)
-				}
-				if events.Sminer_Registered != nil {
-					for i := 0; i < len(events.Sminer_Registered); i++ {
-						if events.Sminer_Registered[i].PeerAcc == types.NewAccountID(keyring.PublicKey) {
-							return true, nil
-						}
-					}
+	call, args := cess.Call_Sminer_Regnstk(
+		incomeAccount,
+		types.NewU32(uint32(ipint)),
+		types.NewU32(port),
+		types.NewU32(fileport),
+		amount,
+	)
+	// the pledge is reserved from the account on top of the fee
+	receipt, err := submitSpending(
+		identifyAccountPhrase,
+		call,
+		realTokens,
+		func(events *MyEventRecords) bool {
+			for i := 0; i < len(events.Sminer_Registered); i++ {
+				if events.Sminer_Registered[i].PeerAcc == types.NewAccountID(pub) {
+					return true
 				}
-				return false, nil
 			}
-		case err = <-sub.Err():
-			return false, err
-		case <-timeout:
-			return false, errors.New("SubmitAndWatchExtrinsic timeout")
+			return false
+		},
+		args...,
+	)
+	if err != nil {
+		// the registration may have landed even though we stopped watching
+		if reconcileWithStorage(err, func() (bool, error) {
+			mdata, err := GetMinerDataOnChain(identifyAccountPhrase, configs.ChainModule_Sminer, configs.ChainModule_Sminer_MinerItems)
+			return mdata.Peerid > 0, err
+		}) {
+			return true, nil
 		}
+		return false, err
 	}
+	return receipt.Matched, nil
 }
 
 //
 func IntentSubmitToChain(identifyAccountPhrase, TransactionName string, segsizetype, segtype uint8, peerid uint64, unsealedcid [][]byte, hash, shardhash []byte) (uint64, uint32, error) {
 	var (
-		err         error
-		ok          bool
-		accountInfo types.AccountInfo
+		segmentid uint64
+		randnum   uint32
 	)
-	api := getSubstrateAPI()
-	defer func() {
-		releaseSubstrateAPI()
-		err := recover()
-		if err != nil {
-			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
-		}
-	}()
-	keyring, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "KeyringPairFromSecret err")
-	}
-
-	meta, err := api.RPC.State.GetMetadataLatest()
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "GetMetadataLatest err")
-	}
 	var uncid []types.Bytes = make([]types.Bytes, len(unsealedcid))
 	for i := 0; i < len(unsealedcid); i++ {
 		uncid[i] = make(types.Bytes, 0)
 		uncid[i] = append(uncid[i], unsealedcid[i]...)
 	}
-	c, err := types.NewCall(meta, TransactionName, types.NewU8(segsizetype), types.NewU8(segtype), types.NewU64(peerid), uncid, types.NewBytes(hash), types.NewBytes(shardhash))
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "NewCall err")
-	}
-
-	ext := types.NewExtrinsic(c)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "NewExtrinsic err")
-	}
-
-	genesisHash, err := api.RPC.Chain.GetBlockHash(0)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "GetBlockHash err")
-	}
-
-	rv, err := api.RPC.State.GetRuntimeVersionLatest()
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "GetRuntimeVersionLatest err")
-	}
-
-	key, err := types.CreateStorageKey(meta, "System", "Account", keyring.PublicKey)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "CreateStorageKey err")
-	}
-
-	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "CreateStorageKey System Events err")
-	}
-
-	ok, err = api.RPC.State.GetStorageLatest(key, &accountInfo)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "GetStorageLatest err")
-	}
-	if !ok {
-		return 0, 0, errors.New("GetStorageLatest return value is empty")
-	}
-
-	o := types.SignatureOptions{
-		BlockHash:          genesisHash,
-		Era:                types.ExtrinsicEra{IsMortalEra: false},
-		GenesisHash:        genesisHash,
-		Nonce:              types.NewUCompactFromUInt(uint64(accountInfo.Nonce)),
-		SpecVersion:        rv.SpecVersion,
-		Tip:                types.NewUCompactFromUInt(0),
-		TransactionVersion: rv.TransactionVersion,
-	}
-
-	// Sign the transaction
-	err = ext.Sign(keyring, o)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "Sign err")
-	}
-
-	// Do the transfer and track the actual status
-	sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
-	if err != nil {
-		return 0, 0, errors.Wrap(err, "SubmitAndWatchExtrinsic err")
-	}
-	defer sub.Unsubscribe()
-
-	timeout := time.After(time.Second * configs.TimeToWaitEvents_S)
-	for {
-		select {
-		case status := <-sub.Chan():
-			if status.IsInBlock {
-				events := MyEventRecords{}
-				h, err := api.RPC.State.GetStorageRaw(keye, status.AsInBlock)
-				if err != nil {
-					return 0, 0, err
-				}
-				err = types.EventRecordsRaw(*h).DecodeEventRecords(meta, &events)
-				if err != nil {
-					fmt.Println("+++ DecodeEvent err: ", err)
-				}
-				if events.SegmentBook_ParamSet != nil {
-					for i := 0; i < len(events.SegmentBook_ParamSet); i++ {
-						if events.SegmentBook_ParamSet[i].PeerId == types.NewU64(configs.MinerId_I) {
-							return uint64(events.SegmentBook_ParamSet[i].SegmentId), uint32(events.SegmentBook_ParamSet[i].Random), nil
-						}
-					}
+	item := paramSetOf(TransactionName, segtype)
+	before, _ := GetSeedNumOnChain(identifyAccountPhrase, configs.ChainModule_SegmentBook, item)
+	call, args := cess.Call_SegmentBook_IntentSubmit(
+		types.NewU8(segsizetype),
+		types.NewU8(segtype),
+		types.NewU64(peerid),
+		uncid,
+		types.NewBytes(hash),
+		types.NewBytes(shardhash),
+	)
+	_, err := submitExtrinsic(
+		identifyAccountPhrase,
+		call,
+		func(events *MyEventRecords) bool {
+			for i := 0; i < len(events.SegmentBook_ParamSet); i++ {
+				if events.SegmentBook_ParamSet[i].PeerId == types.NewU64(configs.MinerId_I) {
+					segmentid = uint64(events.SegmentBook_ParamSet[i].SegmentId)
+					randnum = uint32(events.SegmentBook_ParamSet[i].Random)
+					return true
 				}
-				return 0, 0, nil
 			}
-		case err = <-sub.Err():
-			return 0, 0, err
-		case <-timeout:
-			return 0, 0, errors.New("SubmitAndWatchExtrinsic timeout")
+			return false
+		},
+		args...,
+	)
+	if err != nil {
+		// the challenge of the intent is then in the ParamSet item
+		if p, ok := intentLanded(err, identifyAccountPhrase, item, before); ok {
+			return uint64(p.SegmentId), uint32(p.Rand), nil
 		}
+		return 0, 0, err
 	}
+	return segmentid, randnum, nil
 }
 
 //
 func IntentSubmitPostToChain(identifyAccountPhrase, TransactionName string, segmentid uint64, segsizetype, segtype uint8) (uint32, error) {
-	var (
-		err         error
-		ok          bool
-		accountInfo types.AccountInfo
-	)
-	api := getSubstrateAPI()
-	defer func() {
-		releaseSubstrateAPI()
-		err := recover()
-		if err != nil {
-			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
-		}
-	}()
-	keyring, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
-	if err != nil {
-		return 0, errors.Wrap(err, "KeyringPairFromSecret err")
-	}
-
-	meta, err := api.RPC.State.GetMetadataLatest()
-	if err != nil {
-		return 0, errors.Wrap(err, "GetMetadataLatest err")
-	}
-
-	c, err := types.NewCall(meta, TransactionName, types.NewU64(segmentid), types.NewU8(segsizetype), types.NewU8(segtype))
-	if err != nil {
-		return 0, errors.Wrap(err, "NewCall err")
-	}
-
-	ext := types.NewExtrinsic(c)
-	if err != nil {
-		return 0, errors.Wrap(err, "NewExtrinsic err")
-	}
-
-	genesisHash, err := api.RPC.Chain.GetBlockHash(0)
-	if err != nil {
-		return 0, errors.Wrap(err, "GetBlockHash err")
-	}
-
-	rv, err := api.RPC.State.GetRuntimeVersionLatest()
-	if err != nil {
-		return 0, errors.Wrap(err, "GetRuntimeVersionLatest err")
-	}
-
-	key, err := types.CreateStorageKey(meta, "System", "Account", keyring.PublicKey)
-	if err != nil {
-		return 0, errors.Wrap(err, "CreateStorageKey err")
-	}
-
-	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
-	if err != nil {
-		return 0, errors.Wrap(err, "CreateStorageKey System Events err")
-	}
-
-	ok, err = api.RPC.State.GetStorageLatest(key, &accountInfo)
-	if err != nil {
-		return 0, errors.Wrap(err, "GetStorageLatest err")
-	}
-	if !ok {
-		return 0, errors.New("GetStorageLatest return value is empty")
-	}
-
-	o := types.SignatureOptions{
-		BlockHash:          genesisHash,
-		Era:                types.ExtrinsicEra{IsMortalEra: false},
-		GenesisHash:        genesisHash,
-		Nonce:              types.NewUCompactFromUInt(uint64(accountInfo.Nonce)),
-		SpecVersion:        rv.SpecVersion,
-		Tip:                types.NewUCompactFromUInt(0),
-		TransactionVersion: rv.TransactionVersion,
-	}
-
-	// Sign the transaction
-	err = ext.Sign(keyring, o)
-	if err != nil {
-		return 0, errors.Wrap(err, "Sign err")
-	}
-
-	// Do the transfer and track the actual status
-	sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
-	if err != nil {
-		return 0, errors.Wrap(err, "SubmitAndWatchExtrinsic err")
-	}
-	defer sub.Unsubscribe()
-
-	timeout := time.After(time.Second * configs.TimeToWaitEvents_S)
-	for {
-		select {
-		case status := <-sub.Chan():
-			if status.IsInBlock {
-				events := MyEventRecords{}
-				h, err := api.RPC.State.GetStorageRaw(keye, status.AsInBlock)
-				if err != nil {
-					return 0, err
+	var randnum uint32
+	item := paramSetOf(TransactionName, segtype)
+	before, _ := GetSeedNumOnChain(identifyAccountPhrase, configs.ChainModule_SegmentBook, item)
+	call, args := cess.Call_SegmentBook_IntentSubmitPoSt(types.NewU64(segmentid), types.NewU8(segsizetype), types.NewU8(segtype))
+	_, err := submitExtrinsic(
+		identifyAccountPhrase,
+		call,
+		func(events *MyEventRecords) bool {
+			for i := 0; i < len(events.SegmentBook_ParamSet); i++ {
+				if events.SegmentBook_ParamSet[i].PeerId == types.NewU64(configs.MinerId_I) {
+					randnum = uint32(events.SegmentBook_ParamSet[i].Random)
+					return true
 				}
-				err = types.EventRecordsRaw(*h).DecodeEventRecords(meta, &events)
-				if err != nil {
-					fmt.Println("+++ DecodeEvent err: ", err)
-				}
-				if events.SegmentBook_ParamSet != nil {
-					for i := 0; i < len(events.SegmentBook_ParamSet); i++ {
-						if events.SegmentBook_ParamSet[i].PeerId == types.NewU64(configs.MinerId_I) {
-							return uint32(events.SegmentBook_ParamSet[i].Random), nil
-						}
-					}
-				}
-				return 0, nil
 			}
-		case err = <-sub.Err():
-			return 0, err
-		case <-timeout:
-			return 0, errors.New("SubmitAndWatchExtrinsic timeout")
+			return false
+		},
+		args...,
+	)
+	if err != nil {
+		if p, ok := intentLanded(err, identifyAccountPhrase, item, before); ok && uint64(p.SegmentId) == segmentid {
+			return uint32(p.Rand), nil
 		}
+		return 0, err
 	}
+	return randnum, nil
 }
 
 // Submit To Vpa or Vpb
 func SegmentSubmitToVpaOrVpb(identifyAccountPhrase, TransactionName string, peerid, segmentid uint64, proofs, cid []byte) (bool, error) {
-	var (
-		err         error
-		ok          bool
-		accountInfo types.AccountInfo
+	build := cess.Call_SegmentBook_SubmitToVpb
+	if TransactionName == configs.ChainTx_SegmentBook_SubmitToVpa {
+		build = cess.Call_SegmentBook_SubmitToVpa
+	}
+	call, args := build(types.NewU64(peerid), types.NewU64(segmentid), types.NewBytes(proofs), types.NewBytes(cid))
+	receipt, err := submitExtrinsic(
+		identifyAccountPhrase,
+		call,
+		func(events *MyEventRecords) bool {
+			switch TransactionName {
+			case configs.ChainTx_SegmentBook_SubmitToVpa:
+				return hasSegmentEvent(events.SegmentBook_VPASubmitted, segmentid)
+			case configs.ChainTx_SegmentBook_SubmitToVpb:
+				return hasSegmentEvent(events.SegmentBook_VPBSubmitted, segmentid)
+			}
+			return false
+		},
+		args...,
 	)
-	api := getSubstrateAPI()
-	defer func() {
-		releaseSubstrateAPI()
-		err := recover()
-		if err != nil {
-			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
-		}
-	}()
-	keyring, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
-	if err != nil {
-		return false, errors.Wrapf(err, "KeyringPairFromSecret err [%v]", TransactionName)
-	}
-
-	meta, err := api.RPC.State.GetMetadataLatest()
-	if err != nil {
-		return false, errors.Wrapf(err, "GetMetadataLatest err [%v]", TransactionName)
-	}
-
-	c, err := types.NewCall(meta, TransactionName, types.NewU64(peerid), types.NewU64(segmentid), types.NewBytes(proofs), types.NewBytes(cid))
 	if err != nil {
-		return false, errors.Wrapf(err, "NewCall err [%v]", TransactionName)
-	}
-
-	ext := types.NewExtrinsic(c)
-	if err != nil {
-		return false, errors.Wrap(err, "NewExtrinsic err")
-	}
-
-	genesisHash, err := api.RPC.Chain.GetBlockHash(0)
-	if err != nil {
-		return false, errors.Wrap(err, "GetBlockHash err")
-	}
-
-	rv, err := api.RPC.State.GetRuntimeVersionLatest()
-	if err != nil {
-		return false, errors.Wrap(err, "GetRuntimeVersionLatest err")
-	}
-
-	key, err := types.CreateStorageKey(meta, "System", "Account", keyring.PublicKey)
-	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey err")
-	}
-
-	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
-	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey System Events err")
-	}
-
-	ok, err = api.RPC.State.GetStorageLatest(key, &accountInfo)
-	if err != nil {
-		return false, errors.Wrap(err, "GetStorageLatest err")
-	}
-	if !ok {
-		return false, errors.New("GetStorageLatest return value is empty")
-	}
-
-	o := types.SignatureOptions{
-		BlockHash:          genesisHash,
-		Era:                types.ExtrinsicEra{IsMortalEra: false},
-		GenesisHash:        genesisHash,
-		Nonce:              types.NewUCompactFromUInt(uint64(accountInfo.Nonce)),
-		SpecVersion:        rv.SpecVersion,
-		Tip:                types.NewUCompactFromUInt(0),
-		TransactionVersion: rv.TransactionVersion,
-	}
-
-	// Sign the transaction
-	err = ext.Sign(keyring, o)
-	if err != nil {
-		return false, errors.Wrap(err, "Sign err")
-	}
-
-	// Do the transfer and track the actual status
-	sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
-	if err != nil {
-		return false, errors.Wrap(err, "SubmitAndWatchExtrinsic err")
-	}
-	defer sub.Unsubscribe()
-
-	timeout := time.After(time.Second * configs.TimeToWaitEvents_S)
-	for {
-		select {
-		case status := <-sub.Chan():
-			if status.IsInBlock {
-				events := MyEventRecords{}
-				h, err := api.RPC.State.GetStorageRaw(keye, status.AsInBlock)
-				if err != nil {
-					return false, err
-				}
-				err = types.EventRecordsRaw(*h).DecodeEventRecords(meta, &events)
-				if err != nil {
-					fmt.Println("+++ DecodeEvent err: ", err)
-				}
-				switch TransactionName {
-				case configs.ChainTx_SegmentBook_SubmitToVpa:
-					if events.SegmentBook_VPASubmitted != nil {
-						for i := 0; i < len(events.SegmentBook_VPASubmitted); i++ {
-							if events.SegmentBook_VPASubmitted[i].PeerId == types.NewU64(configs.MinerId_I) && events.SegmentBook_VPASubmitted[i].SegmentId == types.NewU64(segmentid) {
-								return true, nil
-							}
-						}
-					} else {
-						return false, nil
-					}
-				case configs.ChainTx_SegmentBook_SubmitToVpb:
-					if events.SegmentBook_VPBSubmitted != nil {
-						for i := 0; i < len(events.SegmentBook_VPBSubmitted); i++ {
-							if events.SegmentBook_VPBSubmitted[i].PeerId == types.NewU64(configs.MinerId_I) && events.SegmentBook_VPBSubmitted[i].SegmentId == types.NewU64(segmentid) {
-								return true, nil
-							}
-						}
-					} else {
-						return false, nil
+		var verified func() (bool, error)
+		pool := configs.ChainModule_SegmentBook_VerPoolB
+		if TransactionName == configs.ChainTx_SegmentBook_SubmitToVpa {
+			pool = configs.ChainModule_SegmentBook_VerPoolA
+			verified = func() (bool, error) {
+				data, err := GetVpaPostOnChain(identifyAccountPhrase, configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ConProofInfoA)
+				for i := 0; i < len(data); i++ {
+					if uint64(data[i].SegmentId) == segmentid {
+						return true, nil
 					}
 				}
-				return false, nil
+				return false, err
 			}
-		case err = <-sub.Err():
-			return false, err
-		case <-timeout:
-			return false, errors.New("SubmitAndWatchExtrinsic timeout")
 		}
+		if proofLanded(err, identifyAccountPhrase, pool, segmentid, verified) {
+			return true, nil
+		}
+		return false, err
 	}
+	return receipt.Matched, nil
 }
 
 // Submit To Vpc
-func SegmentSubmitToVpc(identifyAccountPhrase, TransactionName string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
-	var (
-		err         error
-		ok          bool
-		accountInfo types.AccountInfo
-	)
-	api := getSubstrateAPI()
-	defer func() {
-		releaseSubstrateAPI()
-		err := recover()
-		if err != nil {
-			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
-		}
-	}()
-	keyring, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
-	if err != nil {
-		return false, errors.Wrap(err, "KeyringPairFromSecret err")
-	}
-
-	meta, err := api.RPC.State.GetMetadataLatest()
-	if err != nil {
-		return false, errors.Wrap(err, "GetMetadataLatest err")
-	}
-
+func SegmentSubmitToVpc(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
 	var fileVpc []types.Bytes = make([]types.Bytes, len(proofs))
 	for i := 0; i < len(proofs); i++ {
 		fileVpc[i] = make(types.Bytes, 0)
 		fileVpc[i] = append(fileVpc[i], proofs[i]...)
 	}
-	// var sealedcid []types.Bytes = make([]types.Bytes, len(sealcid))
-	// for i := 0; i < len(sealcid); i++ {
-	// 	sealedcid[i] = make(types.Bytes, 0)
-	// 	sealedcid[i] = append(sealedcid[i], sealcid[i]...)
-	// }
-	c, err := types.NewCall(meta, TransactionName, types.NewU64(peerid), types.NewU64(segmentid), fileVpc, sealcid)
-	if err != nil {
-		return false, errors.Wrap(err, "NewCall err")
-	}
-
-	ext := types.NewExtrinsic(c)
-	if err != nil {
-		return false, errors.Wrap(err, "NewExtrinsic err")
-	}
-
-	genesisHash, err := api.RPC.Chain.GetBlockHash(0)
-	if err != nil {
-		return false, errors.Wrap(err, "GetBlockHash err")
-	}
-
-	rv, err := api.RPC.State.GetRuntimeVersionLatest()
-	if err != nil {
-		return false, errors.Wrap(err, "GetRuntimeVersionLatest err")
-	}
-
-	key, err := types.CreateStorageKey(meta, "System", "Account", keyring.PublicKey)
-	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey err")
-	}
-
-	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
-	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey System Events err")
-	}
-
-	ok, err = api.RPC.State.GetStorageLatest(key, &accountInfo)
-	if err != nil {
-		return false, errors.Wrap(err, "GetStorageLatest err")
-	}
-	if !ok {
-		return false, errors.New("GetStorageLatest return value is empty")
-	}
-
-	o := types.SignatureOptions{
-		BlockHash:          genesisHash,
-		Era:                types.ExtrinsicEra{IsMortalEra: false},
-		GenesisHash:        genesisHash,
-		Nonce:              types.NewUCompactFromUInt(uint64(accountInfo.Nonce)),
-		SpecVersion:        rv.SpecVersion,
-		Tip:                types.NewUCompactFromUInt(0),
-		TransactionVersion: rv.TransactionVersion,
-	}
-
-	// Sign the transaction
-	err = ext.Sign(keyring, o)
-	if err != nil {
-		return false, errors.Wrap(err, "Sign err")
-	}
-
-	// Do the transfer and track the actual status
-	sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
+	call, args := cess.Call_SegmentBook_SubmitToVpc(types.NewU64(peerid), types.NewU64(segmentid), fileVpc, sealcid)
+	receipt, err := submitExtrinsic(
+		identifyAccountPhrase,
+		call,
+		func(events *MyEventRecords) bool {
+			return hasSegmentEvent(events.SegmentBook_VPCSubmitted, segmentid)
+		},
+		args...,
+	)
 	if err != nil {
-		return false, errors.Wrap(err, "SubmitAndWatchExtrinsic err")
-	}
-	defer sub.Unsubscribe()
-
-	timeout := time.After(time.Second * configs.TimeToWaitEvents_S)
-	for {
-		select {
-		case status := <-sub.Chan():
-			if status.IsInBlock {
-				events := MyEventRecords{}
-				h, err := api.RPC.State.GetStorageRaw(keye, status.AsInBlock)
-				if err != nil {
-					return false, err
-				}
-				err = types.EventRecordsRaw(*h).DecodeEventRecords(meta, &events)
-				if err != nil {
-					fmt.Println("+++ DecodeEvent err: ", err)
+		if proofLanded(err, identifyAccountPhrase, configs.ChainModule_SegmentBook_VerPoolC, segmentid, func() (bool, error) {
+			data, err := GetVpcPostOnChain(identifyAccountPhrase, configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ConProofInfoC)
+			for i := 0; i < len(data); i++ {
+				if uint64(data[i].SegmentId) == segmentid {
+					return true, nil
 				}
-				if events.SegmentBook_VPCSubmitted != nil {
-					for i := 0; i < len(events.SegmentBook_VPCSubmitted); i++ {
-						if events.SegmentBook_VPCSubmitted[i].PeerId == types.NewU64(configs.MinerId_I) && events.SegmentBook_VPCSubmitted[i].SegmentId == types.NewU64(segmentid) {
-							return true, nil
-						}
-					}
-				}
-				return false, nil
 			}
-		case err = <-sub.Err():
 			return false, err
-		case <-timeout:
-			return false, errors.New("SubmitAndWatchExtrinsic timeout")
+		}) {
+			return true, nil
 		}
+		return false, err
 	}
+	return receipt.Matched, nil
 }
 
 // Submit To Vpd
-func SegmentSubmitToVpd(identifyAccountPhrase, TransactionName string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
-	var (
-		err         error
-		ok          bool
-		accountInfo types.AccountInfo
-	)
-	api := getSubstrateAPI()
-	defer func() {
-		releaseSubstrateAPI()
-		err := recover()
-		if err != nil {
-			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
-		}
-	}()
-	keyring, err := signature.KeyringPairFromSecret(identifyAccountPhrase, 0)
-	if err != nil {
-		return false, errors.Wrap(err, "KeyringPairFromSecret err")
-	}
-
-	meta, err := api.RPC.State.GetMetadataLatest()
-	if err != nil {
-		return false, errors.Wrap(err, "GetMetadataLatest err")
-	}
-
+func SegmentSubmitToVpd(identifyAccountPhrase string, peerid, segmentid uint64, proofs [][]byte, sealcid []types.Bytes) (bool, error) {
 	var fileVpd []types.Bytes = make([]types.Bytes, len(proofs))
 	for i := 0; i < len(proofs); i++ {
 		fileVpd[i] = make(types.Bytes, 0)
 		fileVpd[i] = append(fileVpd[i], proofs[i]...)
 	}
-	c, err := types.NewCall(meta, TransactionName, types.NewU64(peerid), types.NewU64(segmentid), fileVpd, sealcid)
+	call, args := cess.Call_SegmentBook_SubmitToVpd(types.NewU64(peerid), types.NewU64(segmentid), fileVpd, sealcid)
+	receipt, err := submitExtrinsic(
+		identifyAccountPhrase,
+		call,
+		func(events *MyEventRecords) bool {
+			return hasSegmentEvent(events.SegmentBook_VPDSubmitted, segmentid)
+		},
+		args...,
+	)
 	if err != nil {
-		return false, errors.Wrap(err, "NewCall err")
+		if proofLanded(err, identifyAccountPhrase, configs.ChainModule_SegmentBook_VerPoolD, segmentid, nil) {
+			return true, nil
+		}
+		return false, err
 	}
+	return receipt.Matched, nil
+}
 
-	ext := types.NewExtrinsic(c)
+// Leave the mining network, the collateral stays locked until the
+// lock-in period is over
+func ExitMining(identifyAccountPhrase string) (bool, error) {
+	call, args := cess.Call_Sminer_ExitMiner()
+	receipt, err := submitExtrinsic(identifyAccountPhrase, call, nil, args...)
 	if err != nil {
-		return false, errors.Wrap(err, "NewExtrinsic err")
+		return false, err
 	}
+	return receipt.Result.IsSuccess, nil
+}
 
-	genesisHash, err := api.RPC.Chain.GetBlockHash(0)
+// Update the service address of the miner
+func UpdateAddress(identifyAccountPhrase, ipAddr string, port, fileport uint32) (bool, error) {
+	ipint, err := tools.InetAtoN(ipAddr)
 	if err != nil {
-		return false, errors.Wrap(err, "GetBlockHash err")
+		return false, errors.Wrap(err, "InetAtoN err")
 	}
-
-	rv, err := api.RPC.State.GetRuntimeVersionLatest()
+	call, args := cess.Call_Sminer_UpdateIp(types.NewU32(uint32(ipint)), types.NewU32(port), types.NewU32(fileport))
+	receipt, err := submitExtrinsic(identifyAccountPhrase, call, nil, args...)
 	if err != nil {
-		return false, errors.Wrap(err, "GetRuntimeVersionLatest err")
+		return false, err
 	}
+	return receipt.Result.IsSuccess, nil
+}
 
-	key, err := types.CreateStorageKey(meta, "System", "Account", keyring.PublicKey)
+// Renewal tokens, add collateral in the smallest unit
+func RenewalTokens(identifyAccountPhrase string, tokens *big.Int) (bool, error) {
+	call, args := cess.Call_Sminer_IncreaseCollateral(types.NewUCompact(tokens))
+	receipt, err := submitSpending(identifyAccountPhrase, call, tokens, nil, args...)
 	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey err")
+		return false, err
 	}
+	return receipt.Result.IsSuccess, nil
+}
 
-	keye, err := types.CreateStorageKey(meta, "System", "Events", nil)
+// Withdraw the earnings to the beneficiary account
+func WithdrawEarnings(identifyAccountPhrase string) (TxReceipt, error) {
+	call, args := cess.Call_Sminer_WithdrawEarnings()
+	receipt, err := submitExtrinsic(identifyAccountPhrase, call, nil, args...)
 	if err != nil {
-		return false, errors.Wrap(err, "CreateStorageKey System Events err")
+		return receipt, err
+	}
+	if !receipt.Result.IsSuccess {
+		return receipt, errors.Errorf("[%v][%v] no success event", call, receipt.ExtrinsicHash.Hex())
 	}
+	return receipt, nil
+}
 
-	ok, err = api.RPC.State.GetStorageLatest(key, &accountInfo)
+// Withdraw the collateral of an exited miner
+func Withdraw(identifyAccountPhrase string) (bool, error) {
+	call, args := cess.Call_Sminer_Withdraw()
+	receipt, err := submitExtrinsic(identifyAccountPhrase, call, nil, args...)
 	if err != nil {
-		return false, errors.Wrap(err, "GetStorageLatest err")
-	}
-	if !ok {
-		return false, errors.New("GetStorageLatest return value is empty")
+		return false, err
 	}
+	return receipt.Result.IsSuccess, nil
+}
 
-	o := types.SignatureOptions{
-		BlockHash:          genesisHash,
-		Era:                types.ExtrinsicEra{IsMortalEra: false},
-		GenesisHash:        genesisHash,
-		Nonce:              types.NewUCompactFromUInt(uint64(accountInfo.Nonce)),
-		SpecVersion:        rv.SpecVersion,
-		Tip:                types.NewUCompactFromUInt(0),
-		TransactionVersion: rv.TransactionVersion,
-	}
+// Dry run the withdrawal of the collateral, see dryRunCall
+func CheckWithdraw(identifyAccountPhrase string) (bool, error) {
+	call, args := cess.Call_Sminer_Withdraw()
+	return dryRunCall(identifyAccountPhrase, call, args...)
+}
 
-	// Sign the transaction
-	err = ext.Sign(keyring, o)
-	if err != nil {
-		return false, errors.Wrap(err, "Sign err")
+// The ParamSet item of the SegmentBook that holds the challenge of an intent
+func paramSetOf(TransactionName string, segtype uint8) string {
+	switch {
+	case TransactionName == configs.ChainTx_SegmentBook_IntentSubmit:
+		return configs.ChainModule_SegmentBook_ParamSetA
+	case segtype == 1:
+		return configs.ChainModule_SegmentBook_ParamSetB
 	}
+	return configs.ChainModule_SegmentBook_ParamSetD
+}
 
-	// Do the transfer and track the actual status
-	sub, err := api.RPC.Author.SubmitAndWatchExtrinsic(ext)
-	if err != nil {
-		return false, errors.Wrap(err, "SubmitAndWatchExtrinsic err")
-	}
-	defer sub.Unsubscribe()
+// Check the ParamSet item when an intent could not be reconciled through
+// its extrinsic hash. The intent landed if the challenge differs from the
+// one read before it was submitted.
+func intentLanded(err error, identifyAccountPhrase, item string, before ParamInfo) (ParamInfo, bool) {
+	var p ParamInfo
+	ok := reconcileWithStorage(err, func() (bool, error) {
+		var err error
+		p, err = GetSeedNumOnChain(identifyAccountPhrase, configs.ChainModule_SegmentBook, item)
+		return err == nil && p != before, err
+	})
+	return p, ok
+}
 
-	timeout := time.After(time.Second * configs.TimeToWaitEvents_S)
-	for {
-		select {
-		case status := <-sub.Chan():
-			if status.IsInBlock {
-				events := MyEventRecords{}
-				h, err := api.RPC.State.GetStorageRaw(keye, status.AsInBlock)
-				if err != nil {
-					return false, err
-				}
-				err = types.EventRecordsRaw(*h).DecodeEventRecords(meta, &events)
-				if err != nil {
-					fmt.Println("+++ DecodeEvent err: ", err)
-				}
-				if events.SegmentBook_VPDSubmitted != nil {
-					for i := 0; i < len(events.SegmentBook_VPDSubmitted); i++ {
-						if events.SegmentBook_VPDSubmitted[i].PeerId == types.NewU64(configs.MinerId_I) && events.SegmentBook_VPDSubmitted[i].SegmentId == types.NewU64(segmentid) {
-							return true, nil
-						}
-					}
-				}
-				return false, nil
-			}
-		case err = <-sub.Err():
-			return false, err
-		case <-timeout:
-			return false, errors.New("SubmitAndWatchExtrinsic timeout")
+// Check the storage when a proof could not be reconciled through its
+// extrinsic hash. The proof landed if it waits in the verification pool,
+// or, when verified is given, was verified already.
+func proofLanded(err error, identifyAccountPhrase, pool string, segmentid uint64, verified func() (bool, error)) bool {
+	return reconcileWithStorage(err, func() (bool, error) {
+		ok, err := GetProofSubmittedOnChain(identifyAccountPhrase, configs.ChainModule_SegmentBook, pool, segmentid)
+		if ok || verified == nil {
+			return ok, err
+		}
+		return verified()
+	})
+}
+
+// Whether the events contain our peer id and the segment id
+func hasSegmentEvent(events []Event_VPABCD_Submit_Verify, segmentid uint64) bool {
+	for i := 0; i < len(events); i++ {
+		if events[i].PeerId == types.NewU64(configs.MinerId_I) && events[i].SegmentId == types.NewU64(segmentid) {
+			return true
 		}
 	}
+	return false
 }
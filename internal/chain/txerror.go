@@ -0,0 +1,97 @@
+package chain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Transaction outcomes reported by TxError
+const (
+	TxStatus_Dropped         = "Dropped"
+	TxStatus_Usurped         = "Usurped"
+	TxStatus_Invalid         = "Invalid"
+	TxStatus_FinalityTimeout = "FinalityTimeout"
+	TxStatus_Retracted       = "Retracted"
+	TxStatus_Timeout         = "Timeout"
+	TxStatus_WatchLost       = "WatchLost"
+	TxStatus_Refused         = "Refused"
+)
+
+// Resubmission of retryable outcomes
+const (
+	maxTxRetry     = 3
+	txRetryBackoff = time.Second * 3
+)
+
+// A transaction that left the pool, or was given up on, without being
+// confirmed. Retryable outcomes are resubmitted by submitExtrinsic
+// before they reach the caller.
+type TxError struct {
+	Call      string
+	Hash      types.Hash
+	Status    string
+	Retryable bool
+	Err       error
+}
+
+func (e *TxError) Error() string {
+	s := fmt.Sprintf("[%v][%v] %v", e.Call, e.Hash.Hex(), e.Status)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// Whether err is a transaction outcome worth resubmitting
+func IsRetryable(err error) bool {
+	var txErr *TxError
+	return errors.As(err, &txErr) && txErr.Retryable
+}
+
+// Whether a retryable outcome left the nonce of the extrinsic unused, so
+// the same signed extrinsic can be sent again. A nonce that was usurped,
+// or an extrinsic the pool refused to take back, needs a new signature.
+func IsResendable(err error) bool {
+	status := TxStatusOf(err)
+	return status != TxStatus_Usurped && status != TxStatus_Refused
+}
+
+// Get the transaction status of err, or "" if it is not a TxError
+func TxStatusOf(err error) string {
+	var txErr *TxError
+	if errors.As(err, &txErr) {
+		return txErr.Status
+	}
+	return ""
+}
+
+// Classify a status that ends the watch without a confirmation.
+// Returns nil for Future, Ready, Broadcast, InBlock, Retracted and
+// Finalized, which are progress reports handled by the caller.
+//
+//	Dropped:         the pool was full, the extrinsic can be sent again
+//	Usurped:         another extrinsic took our nonce, re-sign and send again
+//	Invalid:         the runtime no longer accepts it, terminal
+//	FinalityTimeout: the inclusion block was not finalized in time, terminal
+func statusError(status types.ExtrinsicStatus, callName string, extHash types.Hash) *TxError {
+	switch {
+	case status.IsDropped:
+		return &TxError{Call: callName, Hash: extHash, Status: TxStatus_Dropped, Retryable: true}
+	case status.IsUsurped:
+		return &TxError{Call: callName, Hash: extHash, Status: TxStatus_Usurped, Retryable: true,
+			Err: errors.Errorf("replaced by %v", status.AsUsurped.Hex())}
+	case status.IsInvalid:
+		return &TxError{Call: callName, Hash: extHash, Status: TxStatus_Invalid}
+	case status.IsFinalityTimeout:
+		return &TxError{Call: callName, Hash: extHash, Status: TxStatus_FinalityTimeout,
+			Err: errors.Errorf("block %v", status.AsFinalityTimeout.Hex())}
+	}
+	return nil
+}
@@ -0,0 +1,556 @@
+package chaingen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+// Runtime types with a hand-written counterpart in gsrpc
+var knownPaths = map[string]string{
+	"sp_core::crypto::AccountId32":           "types.AccountID",
+	"primitive_types::H256":                  "types.Hash",
+	"sp_runtime::multiaddress::MultiAddress": "types.MultiAddress",
+}
+
+// Read a metadata blob as returned by state_getMetadata, either hex
+// encoded or raw
+func LoadMetadata(path string) (*types.Metadata, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile err")
+	}
+	var meta types.Metadata
+	s := strings.TrimSpace(string(b))
+	if strings.HasPrefix(s, "0x") {
+		err = types.DecodeFromHexString(s, &meta)
+	} else {
+		err = types.DecodeFromBytes(b, &meta)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "decode metadata %v err", path)
+	}
+	if meta.Version != 14 {
+		return nil, errors.Errorf("metadata V%v, V14 is required", meta.Version)
+	}
+	return &meta, nil
+}
+
+type generator struct {
+	meta *types.MetadataV14
+	// name of the generated type by type id
+	names map[int64]string
+	taken map[string]int64
+	// ids being resolved, against types that contain themselves
+	stack    map[int64]bool
+	defs     bytes.Buffer
+	variants bool
+	storage  bool
+}
+
+// Generate the Go source of package pkg with the types, storage accessors,
+// call builders and event structs of the given pallets
+func Generate(meta *types.Metadata, pkg string, pallets []string) ([]byte, error) {
+	if meta.Version != 14 {
+		return nil, errors.Errorf("metadata V%v, V14 is required", meta.Version)
+	}
+	g := &generator{
+		meta:  &meta.AsMetadataV14,
+		names: make(map[int64]string),
+		taken: make(map[string]int64),
+		stack: make(map[int64]bool),
+	}
+	var body, records bytes.Buffer
+	for _, name := range pallets {
+		p, ok := g.pallet(name)
+		if !ok {
+			return nil, errors.Errorf("pallet %v not in the metadata, which has %v", name, strings.Join(palletNames(g.meta), ", "))
+		}
+		fmt.Fprintf(&body, "\n// ---- %v, pallet index %v ----\n", p.Name, p.Index)
+		err := g.calls(&body, p)
+		if err == nil {
+			err = g.storageItems(&body, p)
+		}
+		if err == nil {
+			err = g.events(&body, &records, p)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "pallet %v", name)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by chaingen from the runtime metadata. DO NOT EDIT.\n\npackage %v\n\nimport (\n", pkg)
+	if g.variants {
+		fmt.Fprintf(&out, "\t\"fmt\"\n\n\t\"github.com/centrifuge/go-substrate-rpc-client/v4/scale\"\n")
+	}
+	if g.storage {
+		fmt.Fprintf(&out, "\tgsrpc \"github.com/centrifuge/go-substrate-rpc-client/v4\"\n")
+	}
+	fmt.Fprintf(&out, "\t\"github.com/centrifuge/go-substrate-rpc-client/v4/types\"\n)\n")
+	out.Write(body.Bytes())
+	fmt.Fprintf(&out, "\n// The events of the generated pallets, by pallet and event name\ntype EventRecords struct {\n%v}\n", records.String())
+	if g.defs.Len() > 0 {
+		fmt.Fprintf(&out, "\n// ---- runtime types ----\n")
+		out.Write(g.defs.Bytes())
+	}
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "format generated source err")
+	}
+	return src, nil
+}
+
+func (g *generator) pallet(name string) (*types.PalletMetadataV14, bool) {
+	for i := range g.meta.Pallets {
+		if string(g.meta.Pallets[i].Name) == name {
+			return &g.meta.Pallets[i], true
+		}
+	}
+	return nil, false
+}
+
+func (g *generator) lookup(id int64) (*types.Si1Type, error) {
+	t, ok := g.meta.EfficientLookup[id]
+	if !ok {
+		return nil, errors.Errorf("unknown type %v", id)
+	}
+	return t, nil
+}
+
+// Call builders returning the call name and its arguments in order, for
+// types.NewCall and the submission of the chain package
+func (g *generator) calls(w *bytes.Buffer, p *types.PalletMetadataV14) error {
+	if !p.HasCalls {
+		return nil
+	}
+	t, err := g.lookup(p.Calls.Type.Int64())
+	if err != nil || !t.Def.IsVariant {
+		return errors.Errorf("no call type")
+	}
+	for _, v := range t.Def.Variant.Variants {
+		var params, args []string
+		used := map[string]bool{}
+		for k, f := range v.Fields {
+			typ, err := g.goType(f.Type.Int64(), true)
+			if err != nil {
+				return errors.Wrapf(err, "call %v", v.Name)
+			}
+			name := unique(paramName(string(f.Name), k), used)
+			params = append(params, name+" "+typ)
+			args = append(args, name)
+		}
+		call := fmt.Sprintf("%v.%v", p.Name, v.Name)
+		writeDocs(w, call, v.Docs)
+		fmt.Fprintf(w, "func Call_%v_%v(%v) (string, []interface{}) {\n\treturn %q, []interface{}{%v}\n}\n\n",
+			p.Name, exported(string(v.Name)), strings.Join(params, ", "), call, strings.Join(args, ", "))
+	}
+	return nil
+}
+
+// Storage accessors, one key parameter per hasher of a map
+func (g *generator) storageItems(w *bytes.Buffer, p *types.PalletMetadataV14) error {
+	if !p.HasStorage {
+		return nil
+	}
+	for _, item := range p.Storage.Items {
+		var keys []int64
+		value := item.Type.AsPlainType
+		if item.Type.IsMap {
+			value = item.Type.AsMap.Value
+			keys = append(keys, item.Type.AsMap.Key.Int64())
+			if len(item.Type.AsMap.Hashers) > 1 {
+				t, err := g.lookup(keys[0])
+				if err != nil || !t.Def.IsTuple || len(t.Def.Tuple) != len(item.Type.AsMap.Hashers) {
+					return errors.Errorf("storage %v: keys do not match the hashers", item.Name)
+				}
+				keys = keys[:0]
+				for _, k := range t.Def.Tuple {
+					keys = append(keys, k.Int64())
+				}
+			}
+		}
+		typ, err := g.goType(value.Int64(), true)
+		if err != nil {
+			return errors.Wrapf(err, "storage %v", item.Name)
+		}
+		var params, encode, args []string
+		for k, id := range keys {
+			kt, err := g.goType(id, true)
+			if err != nil {
+				return errors.Wrapf(err, "storage %v key", item.Name)
+			}
+			params = append(params, fmt.Sprintf("key%v %v", k, kt))
+			encode = append(encode, fmt.Sprintf("k%v, err := types.EncodeToBytes(key%v)\n\tif err != nil {\n\t\treturn v, false, err\n\t}\n", k, k))
+			args = append(args, fmt.Sprintf(", k%v", k))
+		}
+		g.storage = true
+		writeDocs(w, fmt.Sprintf("%v.%v, ok is false when it is not set", p.Name, item.Name), item.Documentation)
+		fmt.Fprintf(w, "func Get_%v_%v(api *gsrpc.SubstrateAPI, meta *types.Metadata%v) (v %v, ok bool, err error) {\n",
+			p.Name, item.Name, prefixComma(params), typ)
+		fmt.Fprintf(w, "\t%vkey, err := types.CreateStorageKey(meta, %q, %q%v)\n", strings.Join(encode, "\t"), p.Storage.Prefix, item.Name, strings.Join(args, ""))
+		fmt.Fprintf(w, "\tif err != nil {\n\t\treturn v, false, err\n\t}\n\tok, err = api.RPC.State.GetStorageLatest(key, &v)\n\treturn v, ok, err\n}\n\n")
+	}
+	return nil
+}
+
+// Event structs in the layout of types.EventRecordsRaw: phase, fields, topics
+func (g *generator) events(w, records *bytes.Buffer, p *types.PalletMetadataV14) error {
+	if !p.HasEvents {
+		return nil
+	}
+	t, err := g.lookup(p.Events.Type.Int64())
+	if err != nil || !t.Def.IsVariant {
+		return errors.Errorf("no event type")
+	}
+	for _, v := range t.Def.Variant.Variants {
+		name := fmt.Sprintf("%v_%v", p.Name, v.Name)
+		used := map[string]bool{"Phase": true, "Topics": true}
+		var fields []string
+		for k, f := range v.Fields {
+			typ, err := g.goType(f.Type.Int64(), true)
+			if err != nil {
+				return errors.Wrapf(err, "event %v", v.Name)
+			}
+			fname := string(f.Name)
+			if !f.HasName {
+				fname = typeFieldName(string(f.TypeName))
+			}
+			fields = append(fields, fmt.Sprintf("\t%v %v\n", unique(fieldName(fname, k), used), typ))
+		}
+		writeDocs(w, fmt.Sprintf("%v.%v", p.Name, v.Name), v.Docs)
+		fmt.Fprintf(w, "type Event_%v struct {\n\tPhase types.Phase\n%v\tTopics []types.Hash\n}\n\n", name, strings.Join(fields, ""))
+		fmt.Fprintf(records, "\t%v []Event_%v\n", name, name)
+	}
+	return nil
+}
+
+// The Go type of a runtime type. Composites and enums become named types;
+// direct tells that the value is held in place rather than in a sequence.
+func (g *generator) goType(id int64, direct bool) (string, error) {
+	t, err := g.lookup(id)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := knownPaths[pathString(t.Path)]; ok {
+		return v, nil
+	}
+	def := t.Def
+	switch {
+	case def.IsComposite:
+		fields := def.Composite.Fields
+		if len(fields) == 0 {
+			return "struct{}", nil
+		}
+		// a new type is the type it wraps
+		if len(fields) == 1 && !fields[0].HasName {
+			return g.goType(fields[0].Type.Int64(), direct)
+		}
+		return g.named(id, t, direct)
+	case def.IsVariant:
+		return g.named(id, t, direct)
+	case def.IsSequence:
+		if g.isU8(def.Sequence.Type.Int64()) {
+			return "types.Bytes", nil
+		}
+		elem, err := g.goType(def.Sequence.Type.Int64(), false)
+		return "[]" + elem, err
+	case def.IsArray:
+		if g.isU8(def.Array.Type.Int64()) {
+			return fmt.Sprintf("[%v]byte", def.Array.Len), nil
+		}
+		elem, err := g.goType(def.Array.Type.Int64(), direct)
+		return fmt.Sprintf("[%v]%v", def.Array.Len, elem), err
+	case def.IsTuple:
+		if len(def.Tuple) == 0 {
+			return "struct{}", nil
+		}
+		var fields []string
+		for k, e := range def.Tuple {
+			elem, err := g.goType(e.Int64(), direct)
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, fmt.Sprintf("F%v %v", k, elem))
+		}
+		return "struct{ " + strings.Join(fields, "; ") + " }", nil
+	case def.IsPrimitive:
+		return primitiveType(def.Primitive.Si0TypeDefPrimitive)
+	case def.IsCompact:
+		return "types.UCompact", nil
+	}
+	return "", errors.Errorf("unsupported definition of type %v %v", id, pathString(t.Path))
+}
+
+func (g *generator) isU8(id int64) bool {
+	t, ok := g.meta.EfficientLookup[id]
+	return ok && t.Def.IsPrimitive && t.Def.Primitive.Si0TypeDefPrimitive == types.IsU8
+}
+
+// Name and define a struct or enum type once
+func (g *generator) named(id int64, t *types.Si1Type, direct bool) (string, error) {
+	if name, ok := g.names[id]; ok {
+		if g.stack[id] && direct {
+			return "", errors.Errorf("type %v contains itself", name)
+		}
+		return name, nil
+	}
+	name, err := g.typeName(id, t)
+	if err != nil {
+		return "", err
+	}
+	g.names[id] = name
+	g.taken[name] = id
+	g.stack[id] = true
+	defer delete(g.stack, id)
+
+	var def bytes.Buffer
+	writeDocs(&def, fmt.Sprintf("%v, %v", name, pathString(t.Path)), t.Docs)
+	if t.Def.IsComposite {
+		fields, err := g.structFields(t.Def.Composite.Fields)
+		if err != nil {
+			return "", errors.Wrapf(err, "type %v", name)
+		}
+		fmt.Fprintf(&def, "type %v struct {\n%v}\n\n", name, fields)
+	} else {
+		err = g.enum(&def, name, t.Def.Variant.Variants)
+		if err != nil {
+			return "", errors.Wrapf(err, "type %v", name)
+		}
+	}
+	g.defs.Write(def.Bytes())
+	return name, nil
+}
+
+func (g *generator) structFields(fields []types.Si1Field) (string, error) {
+	var b strings.Builder
+	used := map[string]bool{}
+	for k, f := range fields {
+		typ, err := g.goType(f.Type.Int64(), true)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "\t%v %v\n", unique(fieldName(string(f.Name), k), used), typ)
+	}
+	return b.String(), nil
+}
+
+// An enum in the style of types.Phase: an IsX flag per variant and an AsX
+// value for the variants with fields, with its own Decode and Encode
+func (g *generator) enum(w *bytes.Buffer, name string, variants []types.Si1Variant) error {
+	g.variants = true
+	var fields, dec, enc strings.Builder
+	for _, v := range variants {
+		vn := exported(string(v.Name))
+		fmt.Fprintf(&fields, "\tIs%v bool\n", vn)
+		fmt.Fprintf(&dec, "\tcase %v:\n\t\tv.Is%v = true\n", v.Index, vn)
+		fmt.Fprintf(&enc, "\tcase v.Is%v:\n", vn)
+		if len(v.Fields) == 0 {
+			fmt.Fprintf(&dec, "\t\treturn nil\n")
+			fmt.Fprintf(&enc, "\t\treturn e.PushByte(%v)\n", v.Index)
+			continue
+		}
+		var typ string
+		var err error
+		if len(v.Fields) == 1 && !v.Fields[0].HasName {
+			typ, err = g.goType(v.Fields[0].Type.Int64(), true)
+		} else {
+			typ, err = g.structFields(v.Fields)
+			typ = "struct {\n" + typ + "}"
+		}
+		if err != nil {
+			return errors.Wrapf(err, "variant %v", v.Name)
+		}
+		fmt.Fprintf(&fields, "\tAs%v %v\n", vn, typ)
+		fmt.Fprintf(&dec, "\t\treturn d.Decode(&v.As%v)\n", vn)
+		fmt.Fprintf(&enc, "\t\terr := e.PushByte(%v)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\treturn e.Encode(v.As%v)\n", v.Index, vn)
+	}
+	fmt.Fprintf(w, "type %v struct {\n%v}\n\n", name, fields.String())
+	fmt.Fprintf(w, "func (v *%v) Decode(d scale.Decoder) error {\n\tb, err := d.ReadOneByte()\n\tif err != nil {\n\t\treturn err\n\t}\n\tswitch b {\n%v\t}\n\treturn fmt.Errorf(\"unknown variant %%v of %v\", b)\n}\n\n", name, dec.String(), name)
+	fmt.Fprintf(w, "func (v %v) Encode(e scale.Encoder) error {\n\tswitch {\n%v\t}\n\treturn fmt.Errorf(\"no variant of %v set\")\n}\n\n", name, enc.String(), name)
+	return nil
+}
+
+// The last segment of the path, qualified with the parameters of a generic
+// type, its module or its type id while the name is taken
+func (g *generator) typeName(id int64, t *types.Si1Type) (string, error) {
+	base := fmt.Sprintf("Type%v", id)
+	if len(t.Path) > 0 {
+		base = exported(string(t.Path[len(t.Path)-1]))
+	}
+	var params []string
+	for _, p := range t.Params {
+		if !p.HasType {
+			continue
+		}
+		typ, err := g.goType(p.Type.Int64(), false)
+		if err != nil {
+			return "", err
+		}
+		params = append(params, identOf(typ))
+	}
+	candidates := []string{base}
+	if len(params) > 0 {
+		candidates = append(candidates, base+"_"+strings.Join(params, "_"))
+	}
+	if len(t.Path) > 1 {
+		candidates = append(candidates, exported(string(t.Path[len(t.Path)-2]))+base)
+	}
+	candidates = append(candidates, fmt.Sprintf("%v_%v", base, id))
+	for _, name := range candidates {
+		if _, ok := g.taken[name]; !ok && !reserved[name] {
+			return name, nil
+		}
+	}
+	return "", errors.Errorf("no name for type %v", id)
+}
+
+// Names of the generated declarations other than the runtime types
+var reserved = map[string]bool{"EventRecords": true}
+
+func primitiveType(p types.Si0TypeDefPrimitive) (string, error) {
+	switch p {
+	case types.IsBool:
+		return "types.Bool", nil
+	case types.IsChar, types.IsU32:
+		return "types.U32", nil
+	case types.IsStr:
+		return "types.Text", nil
+	case types.IsU8:
+		return "types.U8", nil
+	case types.IsU16:
+		return "types.U16", nil
+	case types.IsU64:
+		return "types.U64", nil
+	case types.IsU128:
+		return "types.U128", nil
+	case types.IsU256:
+		return "types.U256", nil
+	case types.IsI8:
+		return "types.I8", nil
+	case types.IsI16:
+		return "types.I16", nil
+	case types.IsI32:
+		return "types.I32", nil
+	case types.IsI64:
+		return "types.I64", nil
+	case types.IsI128:
+		return "types.I128", nil
+	case types.IsI256:
+		return "types.I256", nil
+	}
+	return "", errors.Errorf("unsupported primitive %v", p)
+}
+
+func pathString(p types.Si1Path) string {
+	s := make([]string, len(p))
+	for i := range p {
+		s[i] = string(p[i])
+	}
+	return strings.Join(s, "::")
+}
+
+// peer_id -> PeerId
+func exported(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+// An identifier made of a Go type, e.g. []types.U64 -> VecU64
+func identOf(typ string) string {
+	typ = strings.ReplaceAll(typ, "types.", "")
+	typ = strings.ReplaceAll(typ, "[]", "Vec")
+	var b strings.Builder
+	for _, r := range typ {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func fieldName(name string, k int) string {
+	s := exported(name)
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		return fmt.Sprintf("F%v", k)
+	}
+	return s
+}
+
+// T::AccountId -> AccountId, BalanceOf<T> -> BalanceOf
+func typeFieldName(typeName string) string {
+	if i := strings.IndexAny(typeName, "<([;"); i >= 0 {
+		typeName = typeName[:i]
+	}
+	if i := strings.LastIndex(typeName, "::"); i >= 0 {
+		typeName = typeName[i+2:]
+	}
+	return typeName
+}
+
+func paramName(name string, k int) string {
+	s := exported(name)
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		return fmt.Sprintf("arg%v", k)
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	s = string(r)
+	if token.IsKeyword(s) || s == "api" || s == "meta" {
+		s += "_"
+	}
+	return s
+}
+
+func unique(name string, used map[string]bool) string {
+	s := name
+	for i := 2; used[s]; i++ {
+		s = fmt.Sprintf("%v%v", name, i)
+	}
+	used[s] = true
+	return s
+}
+
+func prefixComma(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(list, ", ")
+}
+
+// The title and the first line of the runtime docs
+func writeDocs(w *bytes.Buffer, title string, docs []types.Text) {
+	fmt.Fprintf(w, "// %v\n", title)
+	for _, d := range docs {
+		if s := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(d)), "\n", 2)[0]); s != "" {
+			fmt.Fprintf(w, "//\n// %v\n", s)
+			break
+		}
+	}
+}
+
+// Pallet names of the metadata, for the error of a missing pallet
+func palletNames(meta *types.MetadataV14) []string {
+	var names []string
+	for _, p := range meta.Pallets {
+		names = append(names, string(p.Name))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,151 @@
+package chaingen
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+var update = flag.Bool("update", false, "write the generated source to the golden file")
+
+// A Demo pallet with the kinds of types the cess pallets use, and an
+// Other pallet that is not generated
+func demoMetadata() *fixture {
+	f := newFixture()
+	u8, u32, u64, u128 := f.prim(types.IsU8), f.prim(types.IsU32), f.prim(types.IsU64), f.prim(types.IsU128)
+	account := f.accountID()
+
+	pair := f.add("demo::Pair", []string{"pallet_demo", "Pair"}, types.Si1TypeDef{
+		IsComposite: true,
+		Composite:   types.Si1TypeDefComposite{Fields: namedFields("first", u64, "second", u64)},
+	}, types.Si1TypeParameter{Name: "T", HasType: true, Type: typeID(u64)})
+	otherPair := f.composite([]string{"pallet_other", "Pair"}, "left", u32, "right", u32)
+	state := f.enum("demo::State", []string{"pallet_demo", "State"},
+		variant("Idle", 0),
+		types.Si1Variant{Name: "Active", Fields: []types.Si1Field{unnamed(u32)}, Index: 1},
+		variant("Exiting", 2, "since", u32, "reason", f.bytes()),
+	)
+	info := f.composite([]string{"pallet_demo", "MinerInfo"},
+		"peer_id", u64,
+		"beneficiary", account,
+		"state", state,
+		"pair", pair,
+		"hash", f.array(32, u8),
+		"collaterals", u128,
+	)
+
+	calls := f.enum("demo::Call", []string{"pallet_demo", "pallet", "Call"},
+		variant("register", 0, "beneficiary", f.multiAddress(), "ip", u32, "staking", f.compact(u128)),
+		variant("submit_proof", 1, "segment_id", u64, "proofs", f.vec(f.bytes()), "type", u8),
+		variant("exit", 2),
+	)
+	events := f.enum("demo::Event", []string{"pallet_demo", "pallet", "Event"},
+		variant("Registered", 0, "peer_acc", account, "staking", u128),
+		types.Si1Variant{Name: "Submitted", Fields: []types.Si1Field{typed(account, "T::AccountId"), unnamed(u64)}, Index: 1},
+		variant("TimedTask", 2),
+	)
+	f.pallet("Demo", 10, calls, events,
+		plain("Count", u32),
+		storageMap("Miners", account, info, 1),
+		storageMap("Proofs", f.tuple(account, u64), f.bytes(), 2),
+		storageMap("Pairs", u64, f.tuple(u64, otherPair), 1),
+	)
+
+	otherCalls := f.enum("other::Call", []string{"pallet_other", "pallet", "Call"}, variant("noop", 0))
+	f.pallet("Other", 11, otherCalls, -1, plain("Flag", f.prim(types.IsBool)))
+	return f
+}
+
+func generateDemo(t *testing.T) []byte {
+	_, meta, err := demoMetadata().metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := Generate(meta, "golden", []string{"Demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestGenerateGolden(t *testing.T) {
+	src := generateDemo(t)
+	if again := generateDemo(t); !bytes.Equal(src, again) {
+		t.Fatal("two runs generate different sources")
+	}
+
+	golden := filepath.Join("testdata", "golden", "runtime_gen.go")
+	if *update {
+		err := ioutil.WriteFile(golden, src, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Fatalf("the generated source differs from %v, run go test -update to accept it:\n%s", golden, src)
+	}
+
+	if testing.Short() {
+		t.Skip("compiling the golden file")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command to compile the golden file")
+	}
+	out, err := exec.Command("go", "build", "./"+filepath.Dir(golden)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("the generated source does not compile: %v\n%s", err, out)
+	}
+}
+
+func TestGenerateMissingPallet(t *testing.T) {
+	_, meta, err := demoMetadata().metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Generate(meta, "golden", []string{"Sminer"})
+	if err == nil || !strings.Contains(err.Error(), "Demo, Other") {
+		t.Fatalf("a missing pallet is generated: %v", err)
+	}
+}
+
+func TestLoadMetadata(t *testing.T) {
+	hex, _, err := demoMetadata().metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := types.HexDecodeString(hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, b := range map[string][]byte{"metadata.hex": []byte(hex + "\n"), "metadata.scale": raw} {
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, b, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta, err := LoadMetadata(path)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if len(meta.AsMetadataV14.Pallets) != 2 {
+			t.Fatalf("%v: %v pallets", name, len(meta.AsMetadataV14.Pallets))
+		}
+	}
+	_, err = LoadMetadata(filepath.Join(dir, "none.hex"))
+	if err == nil || !os.IsNotExist(errors.Cause(err)) {
+		t.Fatalf("a missing file is loaded: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package chaingen
+
+import (
+	"fmt"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+)
+
+// Builds V14 metadata for the tests, one type at a time
+type fixture struct {
+	reg     types.PortableRegistryV14
+	pallets []types.PalletMetadataV14
+	ids     map[string]int64
+}
+
+func newFixture() *fixture {
+	return &fixture{ids: make(map[string]int64)}
+}
+
+func typeID(id int64) types.Si1LookupTypeID {
+	return types.NewSi1LookupTypeIDFromUInt(uint64(id))
+}
+
+// Add a type under a key, once
+func (f *fixture) add(key string, path []string, def types.Si1TypeDef, params ...types.Si1TypeParameter) int64 {
+	if id, ok := f.ids[key]; ok {
+		return id
+	}
+	var p types.Si1Path
+	for _, s := range path {
+		p = append(p, types.Text(s))
+	}
+	id := int64(len(f.reg.Types))
+	f.reg.Types = append(f.reg.Types, types.PortableTypeV14{
+		ID:   typeID(id),
+		Type: types.Si1Type{Path: p, Params: params, Def: def},
+	})
+	f.ids[key] = id
+	return id
+}
+
+func (f *fixture) prim(p types.Si0TypeDefPrimitive) int64 {
+	return f.add(fmt.Sprint("prim", p), nil, types.Si1TypeDef{
+		IsPrimitive: true,
+		Primitive:   types.Si1TypeDefPrimitive{Si0TypeDefPrimitive: p},
+	})
+}
+
+func (f *fixture) vec(elem int64) int64 {
+	return f.add(fmt.Sprint("vec", elem), nil, types.Si1TypeDef{
+		IsSequence: true,
+		Sequence:   types.Si1TypeDefSequence{Type: typeID(elem)},
+	})
+}
+
+func (f *fixture) bytes() int64 {
+	return f.vec(f.prim(types.IsU8))
+}
+
+func (f *fixture) array(n uint32, elem int64) int64 {
+	return f.add(fmt.Sprint("array", n, "_", elem), nil, types.Si1TypeDef{
+		IsArray: true,
+		Array:   types.Si1TypeDefArray{Len: types.NewU32(n), Type: typeID(elem)},
+	})
+}
+
+func (f *fixture) compact(elem int64) int64 {
+	return f.add(fmt.Sprint("compact", elem), nil, types.Si1TypeDef{
+		IsCompact: true,
+		Compact:   types.Si1TypeDefCompact{Type: typeID(elem)},
+	})
+}
+
+func (f *fixture) tuple(elems ...int64) int64 {
+	var t types.Si1TypeDefTuple
+	key := "tuple"
+	for _, e := range elems {
+		t = append(t, typeID(e))
+		key += fmt.Sprint("_", e)
+	}
+	return f.add(key, nil, types.Si1TypeDef{IsTuple: true, Tuple: t})
+}
+
+func (f *fixture) accountID() int64 {
+	return f.add("AccountId32", []string{"sp_core", "crypto", "AccountId32"}, types.Si1TypeDef{
+		IsComposite: true,
+		Composite:   types.Si1TypeDefComposite{Fields: []types.Si1Field{unnamed(f.array(32, f.prim(types.IsU8)))}},
+	})
+}
+
+func (f *fixture) multiAddress() int64 {
+	return f.add("MultiAddress", []string{"sp_runtime", "multiaddress", "MultiAddress"}, types.Si1TypeDef{
+		IsVariant: true,
+		Variant: types.Si1TypeDefVariant{Variants: []types.Si1Variant{
+			{Name: "Id", Fields: []types.Si1Field{unnamed(f.accountID())}, Index: 0},
+			{Name: "Index", Fields: []types.Si1Field{unnamed(f.compact(f.prim(types.IsU32)))}, Index: 1},
+		}},
+	})
+}
+
+// A struct of named fields, pairs of name and type id
+func (f *fixture) composite(path []string, fields ...interface{}) int64 {
+	key := ""
+	for _, s := range path {
+		key += s + "::"
+	}
+	return f.add(key, path, types.Si1TypeDef{
+		IsComposite: true,
+		Composite:   types.Si1TypeDefComposite{Fields: namedFields(fields...)},
+	})
+}
+
+// A variant of an enum, call or event
+func variant(name string, index uint8, fields ...interface{}) types.Si1Variant {
+	return types.Si1Variant{Name: types.Text(name), Fields: namedFields(fields...), Index: types.NewU8(index)}
+}
+
+func (f *fixture) enum(key string, path []string, variants ...types.Si1Variant) int64 {
+	return f.add(key, path, types.Si1TypeDef{
+		IsVariant: true,
+		Variant:   types.Si1TypeDefVariant{Variants: variants},
+	})
+}
+
+func namedFields(fields ...interface{}) []types.Si1Field {
+	var list []types.Si1Field
+	for i := 0; i+1 < len(fields); i += 2 {
+		list = append(list, types.Si1Field{HasName: true, Name: types.Text(fields[i].(string)), Type: typeID(fields[i+1].(int64))})
+	}
+	return list
+}
+
+func unnamed(id int64) types.Si1Field {
+	return types.Si1Field{Type: typeID(id)}
+}
+
+// An unnamed field with the Rust type name, e.g. T::AccountId
+func typed(id int64, typeName string) types.Si1Field {
+	return types.Si1Field{Type: typeID(id), HasTypeName: true, TypeName: types.Text(typeName)}
+}
+
+func plain(name string, value int64) types.StorageEntryMetadataV14 {
+	return types.StorageEntryMetadataV14{
+		Name:     types.Text(name),
+		Modifier: types.StorageFunctionModifierV0{IsOptional: true},
+		Type:     types.StorageEntryTypeV14{IsPlainType: true, AsPlainType: typeID(value)},
+	}
+}
+
+// A map with one hasher per key, the keys of a double map are a tuple
+func storageMap(name string, key, value int64, hashers int) types.StorageEntryMetadataV14 {
+	var h []types.StorageHasherV10
+	for i := 0; i < hashers; i++ {
+		h = append(h, types.StorageHasherV10{IsBlake2_128Concat: true})
+	}
+	return types.StorageEntryMetadataV14{
+		Name:     types.Text(name),
+		Modifier: types.StorageFunctionModifierV0{IsOptional: true},
+		Type: types.StorageEntryTypeV14{IsMap: true, AsMap: types.MapTypeV14{
+			Hashers: h,
+			Key:     typeID(key),
+			Value:   typeID(value),
+		}},
+	}
+}
+
+// Add a pallet, calls and events are -1 when it has none
+func (f *fixture) pallet(name string, index uint8, calls, events int64, items ...types.StorageEntryMetadataV14) {
+	p := types.PalletMetadataV14{Name: types.Text(name), Index: types.NewU8(index)}
+	if len(items) > 0 {
+		p.HasStorage = true
+		p.Storage = types.StorageMetadataV14{Prefix: types.Text(name), Items: items}
+	}
+	if calls >= 0 {
+		p.HasCalls = true
+		p.Calls = types.FunctionMetadataV14{Type: typeID(calls)}
+	}
+	if events >= 0 {
+		p.HasEvents = true
+		p.Events = types.EventMetadataV14{Type: typeID(events)}
+	}
+	f.pallets = append(f.pallets, p)
+}
+
+// The metadata as returned by state_getMetadata and its decoded form
+func (f *fixture) metadata() (string, *types.Metadata, error) {
+	meta := types.Metadata{
+		MagicNumber: 0x6174656d,
+		Version:     14,
+		AsMetadataV14: types.MetadataV14{
+			Lookup:  f.reg,
+			Pallets: f.pallets,
+		},
+	}
+	s, err := types.EncodeToHexString(meta)
+	if err != nil {
+		return "", nil, err
+	}
+	var decoded types.Metadata
+	err = types.DecodeFromHexString(s, &decoded)
+	return s, &decoded, err
+}
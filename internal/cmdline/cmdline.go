@@ -1,12 +1,17 @@
 package cmdline
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"os"
 	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"storage-mining/internal/keystore"
 	"storage-mining/tools"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
@@ -17,15 +22,53 @@ func CmdlineInit() {
 		helpInfo     bool
 		showVersion  bool
 		confFilePath string
+		keyCmd       string
+		journal      bool
+		compat       bool
+		segment      uint64
+		since        string
+		until        string
 	)
 	flag.BoolVar(&helpInfo, "h", false, "Print Help (this message) and exit")
 	flag.BoolVar(&showVersion, "v", false, "Print version information and exit")
 	flag.StringVar(&confFilePath, "c", "", "Run the program directly to generate\n"+
 		"Specify the `configuration file` to ensure that the program runs correctly")
-	//flag.BoolVar(&configs.MinerEvent_Exit, "e", false, "Exit the cess mining network")
-	//flag.BoolVar(&configs.MinerEvent_RenewalTokens, "t", false, "Automatically register and renewal tokens")
+	flag.BoolVar(&configs.MinerEvent_Exit, "e", false, "Exit the cess mining network")
+	flag.BoolVar(&configs.MinerEvent_RenewalTokens, "t", false, "Top up the collateral to collateralTarget and exit")
+	flag.BoolVar(&configs.DryRun, "dry-run", false, "Build, sign and validate every transaction against the runtime\n"+
+		"without submitting it")
+	flag.IntVar(&keystore.PassphraseFd, "passfd", -1, "Read the keystore passphrase from this `file descriptor`\n"+
+		"Otherwise it is taken from "+keystore.PassphraseEnv+" or asked for")
+	flag.Uint64Var(&segment, "segment", 0, "Only show the journal entries of this `segment id`")
+	flag.StringVar(&since, "since", "", "Only show the journal entries from this `time` on")
+	flag.StringVar(&until, "until", "", "Only show the journal entries up to this `time`")
 	flag.Usage = usage
-	flag.Parse()
+	// commands go before the arguments, e.g. 'earnings -c conf.toml'
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "earnings":
+			configs.MinerEvent_Earnings = true
+			args = args[1:]
+		case "withdraw":
+			configs.MinerEvent_Withdraw = true
+			args = args[1:]
+		case "journal":
+			journal = true
+			args = args[1:]
+		case "compat":
+			compat = true
+			args = args[1:]
+		case "key":
+			if len(args) < 2 {
+				usage()
+				os.Exit(configs.Exit_Normal)
+			}
+			keyCmd = args[1]
+			args = args[2:]
+		}
+	}
+	flag.CommandLine.Parse(args)
 	if helpInfo {
 		flag.Usage()
 		os.Exit(configs.Exit_Normal)
@@ -34,6 +77,11 @@ func CmdlineInit() {
 		fmt.Println(configs.Version)
 		os.Exit(configs.Exit_Normal)
 	}
+	if journal {
+		// the journal is read offline, no configuration needed
+		journalCommand(segment, since, until)
+		os.Exit(configs.Exit_Normal)
+	}
 	if confFilePath == "" {
 		tools.WriteStringtoFile(configs.ConfigFile_Templete, configs.DefaultConfigurationFileName)
 		fmt.Printf("\x1b[%dm[note]\x1b[0m Generate default configuration file,use '-h' to view the help information.\n", 43)
@@ -57,6 +105,84 @@ func CmdlineInit() {
 		fmt.Printf("\x1b[%dm[err]\x1b[0m The '%v' file format error\n", 41, confFilePath)
 		os.Exit(configs.Exit_ConfFileFormatError)
 	}
+	applyNetwork()
+	checkAccounts()
+	if compat {
+		// only the rpc addresses are needed, not the identity
+		os.Exit(compatCommand())
+	}
+	if configs.DryRun && keyCmd == "" {
+		fmt.Printf("\x1b[%dm[note]\x1b[0m Dry run, no transaction is submitted to the chain\n", 43)
+	}
+	if keyCmd != "" {
+		keyCommand(keyCmd, flag.Arg(0))
+		os.Exit(configs.Exit_Normal)
+	}
+	checkGenesis()
+	loadIdentity()
+}
+
+// Select the network profile, its address prefix and default rpc addresses
+func applyNetwork() {
+	name := strings.TrimSpace(configs.Confile.CessChain.Network)
+	if name == "" {
+		name = configs.DefaultNetwork
+	}
+	n, ok := configs.Networks[name]
+	if !ok {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m Unknown network '%v', use hacknet, testnet or dev\n", 41, name)
+		os.Exit(configs.Exit_ConfFileFormatError)
+	}
+	configs.NetworkName, configs.NetworkProfile = name, n
+	if strings.TrimSpace(configs.Confile.CessChain.RpcAddr) == "" && len(configs.Confile.CessChain.RpcAddrs) == 0 {
+		if len(n.RpcAddrs) == 0 {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m The %v network has no default rpc address, set rpcAddr\n", 41, name)
+			os.Exit(configs.Exit_ConfFileFormatError)
+		}
+		configs.Confile.CessChain.RpcAddrs = n.RpcAddrs
+	}
+}
+
+// Nothing is signed without the genesis hash of the chain to check
+// the nodes against
+func checkGenesis() {
+	_, _, err := chain.ExpectedGenesis()
+	if err == nil {
+		return
+	}
+	fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+	if errors.Cause(err) == chain.ErrUnknownGenesis {
+		// never taken over by itself, the node may serve another chain
+		seen := make(map[string]bool)
+		for _, addr := range append([]string{configs.Confile.CessChain.RpcAddr}, configs.Confile.CessChain.RpcAddrs...) {
+			addr = strings.TrimSpace(addr)
+			if addr == "" || seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			h, err := chain.GenesisAt(addr)
+			if err != nil {
+				fmt.Printf("\x1b[%dm[note]\x1b[0m %v: %v\n", 43, addr, err)
+				continue
+			}
+			fmt.Printf("\x1b[%dm[note]\x1b[0m %v serves the chain of genesis %v\n", 43, addr, h.Hex())
+		}
+		fmt.Printf("\x1b[%dm[note]\x1b[0m Confirm the genesis hash of the %v network with its operators and set genesisHash to it\n", 43, configs.NetworkName)
+	}
+	os.Exit(configs.Exit_ConfFileFormatError)
+}
+
+// Accounts may be given as SS58 addresses or hex public keys, they are
+// checked here and kept as hex public keys
+func checkAccounts() {
+	if configs.Confile.MinerData.IncomeAccountPubkey != "" {
+		pub, err := tools.ParseAccount(configs.Confile.MinerData.IncomeAccountPubkey, configs.NetworkProfile.SS58Prefix)
+		if err != nil {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m incomeAccountPubkey '%v': %v\n", 41, configs.Confile.MinerData.IncomeAccountPubkey, err)
+			os.Exit(configs.Exit_ConfFileFormatError)
+		}
+		configs.Confile.MinerData.IncomeAccountPubkey = "0x" + hex.EncodeToString(pub)
+	}
 }
 
 func usage() {
@@ -65,7 +191,19 @@ func usage() {
 Usage:
     `
 	str += fmt.Sprintf("%v", os.Args[0])
-	str += ` [arguments] [file]
+	str += ` [command] [arguments] [file]
+
+Commands:
+    earnings    Show the current, locked and withdrawable earnings and exit
+    withdraw    Withdraw the earnings to the beneficiary account and exit
+    key import  Import the identity account into the keystore, from a
+                polkadot-js JSON [file] or else a phrase or seed
+    key export  Write the keystore to a polkadot-js JSON [file]
+    key address Show the address of the identity account
+    journal     Show the transactions sent to the chain, filtered with
+                -segment, -since and -until
+    compat      Check that the runtime of each rpc address has the storage
+                items, calls and events of the miner with matching types
 
 Arguments:
 `
@@ -0,0 +1,35 @@
+package cmdline
+
+import (
+	"fmt"
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"strings"
+)
+
+// Check the runtime behind every configured rpc address and return the
+// exit code, Exit_IncompatibleRuntime if one of them is not compatible
+func compatCommand() int {
+	code := configs.Exit_Normal
+	seen := make(map[string]bool)
+	for _, addr := range append([]string{configs.Confile.CessChain.RpcAddr}, configs.Confile.CessChain.RpcAddrs...) {
+		addr = strings.TrimSpace(addr)
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		rv, issues, err := chain.CheckRuntimeAt(addr)
+		if err != nil {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m %v: %v\n", 41, addr, err)
+			code = configs.Exit_IncompatibleRuntime
+			continue
+		}
+		if !chain.PrintCompatIssues(issues) {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m %v: runtime %v spec %v is not compatible\n", 41, addr, rv.SpecName, rv.SpecVersion)
+			code = configs.Exit_IncompatibleRuntime
+			continue
+		}
+		fmt.Printf("\x1b[%dm[ok]\x1b[0m %v: runtime %v spec %v is compatible\n", 42, addr, rv.SpecName, rv.SpecVersion)
+	}
+	return code
+}
@@ -0,0 +1,73 @@
+package cmdline
+
+import (
+	"fmt"
+	"os"
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Layouts accepted by -since and -until
+var journalLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// Print the journal entries of the segment and time range
+func journalCommand(segment uint64, since, until string) {
+	var (
+		err error
+		q   = chain.JournalFilter{Segment: segment}
+	)
+	q.Since, err = parseJournalTime(since, false)
+	if err == nil {
+		q.Until, err = parseJournalTime(until, true)
+	}
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(configs.Exit_Normal)
+	}
+	entries, err := chain.QueryJournal(q)
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(configs.Exit_Normal)
+	}
+	for _, e := range entries {
+		line := fmt.Sprintf("%v  %-9v  %v", e.Time, e.Status, e.Call)
+		if e.Segment != 0 {
+			line += fmt.Sprintf("  segment=%v", e.Segment)
+		}
+		if e.Hash != "" {
+			line += fmt.Sprintf("  nonce=%v  hash=%v", e.Nonce, e.Hash)
+		}
+		if e.Block != "" {
+			line += fmt.Sprintf("  block=%v", e.Block)
+		}
+		if len(e.Events) > 0 {
+			line += fmt.Sprintf("  events=%v", strings.Join(e.Events, ","))
+		}
+		if e.Error != "" {
+			line += fmt.Sprintf("  error=%q", e.Error)
+		}
+		fmt.Println(line)
+	}
+}
+
+// A date alone stands for the start of the day, or its end for -until
+func parseJournalTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range journalLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if end && len(s) == len("2006-01-02") {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("invalid time '%v', use 'YYYY-MM-DD hh:mm:ss' or 'YYYY-MM-DD'", s)
+}
@@ -0,0 +1,199 @@
+package cmdline
+
+import (
+	"fmt"
+	"os"
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"storage-mining/internal/keystore"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Plain phrase or seed of configurations from before the keystore
+func legacySecret() string {
+	return viper.GetString("minerData.idAccountPhraseOrSeed")
+}
+
+// Load the identity account from the keystore, or connect to the remote
+// signing service. A plain phrase or seed in the configuration file is
+// still accepted until it is imported.
+func loadIdentity() {
+	if configs.Confile.MinerData.SignerUrl != "" {
+		s, err := chain.NewRemoteSigner(configs.Confile.MinerData.SignerUrl, configs.Confile.MinerData.SignerToken)
+		if err != nil {
+			fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+			os.Exit(configs.Exit_Keystore)
+		}
+		chain.RemoteSigner = s
+		return
+	}
+	path := configs.Confile.MinerData.Keystore
+	legacy := legacySecret()
+	if legacy != "" {
+		if _, err := os.Stat(path); path == "" || err != nil {
+			fmt.Printf("\x1b[%dm[warn]\x1b[0m idAccountPhraseOrSeed is stored in plain text, run 'key import' and remove it from the configuration file\n", 43)
+			err := keystore.UseSecret(legacy)
+			if err != nil {
+				fmt.Printf("\x1b[%dm[err]\x1b[0m idAccountPhraseOrSeed: %v\n", 41, err)
+				os.Exit(configs.Exit_ConfFileFormatError)
+			}
+			return
+		}
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m The keystore is used, remove idAccountPhraseOrSeed from the configuration file\n", 43)
+	}
+	if path == "" {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m No keystore in the configuration file\n", 41)
+		os.Exit(configs.Exit_ConfFileFormatError)
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m The keystore '%v' does not exist, create it with 'key import'\n", 41, path)
+		os.Exit(configs.Exit_Keystore)
+	}
+	pass, err := keystore.Passphrase(fmt.Sprintf("Passphrase of %v: ", path), false)
+	if err == nil {
+		err = keystore.Load(path, pass)
+	}
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(configs.Exit_Keystore)
+	}
+}
+
+// Run a 'key' command
+func keyCommand(cmd, file string) {
+	var err error
+	switch cmd {
+	case "import":
+		err = keyImport(file)
+	case "export":
+		err = keyExport(file)
+	case "address":
+		err = keyAddress()
+	default:
+		usage()
+		return
+	}
+	if err != nil {
+		fmt.Printf("\x1b[%dm[err]\x1b[0m %v\n", 41, err)
+		os.Exit(configs.Exit_Keystore)
+	}
+}
+
+// Import a polkadot-js JSON file, or else the plain phrase or seed of the
+// configuration file or the one typed at the prompt
+func keyImport(file string) error {
+	path := configs.Confile.MinerData.Keystore
+	if path == "" {
+		return errors.New("no keystore in the configuration file")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return errors.Errorf("the keystore '%v' already exists", path)
+	}
+	var (
+		sk, pub, pass []byte
+		name          string
+		err           error
+	)
+	if file != "" {
+		kf, err := keystore.ReadKeyFile(file)
+		if err != nil {
+			return err
+		}
+		pass, err = keystore.Passphrase(fmt.Sprintf("Passphrase of %v: ", file), false)
+		if err != nil {
+			return err
+		}
+		sk, pub, err = kf.Decrypt(pass)
+		if err != nil {
+			return err
+		}
+		name, _ = kf.Meta["name"].(string)
+	} else {
+		phrase := legacySecret()
+		if phrase == "" {
+			b, err := keystore.ReadHidden("Phrase or seed of the identity account: ")
+			if err != nil {
+				return err
+			}
+			phrase = string(b)
+		}
+		sk, pub, err = keystore.FromSecret(phrase)
+		if err != nil {
+			return err
+		}
+		pass, err = keystore.Passphrase("New passphrase of the keystore: ", true)
+		if err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		name = "cess miner"
+	}
+	kf, err := keystore.Encrypt(sk, pub, pass, name)
+	if err != nil {
+		return err
+	}
+	err = kf.Save(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\x1b[%dm[ok]\x1b[0m Imported %v into '%v'\n", 42, kf.Address, path)
+	if legacySecret() != "" {
+		fmt.Printf("\x1b[%dm[note]\x1b[0m Now remove idAccountPhraseOrSeed from the configuration file\n", 43)
+	}
+	return nil
+}
+
+// Write the keystore to a file that restores in polkadot-js with the
+// same passphrase
+func keyExport(file string) error {
+	if file == "" {
+		return errors.New("missing the file to export to")
+	}
+	path := configs.Confile.MinerData.Keystore
+	kf, err := keystore.ReadKeyFile(path)
+	if err != nil {
+		return err
+	}
+	pass, err := keystore.Passphrase(fmt.Sprintf("Passphrase of %v: ", path), false)
+	if err != nil {
+		return err
+	}
+	sk, pub, err := kf.Decrypt(pass)
+	if err != nil {
+		return err
+	}
+	name, _ := kf.Meta["name"].(string)
+	out, err := keystore.Encrypt(sk, pub, pass, name)
+	if err != nil {
+		return err
+	}
+	err = out.Save(file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\x1b[%dm[ok]\x1b[0m Exported %v to '%v'\n", 42, out.Address, file)
+	return nil
+}
+
+// The address is stored in clear in the keystore, no passphrase needed
+func keyAddress() error {
+	if legacySecret() != "" {
+		if _, err := os.Stat(configs.Confile.MinerData.Keystore); err != nil {
+			err = keystore.UseSecret(legacySecret())
+			if err != nil {
+				return err
+			}
+			fmt.Println(keystore.Address())
+			return nil
+		}
+	}
+	kf, err := keystore.ReadKeyFile(configs.Confile.MinerData.Keystore)
+	if err != nil {
+		return err
+	}
+	fmt.Println(kf.Address)
+	return nil
+}
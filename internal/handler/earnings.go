@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Report the current, locked and withdrawable earnings in TCESS
+func EarningsHandler(c *gin.Context) {
+	var rsp = configs.RespMsg{
+		Code: -1,
+		Msg:  "",
+		Data: nil,
+	}
+	info, err := chain.GetEarnings()
+	if err != nil {
+		rsp.Msg = err.Error()
+		c.JSON(http.StatusInternalServerError, rsp)
+		return
+	}
+	rsp.Code = 0
+	rsp.Msg = "success"
+	rsp.Data = info
+	c.JSON(http.StatusOK, rsp)
+}
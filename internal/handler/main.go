@@ -22,5 +22,7 @@ func Handler_main() {
 	//TODO:
 	//r.POST("/upfile", UploadHandler)
 	r.GET("/downfile/:hash", DownloadHandler)
+	r.GET("/status", StatusHandler)
+	r.GET("/earnings", EarningsHandler)
 	r.Run(":" + fmt.Sprintf("%v", configs.Confile.MinerData.ServicePort))
 }
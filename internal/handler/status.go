@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+
+	"github.com/gin-gonic/gin"
+)
+
+type statusInfo struct {
+	MinerId   string               `json:"minerId"`
+	Version   string               `json:"version"`
+	Endpoint  string               `json:"endpoint"`
+	Endpoints []chain.EndpointInfo `json:"endpoints"`
+}
+
+// Report the miner and the rpc endpoint in use
+func StatusHandler(c *gin.Context) {
+	var rsp = configs.RespMsg{
+		Code: 0,
+		Msg:  "success",
+		Data: statusInfo{
+			MinerId:   configs.MinerId_S,
+			Version:   configs.Version,
+			Endpoint:  chain.CurrentEndpoint(),
+			Endpoints: chain.EndpointStatus(),
+		},
+	}
+	c.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,338 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"storage-mining/configs"
+	"storage-mining/tools"
+	"strings"
+	"time"
+
+	"github.com/ChainSafe/go-schnorrkel"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Keystore files use the JSON format of polkadot-js: the pkcs8 encoded
+// sr25519 key pair, encrypted with xsalsa20-poly1305 under a scrypt key.
+// An account exported from the polkadot-js wallet imports as it is, and
+// an exported keystore restores in the wallet.
+
+const (
+	scryptN   = 1 << 15
+	scryptP   = 1
+	scryptR   = 8
+	saltLen   = 32
+	nonceLen  = 24
+	secretLen = 64
+	publicLen = 32
+)
+
+var (
+	pkcs8Header  = []byte{48, 83, 2, 1, 1, 48, 5, 6, 3, 43, 101, 112, 4, 34, 4, 32}
+	pkcs8Divider = []byte{161, 35, 3, 33, 0}
+)
+
+type Encoding struct {
+	Content []string `json:"content"`
+	Type    []string `json:"type"`
+	Version string   `json:"version"`
+}
+
+// Keystore file
+type KeyFile struct {
+	Encoded  string                 `json:"encoded"`
+	Encoding Encoding               `json:"encoding"`
+	Address  string                 `json:"address"`
+	Meta     map[string]interface{} `json:"meta"`
+}
+
+// The identity account in use. It is only kept in memory.
+var (
+	secret  string
+	address string
+)
+
+// Secret of the identity account, in the form taken by the signing
+// functions. Never log or save it.
+func Secret() string {
+	return secret
+}
+
+// SS58 address of the identity account
+func Address() string {
+	return address
+}
+
+// Use a plain phrase or seed as the identity account
+func UseSecret(phraseOrSeed string) error {
+	kp, err := keyringPair(phraseOrSeed)
+	if err != nil {
+		return errors.Wrap(err, "invalid phrase or seed")
+	}
+	secret, address = phraseOrSeed, kp.Address
+	return nil
+}
+
+// Decrypt the keystore file and use it as the identity account
+func Load(path string, passphrase []byte) error {
+	kf, err := ReadKeyFile(path)
+	if err != nil {
+		return err
+	}
+	sk, pub, err := kf.Decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	uri, kp, err := signingKey(sk, pub)
+	if err != nil {
+		return err
+	}
+	secret, address = uri, kp.Address
+	return nil
+}
+
+func ReadKeyFile(path string) (*KeyFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile err")
+	}
+	var kf KeyFile
+	err = json.Unmarshal(b, &kf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %v err", path)
+	}
+	return &kf, nil
+}
+
+// Write the keystore file, an existing file is never replaced
+func (kf *KeyFile) Save(path string) error {
+	b, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "MarshalIndent err")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrap(err, "OpenFile err")
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return errors.Wrap(err, "f.Write err")
+	}
+	return errors.Wrap(f.Close(), "f.Close err")
+}
+
+// Decrypt the key pair. The secret key is in the ed25519 form used by
+// polkadot-js, with the scalar multiplied by the cofactor.
+func (kf *KeyFile) Decrypt(passphrase []byte) (sk, pub []byte, err error) {
+	if !equalStrings(kf.Encoding.Content, []string{"pkcs8", "sr25519"}) {
+		return nil, nil, errors.Errorf("unsupported key type %v, only sr25519 accounts can sign", kf.Encoding.Content)
+	}
+	if kf.Encoding.Version != "3" || !equalStrings(kf.Encoding.Type, []string{"scrypt", "xsalsa20-poly1305"}) {
+		return nil, nil, errors.Errorf("unsupported encryption %v version %v", kf.Encoding.Type, kf.Encoding.Version)
+	}
+	enc, err := base64.StdEncoding.DecodeString(kf.Encoded)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "DecodeString err")
+	}
+	if len(enc) < saltLen+12+nonceLen+secretbox.Overhead {
+		return nil, nil, errors.New("encoded key too short")
+	}
+	salt := enc[:saltLen]
+	n := binary.LittleEndian.Uint32(enc[saltLen:])
+	p := binary.LittleEndian.Uint32(enc[saltLen+4:])
+	r := binary.LittleEndian.Uint32(enc[saltLen+8:])
+	enc = enc[saltLen+12:]
+	key, err := scrypt.Key(passphrase, salt, int(n), int(r), int(p), 64)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "scrypt err")
+	}
+	var k [32]byte
+	var nonce [nonceLen]byte
+	copy(k[:], key)
+	copy(nonce[:], enc[:nonceLen])
+	plain, ok := secretbox.Open(nil, enc[nonceLen:], &nonce, &k)
+	if !ok {
+		return nil, nil, errors.New("wrong passphrase")
+	}
+	return decodePkcs8(plain)
+}
+
+// Encrypt a key pair into a new keystore file
+func Encrypt(sk, pub, passphrase []byte, name string) (*KeyFile, error) {
+	_, kp, err := signingKey(sk, pub)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltLen)
+	var nonce [nonceLen]byte
+	_, err = rand.Read(salt)
+	if err == nil {
+		_, err = rand.Read(nonce[:])
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "rand.Read err")
+	}
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "scrypt err")
+	}
+	var k [32]byte
+	copy(k[:], key)
+	enc := make([]byte, 0, saltLen+12+nonceLen+len(pkcs8Header)+secretLen+len(pkcs8Divider)+publicLen+secretbox.Overhead)
+	enc = append(enc, salt...)
+	for _, v := range []uint32{scryptN, scryptP, scryptR} {
+		enc = append(enc, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+	enc = append(enc, nonce[:]...)
+	enc = secretbox.Seal(enc, encodePkcs8(sk, pub), &nonce, &k)
+	return &KeyFile{
+		Encoded: base64.StdEncoding.EncodeToString(enc),
+		Encoding: Encoding{
+			Content: []string{"pkcs8", "sr25519"},
+			Type:    []string{"scrypt", "xsalsa20-poly1305"},
+			Version: "3",
+		},
+		Address: kp.Address,
+		Meta: map[string]interface{}{
+			"name":        name,
+			"whenCreated": time.Now().UnixNano() / int64(time.Millisecond),
+		},
+	}, nil
+}
+
+// Key pair of a mnemonic phrase or a hex seed. Derivation paths are not
+// supported, import the derived account from polkadot-js instead.
+func FromSecret(phraseOrSeed string) (sk, pub []byte, err error) {
+	phraseOrSeed = strings.TrimSpace(phraseOrSeed)
+	if strings.Contains(phraseOrSeed, "/") {
+		return nil, nil, errors.New("derivation paths are not supported")
+	}
+	var mini [32]byte
+	if strings.HasPrefix(phraseOrSeed, "0x") {
+		b, err := hex.DecodeString(phraseOrSeed[2:])
+		if err != nil {
+			return nil, nil, errors.New("invalid hex seed")
+		}
+		switch len(b) {
+		case 32:
+			copy(mini[:], b)
+		case secretLen:
+			// an expanded secret key, the scalar is not multiplied yet
+			sk = append(multiplyByCofactor(b[:32]), b[32:]...)
+		default:
+			return nil, nil, errors.New("invalid seed length")
+		}
+	} else {
+		ms, err := schnorrkel.MiniSecretFromMnemonic(phraseOrSeed, "")
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "invalid mnemonic")
+		}
+		mini = ms.Encode()
+	}
+	if sk == nil {
+		sk = expandEd25519(mini)
+	}
+	kp, err := keyringPair(phraseOrSeed)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid phrase or seed")
+	}
+	return sk, kp.PublicKey, nil
+}
+
+// The signing functions take the expanded secret key as a hex seed.
+// Deriving the public key from it again guards against a corrupt file.
+func signingKey(sk, pub []byte) (string, signature.KeyringPair, error) {
+	if len(sk) != secretLen || len(pub) != publicLen {
+		return "", signature.KeyringPair{}, errors.New("invalid key length")
+	}
+	uri := "0x" + hex.EncodeToString(append(divideByCofactor(sk[:32]), sk[32:]...))
+	kp, err := keyringPair(uri)
+	if err != nil {
+		return "", kp, errors.Wrap(err, "KeyringPairFromSecret err")
+	}
+	if hex.EncodeToString(kp.PublicKey) != hex.EncodeToString(pub) {
+		return "", kp, errors.New("the secret key does not match the public key")
+	}
+	return uri, kp, nil
+}
+
+// Key pair of a phrase or seed with the address on the network in use.
+// gsrpc only encodes the one-byte address prefixes.
+func keyringPair(phraseOrSeed string) (signature.KeyringPair, error) {
+	kp, err := signature.KeyringPairFromSecret(phraseOrSeed, 42)
+	if err != nil {
+		return kp, err
+	}
+	kp.Address, err = tools.EncodeSS58(kp.PublicKey, configs.NetworkProfile.SS58Prefix)
+	return kp, err
+}
+
+// Same expansion as schnorrkel, but the scalar stays in the ed25519 form
+func expandEd25519(mini [32]byte) []byte {
+	h := sha512.Sum512(mini[:])
+	h[0] &= 248
+	h[31] &= 63
+	h[31] |= 64
+	return h[:]
+}
+
+func multiplyByCofactor(s []byte) []byte {
+	r := make([]byte, len(s))
+	high := byte(0)
+	for i := range s {
+		r[i] = s[i]<<3 | high
+		high = s[i] >> 5
+	}
+	return r
+}
+
+func divideByCofactor(s []byte) []byte {
+	r := make([]byte, len(s))
+	low := byte(0)
+	for i := len(s) - 1; i >= 0; i-- {
+		r[i] = s[i]>>3 | low
+		low = s[i] << 5
+	}
+	return r
+}
+
+func encodePkcs8(sk, pub []byte) []byte {
+	b := make([]byte, 0, len(pkcs8Header)+secretLen+len(pkcs8Divider)+publicLen)
+	b = append(b, pkcs8Header...)
+	b = append(b, sk...)
+	b = append(b, pkcs8Divider...)
+	return append(b, pub...)
+}
+
+func decodePkcs8(b []byte) (sk, pub []byte, err error) {
+	n := len(pkcs8Header) + secretLen + len(pkcs8Divider)
+	if len(b) != n+publicLen ||
+		string(b[:len(pkcs8Header)]) != string(pkcs8Header) ||
+		string(b[len(pkcs8Header)+secretLen:n]) != string(pkcs8Divider) {
+		return nil, nil, errors.New("invalid pkcs8 key")
+	}
+	return b[len(pkcs8Header) : len(pkcs8Header)+secretLen], b[n:], nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
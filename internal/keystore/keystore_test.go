@@ -0,0 +1,152 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// subkey inspect //Alice
+	aliceSeed    = "0xe5be9a5092b81bca64be81d212e7f2f9eba183bb7a90954f7b76361f6edb5c0a"
+	alicePub     = "d43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d"
+	aliceAddress = "5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY"
+
+	testPhrase = "bottom drive obey lake curtain smoke basket hold race lonely fit walk"
+)
+
+// testdata/alice.json is Alice in the polkadot-js export format, with the
+// passphrase "cess". It was written without this package: the pkcs8 key
+// pair with the secret key in the ed25519 form, sealed with
+// xsalsa20-poly1305 under the scrypt key of N=2^15, p=1, r=8.
+func TestDecryptPolkadotJs(t *testing.T) {
+	kf, err := ReadKeyFile("testdata/alice.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, pub, err := kf.Decrypt([]byte("cess"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(pub) != alicePub {
+		t.Fatalf("public key %x, want %v", pub, alicePub)
+	}
+	seedSk, _, err := FromSecret(aliceSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sk, seedSk) {
+		t.Fatal("the secret key differs from the one of the seed")
+	}
+
+	err = Load("testdata/alice.json", []byte("cess"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { secret, address = "", "" }()
+	if Address() != aliceAddress {
+		t.Fatalf("address %v, want %v", Address(), aliceAddress)
+	}
+}
+
+func TestEncryptRoundtrip(t *testing.T) {
+	sk, pub, err := FromSecret(testPhrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kf, err := Encrypt(sk, pub, []byte("passphrase"), "miner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "miner.json")
+	err = kf.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = kf.Save(path); err == nil {
+		t.Fatal("an existing keystore file was replaced")
+	}
+
+	read, err := ReadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsk, dpub, err := read.Decrypt([]byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dsk, sk) || !bytes.Equal(dpub, pub) {
+		t.Fatal("the decrypted key pair differs")
+	}
+	err = Load(path, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { secret, address = "", "" }()
+	// signing with the file gives the account of the phrase
+	kp, err := keyringPair(testPhrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Address() != kp.Address || read.Address != kp.Address {
+		t.Fatalf("address %v, file %v, want %v", Address(), read.Address, kp.Address)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	kf, err := ReadKeyFile("testdata/alice.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pass := range []string{"", "Cess", "cess "} {
+		_, _, err = kf.Decrypt([]byte(pass))
+		if err == nil || err.Error() != "wrong passphrase" {
+			t.Errorf("decrypted with %q: %v", pass, err)
+		}
+	}
+
+	// a changed byte of the sealed key fails the authentication
+	enc, _ := base64.StdEncoding.DecodeString(kf.Encoded)
+	enc[len(enc)-1] ^= 1
+	tampered := *kf
+	tampered.Encoded = base64.StdEncoding.EncodeToString(enc)
+	if _, _, err = tampered.Decrypt([]byte("cess")); err == nil {
+		t.Error("a tampered key was decrypted")
+	}
+
+	ed := *kf
+	ed.Encoding.Content = []string{"pkcs8", "ed25519"}
+	if _, _, err = ed.Decrypt([]byte("cess")); err == nil || !strings.Contains(err.Error(), "only sr25519") {
+		t.Errorf("an ed25519 key was decrypted: %v", err)
+	}
+}
+
+func TestPassphraseFromEnv(t *testing.T) {
+	os.Setenv(PassphraseEnv, "from env")
+	pass, err := Passphrase("", false)
+	if err != nil || string(pass) != "from env" {
+		t.Fatalf("passphrase %q: %v", pass, err)
+	}
+	if _, ok := os.LookupEnv(PassphraseEnv); ok {
+		t.Fatal("the passphrase is left in the environment")
+	}
+}
+
+func TestPassphraseFromFd(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("from fd\r\nnext line")
+	w.Close()
+	PassphraseFd = int(r.Fd())
+	defer func() { PassphraseFd = -1 }()
+	pass, err := Passphrase("", false)
+	if err != nil || string(pass) != "from fd" {
+		t.Fatalf("passphrase %q: %v", pass, err)
+	}
+}
@@ -0,0 +1,99 @@
+package keystore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Environment variable holding the keystore passphrase
+const PassphraseEnv = "CESS_KEYSTORE_PASSPHRASE"
+
+// File descriptor to read the passphrase from, e.g. a pipe set up by the
+// service manager. -1 disables it.
+var PassphraseFd = -1
+
+// Get the passphrase from the file descriptor, the environment variable
+// or else a prompt on the terminal. confirm asks twice at the prompt,
+// for a new passphrase.
+func Passphrase(prompt string, confirm bool) ([]byte, error) {
+	if PassphraseFd >= 0 {
+		f := os.NewFile(uintptr(PassphraseFd), "passphrase")
+		if f == nil {
+			return nil, errors.Errorf("invalid file descriptor %v", PassphraseFd)
+		}
+		defer f.Close()
+		return readLine(f)
+	}
+	if v, ok := os.LookupEnv(PassphraseEnv); ok {
+		// keep it away from the child processes
+		os.Unsetenv(PassphraseEnv)
+		return []byte(v), nil
+	}
+	pass, err := ReadHidden(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := ReadHidden("Repeat the passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, errors.New("the passphrases do not match")
+		}
+		if len(pass) == 0 {
+			return nil, errors.New("empty passphrase")
+		}
+	}
+	return pass, nil
+}
+
+// Read a line from the terminal without echoing it
+func ReadHidden(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	st, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, errors.Errorf("no terminal to ask for the passphrase, set %v or use -passfd", PassphraseEnv)
+	}
+	t := *st
+	t.Lflag &^= unix.ECHO
+	t.Lflag |= unix.ICANON | unix.ISIG
+	t.Iflag |= unix.ICRNL
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, &t)
+	if err != nil {
+		return nil, errors.Wrap(err, "IoctlSetTermios err")
+	}
+	defer unix.IoctlSetTermios(fd, unix.TCSETS, st)
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := readLine(os.Stdin)
+	fmt.Fprintln(os.Stderr)
+	return line, err
+}
+
+// Read up to the end of the line, one byte at a time so nothing after
+// it is consumed
+func readLine(f *os.File) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := f.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+			continue
+		}
+		if err != nil {
+			if len(line) > 0 {
+				break
+			}
+			return nil, errors.Wrap(err, "read passphrase err")
+		}
+	}
+	return bytes.TrimSuffix(line, []byte{'\r'}), nil
+}
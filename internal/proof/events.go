@@ -0,0 +1,124 @@
+package proof
+
+import (
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"sync"
+	"time"
+)
+
+// Sent to the workers after a reconnect, the events of the blocks in
+// between are lost and the chain is polled once
+const event_Resync = "Resync"
+
+// Routes the chain events of the miner from one subscription to the proof
+// workers. While there is no subscription the workers poll on new blocks.
+type eventRouter struct {
+	lock sync.Mutex
+	live bool
+	vpb  chan chain.MinerEvent
+	vpc  chan chain.MinerEvent
+	vpd  chan chain.MinerEvent
+}
+
+var router = &eventRouter{
+	vpb: make(chan chain.MinerEvent, 1),
+	vpc: make(chan chain.MinerEvent, 1),
+	vpd: make(chan chain.MinerEvent, 1),
+}
+
+// Whether the events arrive, so the workers need not poll
+func (r *eventRouter) Live() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.live
+}
+
+func (r *eventRouter) setLive(live bool) {
+	r.lock.Lock()
+	r.live = live
+	r.lock.Unlock()
+}
+
+func (r *eventRouter) run() {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	connected := false
+	for {
+		ch, cancel, err := chain.Client.SubscribeMinerEvents(keystore.Secret(), configs.MinerId_I)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			time.Sleep(time.Second * 10)
+			continue
+		}
+		r.setLive(true)
+		if connected {
+			logger.InfoLogger.Sugar().Infof("[%v] event subscription back, poll the chain once", configs.MinerId_S)
+			ev := chain.MinerEvent{Kind: event_Resync, PeerId: configs.MinerId_I}
+			r.notify(r.vpb, ev)
+			r.notify(r.vpc, ev)
+			r.notify(r.vpd, ev)
+		}
+		connected = true
+		for ev := range ch {
+			r.route(ev)
+		}
+		cancel()
+		r.setLive(false)
+		logger.InfoLogger.Sugar().Infof("[%v] event subscription lost, the proof workers poll until it is back", configs.MinerId_S)
+		time.Sleep(time.Second * 10)
+	}
+}
+
+func (r *eventRouter) route(ev chain.MinerEvent) {
+	switch ev.Kind {
+	case chain.Proof_Vpa, chain.Proof_Vpb, chain.Proof_Vpc, chain.Proof_Vpd:
+		if !ev.Verified {
+			logger.InfoLogger.Sugar().Infof("[%v][%v] submitted", ev.Kind, ev.SegmentId)
+			return
+		}
+		logger.InfoLogger.Sugar().Infof("[%v][%v] verified", ev.Kind, ev.SegmentId)
+		// a new segment to prove in the windows of vpb or vpd
+		switch ev.Kind {
+		case chain.Proof_Vpa:
+			r.notify(r.vpb, ev)
+		case chain.Proof_Vpc:
+			r.notify(r.vpd, ev)
+		}
+	case chain.Event_ParamSet:
+		logger.InfoLogger.Sugar().Infof("[%v][%v] challenge %v", ev.Kind, ev.SegmentId, ev.Random)
+	case chain.Event_TimedTask:
+		observeTimedTask(ev.Number)
+		r.notify(r.vpb, ev)
+		r.notify(r.vpd, ev)
+	case chain.Event_HoldSlice:
+		r.notify(r.vpc, ev)
+	}
+}
+
+// A worker busy with a round keeps one pending event, a new challenge
+// window takes the place of any other
+func (r *eventRouter) notify(ch chan chain.MinerEvent, ev chain.MinerEvent) {
+	select {
+	case ch <- ev:
+		return
+	default:
+	}
+	if ev.Kind != chain.Event_TimedTask {
+		return
+	}
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- ev:
+	default:
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"storage-mining/configs"
 	"storage-mining/internal/chain"
+	"storage-mining/internal/keystore"
 	"storage-mining/internal/logger"
 	"storage-mining/tools"
 	"time"
@@ -24,6 +25,16 @@ type mountpathInfo struct {
 	Free  uint64
 }
 
+// The proof generators and the free space check of the workers, replaced
+// in the tests, which run without the proof parameters
+var (
+	sealSegment    = GenerateSenmentVpa
+	proveSegment   = generateSenmentVpb
+	sealFileSlice  = generateSegmentVpc
+	proveFileSlice = generateSenmentVpd
+	enableSpace    = getEnableSpace
+)
+
 func Proof_Init() {
 	path := filepath.Join(configs.MinerDataPath, configs.TmpltFileFolder)
 	configs.TmpltFileFolder = path
@@ -54,9 +65,46 @@ func Proof_Main() {
 	go segmentVpb()
 	go segmentVpc()
 	go segmentVpd()
+	go router.run()
+	if configs.Confile.MinerData.FeeRunway > 0 {
+		go feeRunway()
+	}
+}
+
+// Warn while the balance pays for fewer than feeRunway proof transactions
+func feeRunway() {
+	defer func() {
+		err := recover()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[panic]: %v", err)
+		}
+	}()
+	for range time.Tick(time.Minute * configs.TimeToCheckRunway_M) {
+		txs, usable, ok, err := chain.FeeRunway()
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("[%v] %v", configs.MinerId_S, err)
+			continue
+		}
+		if !ok || txs >= configs.Confile.MinerData.FeeRunway {
+			continue
+		}
+		fmt.Printf("\x1b[%dm[warn]\x1b[0m The balance of %v TCESS only pays for %v more proofs, top up the identity account\n", 43, chain.PlanckToTokens(usable), txs)
+		logger.ErrLogger.Sugar().Errorf("[%v] fee runway: %v TCESS pays for %v proofs, below %v", configs.MinerId_S, chain.PlanckToTokens(usable), txs, configs.Confile.MinerData.FeeRunway)
+	}
 }
 
 func segmentVpa() {
+	segmentPath := filepath.Join(configs.MinerDataPath, configs.SegmentData)
+	tk := newBlockTicker("vpa", 1)
+	defer tk.Stop()
+	for {
+		tk.Wait()
+		vpaRound(tk, segmentPath)
+	}
+}
+
+// Seal a new idle segment and submit its proof
+func vpaRound(tk *blockTicker, segmentPath string) {
 	var (
 		err         error
 		ok          bool
@@ -64,93 +112,111 @@ func segmentVpa() {
 		segsizeType uint8
 		segmentNum  uint32
 		enableS     uint64
-		segmentPath = ""
 	)
 	segType = 1
-	segmentPath = filepath.Join(configs.MinerDataPath, configs.SegmentData)
-	for range time.Tick(time.Second) {
-		deleteFailedSegment(filepath.Join(configs.MinerDataPath, configs.SegmentData))
-		enableS, err = getEnableSpace()
-		if err != nil {
-			logger.ErrLogger.Sugar().Errorf("[%v] %v", configs.MinerId_S, err)
-		}
-		if enableS > 0 {
-			segmentNum, err = getSegmentNumForTypeOne(segmentPath, configs.SegMentType_8M_S)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			if segmentNum >= 100 {
-				segsizeType = configs.SegMentType_512M
-			} else {
-				segsizeType = configs.SegMentType_8M
-			}
+	// no new segments once the miner is exiting
+	if chain.Exiting() {
+		tk.Delay(configs.BlocksToRetryProof)
+		return
+	}
+	deleteFailedSegment(filepath.Join(configs.MinerDataPath, configs.SegmentData))
+	enableS, err = enableSpace()
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v] %v", configs.MinerId_S, err)
+	}
+	if enableS == 0 {
+		tk.Delay(configs.BlocksToWaitSpace)
+		return
+	}
+	segmentNum, err = getSegmentNumForTypeOne(segmentPath, configs.SegMentType_8M_S)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		return
+	}
+	if segmentNum >= 100 {
+		segsizeType = configs.SegMentType_512M
+	} else {
+		segsizeType = configs.SegMentType_8M
+	}
 
-			segmentId, randnum, err := chain.IntentSubmitToChain(
-				configs.Confile.MinerData.IdAccountPhraseOrSeed,
-				configs.ChainTx_SegmentBook_IntentSubmit,
-				segsizeType,
-				segType,
-				configs.MinerId_I,
-				nil,
-				nil,
-				nil,
-			)
-			if err != nil || randnum == 0 || segmentId == 0 {
-				logger.ErrLogger.Sugar().Errorf("[%v][%v][%v]", err, segmentId, randnum)
-				continue
-			}
-			// porepRandData, err = chain.GetSeedNumOnChain(
-			// 	configs.Confile.MinerData.IdAccountPhraseOrSeed,
-			// 	configs.ChainModule_SegmentBook,
-			// 	configs.ChainModule_SegmentBook_ParamSetA,
-			// )
-			// if err != nil {
-			// 	logger.ErrLogger.Sugar().Errorf("%v", err)
-			// 	continue
-			// }
-
-			secid := SectorID{
-				PeerID:    abi.ActorID(configs.MinerId_I),
-				SectorNum: abi.SectorNumber(segmentId),
-			}
-			seed, err := tools.IntegerToBytes(randnum)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			var cid cid.Cid
-			var prf []byte
-			cid, prf, err = GenerateSenmentVpa(secid, seed, seed, abi.RegisteredSealProof(segsizeType))
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			sproof := ""
-			for i := 0; i < len(prf); i++ {
-				var tmp = fmt.Sprintf("%#02x", prf[i])
-				sproof += tmp[2:]
-			}
-			ok, err = chain.SegmentSubmitToVpaOrVpb(
-				configs.Confile.MinerData.IdAccountPhraseOrSeed,
-				configs.ChainTx_SegmentBook_SubmitToVpa,
-				configs.MinerId_I,
-				uint64(segmentId),
-				[]byte(sproof),
-				[]byte(cid.String()),
-			)
-			if !ok || err != nil {
-				logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpa, segmentId, sproof, cid.String(), err)
-			} else {
-				logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpa, segmentId, sproof, cid.String())
-			}
-		} else {
-			time.Sleep(time.Minute * 10)
-		}
+	segmentId, randnum, err := chain.Client.IntentSubmitToChain(
+		keystore.Secret(),
+		configs.ChainTx_SegmentBook_IntentSubmit,
+		segsizeType,
+		segType,
+		configs.MinerId_I,
+		nil,
+		nil,
+		nil,
+	)
+	if err != nil || randnum == 0 || segmentId == 0 {
+		logger.ErrLogger.Sugar().Errorf("[%v][%v][%v]", err, segmentId, randnum)
+		return
+	}
+	// porepRandData, err = chain.GetSeedNumOnChain(
+	// 	keystore.Secret(),
+	// 	configs.ChainModule_SegmentBook,
+	// 	configs.ChainModule_SegmentBook_ParamSetA,
+	// )
+	// if err != nil {
+	// 	logger.ErrLogger.Sugar().Errorf("%v", err)
+	// 	continue
+	// }
+
+	secid := SectorID{
+		PeerID:    abi.ActorID(configs.MinerId_I),
+		SectorNum: abi.SectorNumber(segmentId),
+	}
+	seed, err := tools.IntegerToBytes(randnum)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		return
+	}
+	var cid cid.Cid
+	var prf []byte
+	cid, prf, err = sealSegment(secid, seed, seed, abi.RegisteredSealProof(segsizeType))
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		return
+	}
+	sproof := ""
+	for i := 0; i < len(prf); i++ {
+		var tmp = fmt.Sprintf("%#02x", prf[i])
+		sproof += tmp[2:]
+	}
+	ok, err = chain.Client.SegmentSubmitToVpaOrVpb(
+		keystore.Secret(),
+		configs.ChainTx_SegmentBook_SubmitToVpa,
+		configs.MinerId_I,
+		uint64(segmentId),
+		[]byte(sproof),
+		[]byte(cid.String()),
+	)
+	if !ok || err != nil {
+		logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpa, segmentId, sproof, cid.String(), err)
+	} else {
+		logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpa, segmentId, sproof, cid.String())
 	}
 }
 
 func segmentVpb() {
+	var idle bool
+	tk := newBlockTicker("vpb", configs.BlocksToRetryProof)
+	tk.Follow(router.vpb, router.Live)
+	defer tk.Stop()
+	for {
+		tk.Wait()
+		// a newly verified segment waits for the next window, unless
+		// there was nothing to prove
+		if tk.Event != nil && tk.Event.Kind == chain.Proof_Vpa && !idle {
+			continue
+		}
+		idle = vpbRound(tk)
+	}
+}
+
+// Prove the verified idle segments, reports whether there were none
+func vpbRound(tk *blockTicker) bool {
 	var (
 		err           error
 		ok            bool
@@ -158,335 +224,374 @@ func segmentVpb() {
 		postproofType uint8
 		segType       uint8
 		randnum       uint32
+		retrySoon     bool
 		sealcid       string
 	)
 	segType = 1
-	tk := time.NewTicker(time.Minute)
-	for range tk.C {
-		var verifiedPorepData []chain.IpostParaInfo
-		verifiedPorepData, err = chain.GetVpaPostOnChain(
-			configs.Confile.MinerData.IdAccountPhraseOrSeed,
-			configs.ChainModule_SegmentBook,
-			configs.ChainModule_SegmentBook_ConProofInfoA,
+	var verifiedPorepData []chain.IpostParaInfo
+	verifiedPorepData, err = chain.Client.GetVpaPostOnChain(
+		keystore.Secret(),
+		configs.ChainModule_SegmentBook,
+		configs.ChainModule_SegmentBook_ConProofInfoA,
+	)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		tk.Retry(configs.BlocksToRetryProof)
+		return false
+	}
+	tk.ResetWindow(proofWindow())
+	if len(verifiedPorepData) == 0 {
+		tk.Reset(configs.BlocksToRetryProof)
+		return true
+	}
+	logger.InfoLogger.Sugar().Infof("[%v] vpb round of %v segments at block %v", configs.MinerId_S, len(verifiedPorepData), tk.Head.Number)
+	for i := 0; i < len(verifiedPorepData); i++ {
+		sealcid = ""
+		sizetypes := fmt.Sprintf("%v", verifiedPorepData[i].SizeType)
+		switch sizetypes {
+		case "8":
+			segsizetype = 1
+			postproofType = 6
+		case "512":
+			segsizetype = 2
+			postproofType = 7
+		}
+		randnum, err = chain.Client.IntentSubmitPostToChain(
+			keystore.Secret(),
+			configs.ChainTx_SegmentBook_IntentSubmitPost,
+			uint64(verifiedPorepData[i].SegmentId),
+			segsizetype,
+			segType,
 		)
+		if err != nil || randnum == 0 {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			retrySoon = retrySoon || !chain.IsPermanent(err)
+			continue
+		}
+		// postRandData, err = chain.GetSeedNumOnChain(
+		// 	keystore.Secret(),
+		// 	configs.ChainModule_SegmentBook,
+		// 	configs.ChainModule_SegmentBook_ParamSetB,
+		// )
+		// if err != nil {
+		// 	logger.ErrLogger.Sugar().Errorf("%v", err)
+		// 	continue
+		// }
+
+		secid := SectorID{
+			PeerID:    abi.ActorID(verifiedPorepData[i].PeerId),
+			SectorNum: abi.SectorNumber(verifiedPorepData[i].SegmentId),
+		}
+		seed, err := tools.IntegerToBytes(randnum)
 		if err != nil {
 			logger.ErrLogger.Sugar().Errorf("%v", err)
-			tk.Reset(time.Minute)
 			continue
-		} else {
-			tk.Reset(time.Minute * time.Duration(configs.Vpb_SubmintPeriod))
-		}
-		if len(verifiedPorepData) == 0 {
-			tk.Reset(time.Minute)
-		}
-		for i := 0; i < len(verifiedPorepData); i++ {
-			sealcid = ""
-			sizetypes := fmt.Sprintf("%v", verifiedPorepData[i].Size_type)
-			switch sizetypes {
-			case "8":
-				segsizetype = 1
-				postproofType = 6
-			case "512":
-				segsizetype = 2
-				postproofType = 7
-			}
-			randnum, err = chain.IntentSubmitPostToChain(
-				configs.Confile.MinerData.IdAccountPhraseOrSeed,
-				configs.ChainTx_SegmentBook_IntentSubmitPost,
-				uint64(verifiedPorepData[i].Segment_id),
-				segsizetype,
-				segType,
-			)
-			if err != nil || randnum == 0 {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			// postRandData, err = chain.GetSeedNumOnChain(
-			// 	configs.Confile.MinerData.IdAccountPhraseOrSeed,
-			// 	configs.ChainModule_SegmentBook,
-			// 	configs.ChainModule_SegmentBook_ParamSetB,
-			// )
-			// if err != nil {
-			// 	logger.ErrLogger.Sugar().Errorf("%v", err)
-			// 	continue
-			// }
-
-			secid := SectorID{
-				PeerID:    abi.ActorID(verifiedPorepData[i].Peer_id),
-				SectorNum: abi.SectorNumber(verifiedPorepData[i].Segment_id),
-			}
-			seed, err := tools.IntegerToBytes(randnum)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			for j := 0; j < len(verifiedPorepData[i].Sealed_cid); j++ {
-				temp := fmt.Sprintf("%c", verifiedPorepData[i].Sealed_cid[j])
-				sealcid += temp
-			}
-			prf, err := generateSenmentVpb(secid, segsizetype, abi.RegisteredPoStProof(postproofType), []string{sealcid}, seed)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			spostproof := ""
-			for j := 0; j < len(prf[0].ProofBytes); j++ {
-				var tmp = fmt.Sprintf("%#02x", prf[0].ProofBytes[j])
-				spostproof += tmp[2:]
-			}
+		}
+		for j := 0; j < len(verifiedPorepData[i].SealedCid); j++ {
+			temp := fmt.Sprintf("%c", verifiedPorepData[i].SealedCid[j])
+			sealcid += temp
+		}
+		prf, err := proveSegment(secid, segsizetype, abi.RegisteredPoStProof(postproofType), []string{sealcid}, seed)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		spostproof := ""
+		for j := 0; j < len(prf[0].ProofBytes); j++ {
+			var tmp = fmt.Sprintf("%#02x", prf[0].ProofBytes[j])
+			spostproof += tmp[2:]
+		}
 
-			ok, err = chain.SegmentSubmitToVpaOrVpb(
-				configs.Confile.MinerData.IdAccountPhraseOrSeed,
-				configs.ChainTx_SegmentBook_SubmitToVpb,
-				uint64(verifiedPorepData[i].Peer_id),
-				uint64(verifiedPorepData[i].Segment_id),
-				[]byte(spostproof),
-				verifiedPorepData[i].Sealed_cid,
-			)
-			if !ok || err != nil {
-				logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpb, verifiedPorepData[i].Segment_id, spostproof, sealcid, err)
-			} else {
-				logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpb, verifiedPorepData[i].Segment_id, spostproof, sealcid)
-			}
+		ok, err = chain.Client.SegmentSubmitToVpaOrVpb(
+			keystore.Secret(),
+			configs.ChainTx_SegmentBook_SubmitToVpb,
+			uint64(verifiedPorepData[i].PeerId),
+			uint64(verifiedPorepData[i].SegmentId),
+			[]byte(spostproof),
+			verifiedPorepData[i].SealedCid,
+		)
+		if !ok || err != nil {
+			retrySoon = retrySoon || !chain.IsPermanent(err)
+			logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpb, verifiedPorepData[i].SegmentId, spostproof, sealcid, err)
+		} else {
+			logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpb, verifiedPorepData[i].SegmentId, spostproof, sealcid)
 		}
 	}
+	// transient faults are retried before the next period, permanent
+	// rejections by the runtime wait for the next challenge
+	if retrySoon {
+		tk.Retry(configs.BlocksToRetryProof)
+	}
+	return false
 }
 
 func segmentVpc() {
+	fileSegPath := filepath.Join(configs.MinerDataPath, configs.FileData)
+	tk := newBlockTicker("vpc", 1)
+	tk.Follow(router.vpc, router.Live)
+	defer tk.Stop()
+	for {
+		tk.Wait()
+		vpcRound(tk, fileSegPath)
+	}
+}
+
+// Seal the file slices assigned to the miner and submit their proofs
+func vpcRound(tk *blockTicker, fileSegPath string) {
 	var (
 		err error
 		ok  bool
 	)
-	fileSegPath := filepath.Join(configs.MinerDataPath, configs.FileData)
-	tk := time.NewTicker(time.Second)
-	for range tk.C {
-		var unsealedcidData []chain.UnsealedCidInfo
-		unsealedcidData, err = chain.GetunsealcidOnChain(
-			configs.Confile.MinerData.IdAccountPhraseOrSeed,
-			configs.ChainModule_SegmentBook,
-			configs.ChainModule_SegmentBook_MinerHoldSlice,
-		)
+	// the assigned file slices are refused once the miner is exiting
+	if chain.Exiting() {
+		tk.Delay(configs.BlocksToRetryProof)
+		return
+	}
+	var unsealedcidData []chain.UnsealedCidInfo
+	unsealedcidData, err = chain.Client.GetunsealcidOnChain(
+		keystore.Secret(),
+		configs.ChainModule_SegmentBook,
+		configs.ChainModule_SegmentBook_MinerHoldSlice,
+	)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		tk.Retry(configs.BlocksToRetryProof)
+		return
+	}
+	_, err = os.Stat(fileSegPath)
+	if err != nil {
+		err = os.MkdirAll(fileSegPath, os.ModePerm)
 		if err != nil {
 			logger.ErrLogger.Sugar().Errorf("%v", err)
-			time.Sleep(time.Minute)
-			continue
+			return
 		}
-		_, err = os.Stat(fileSegPath)
-		if err != nil {
-			err = os.MkdirAll(fileSegPath, os.ModePerm)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
+	}
+	if len(unsealedcidData) == 0 {
+		tk.Delay(configs.BlocksToRetryProof)
+	}
+	for i := 0; i < len(unsealedcidData); i++ {
+		hash := ""
+		shardhash := ""
+		uncidstring := ""
+		uncid := make([]string, 0)
+		for j := 0; j < len(unsealedcidData[i].Hash); j++ {
+			temp := fmt.Sprintf("%c", unsealedcidData[i].Hash[j])
+			hash += temp
 		}
-		if len(unsealedcidData) == 0 {
-			time.Sleep(time.Minute)
-		}
-		for i := 0; i < len(unsealedcidData); i++ {
-			hash := ""
-			shardhash := ""
-			uncidstring := ""
-			uncid := make([]string, 0)
-			for j := 0; j < len(unsealedcidData[i].Hash); j++ {
-				temp := fmt.Sprintf("%c", unsealedcidData[i].Hash[j])
-				hash += temp
-			}
-			for j := 0; j < len(unsealedcidData[i].Shardhash); j++ {
-				temp := fmt.Sprintf("%c", unsealedcidData[i].Shardhash[j])
-				shardhash += temp
-			}
-			for j := 0; j < len(unsealedcidData[i].Uncid); j++ {
-				uncidstring = ""
-				for k := 0; k < len(unsealedcidData[i].Uncid[j]); k++ {
-					temp := fmt.Sprintf("%c", unsealedcidData[i].Uncid[j][k])
-					uncidstring += temp
-				}
-				uncid = append(uncid, uncidstring)
-			}
-			seed, err := tools.IntegerToBytes(unsealedcidData[i].Rand)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
+		for j := 0; j < len(unsealedcidData[i].Shardhash); j++ {
+			temp := fmt.Sprintf("%c", unsealedcidData[i].Shardhash[j])
+			shardhash += temp
+		}
+		for j := 0; j < len(unsealedcidData[i].Uncid); j++ {
+			uncidstring = ""
+			for k := 0; k < len(unsealedcidData[i].Uncid[j]); k++ {
+				temp := fmt.Sprintf("%c", unsealedcidData[i].Uncid[j][k])
+				uncidstring += temp
 			}
+			uncid = append(uncid, uncidstring)
+		}
+		seed, err := tools.IntegerToBytes(unsealedcidData[i].Rand)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
 
-			filehashid := filepath.Join(fileSegPath, fmt.Sprintf("%v", hash))
-			_, err = os.Stat(filehashid)
-			if err != nil {
-				err = os.MkdirAll(filehashid, os.ModePerm)
-				if err != nil {
-					logger.ErrLogger.Sugar().Errorf("%v", err)
-					continue
-				}
-			}
-			filesegid := filepath.Join(filehashid, fmt.Sprintf("%v", unsealedcidData[i].Segment_id))
-			_, err = os.Stat(filesegid)
-			if err == nil {
-				os.RemoveAll(filesegid)
-			}
-			err = os.MkdirAll(filesegid, os.ModePerm)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			filefullpath := ""
-			if hash == shardhash {
-				filefullpath = filepath.Join(configs.Confile.FileSystem.DfsInstallPath, "files", hash, hash+".cess")
-			} else {
-				filefullpath = filepath.Join(configs.Confile.FileSystem.DfsInstallPath, "files", hash, shardhash)
-			}
-			sealcid, prf, err := generateSegmentVpc(filefullpath, filesegid, uint64(unsealedcidData[i].Segment_id), seed, uncid)
+		filehashid := filepath.Join(fileSegPath, fmt.Sprintf("%v", hash))
+		_, err = os.Stat(filehashid)
+		if err != nil {
+			err = os.MkdirAll(filehashid, os.ModePerm)
 			if err != nil {
 				logger.ErrLogger.Sugar().Errorf("%v", err)
 				continue
 			}
-			var sealedcid = make([]types.Bytes, len(sealcid))
-			for m := 0; m < len(sealcid); m++ {
-				sealedcid[m] = make(types.Bytes, 0)
-				sealedcid[m] = append(sealedcid[m], types.NewBytes([]byte(sealcid[m].String()))...)
-			}
+		}
+		filesegid := filepath.Join(filehashid, fmt.Sprintf("%v", unsealedcidData[i].SegmentId))
+		_, err = os.Stat(filesegid)
+		if err == nil {
+			os.RemoveAll(filesegid)
+		}
+		err = os.MkdirAll(filesegid, os.ModePerm)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		filefullpath := ""
+		if hash == shardhash {
+			filefullpath = filepath.Join(configs.Confile.FileSystem.DfsInstallPath, "files", hash, hash+".cess")
+		} else {
+			filefullpath = filepath.Join(configs.Confile.FileSystem.DfsInstallPath, "files", hash, shardhash)
+		}
+		sealcid, prf, err := sealFileSlice(filefullpath, filesegid, uint64(unsealedcidData[i].SegmentId), seed, uncid)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		var sealedcid = make([]types.Bytes, len(sealcid))
+		for m := 0; m < len(sealcid); m++ {
+			sealedcid[m] = make(types.Bytes, 0)
+			sealedcid[m] = append(sealedcid[m], types.NewBytes([]byte(sealcid[m].String()))...)
+		}
 
-			ok, err = chain.SegmentSubmitToVpc(
-				configs.Confile.MinerData.IdAccountPhraseOrSeed,
-				configs.ChainTx_SegmentBook_SubmitToVpc,
-				uint64(unsealedcidData[i].Peer_id),
-				uint64(unsealedcidData[i].Segment_id),
-				prf,
-				sealedcid,
-			)
-			if !ok || err != nil {
-				logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpc, unsealedcidData[i].Segment_id, prf, sealcid, err)
-			} else {
-				logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpc, unsealedcidData[i].Segment_id, prf, sealcid)
-			}
+		ok, err = chain.Client.SegmentSubmitToVpc(
+			keystore.Secret(),
+			uint64(unsealedcidData[i].PeerId),
+			uint64(unsealedcidData[i].SegmentId),
+			prf,
+			sealedcid,
+		)
+		if !ok || err != nil {
+			logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpc, unsealedcidData[i].SegmentId, prf, sealcid, err)
+		} else {
+			logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpc, unsealedcidData[i].SegmentId, prf, sealcid)
 		}
 	}
 }
 
 func segmentVpd() {
+	var idle bool
+	tk := newWindowTicker("vpd", proofWindow())
+	tk.Follow(router.vpd, router.Live)
+	defer tk.Stop()
+	for {
+		tk.Wait()
+		if tk.Event != nil && tk.Event.Kind == chain.Proof_Vpc && !idle {
+			continue
+		}
+		idle = vpdRound(tk)
+	}
+}
+
+// Prove the verified file slices, reports whether there were none
+func vpdRound(tk *blockTicker) bool {
 	var (
 		err         error
 		ok          bool
 		segType     uint8
 		segsizetype uint8
 		randnum     uint32
+		retrySoon   bool
 		// postRandData chain.ParamInfo
 	)
 	segsizetype = 1
 	segType = 2
-	tk := time.NewTicker(time.Minute * time.Duration(configs.Vpd_SubmintPeriod))
-
-	for range tk.C {
-		var verifiedPorepData []chain.FpostParaInfo
-		verifiedPorepData, err = chain.GetVpcPostOnChain(
-			configs.Confile.MinerData.IdAccountPhraseOrSeed,
-			configs.ChainModule_SegmentBook,
-			configs.ChainModule_SegmentBook_ConProofInfoC,
+	var verifiedPorepData []chain.FpostParaInfo
+	verifiedPorepData, err = chain.Client.GetVpcPostOnChain(
+		keystore.Secret(),
+		configs.ChainModule_SegmentBook,
+		configs.ChainModule_SegmentBook_ConProofInfoC,
+	)
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+		tk.Retry(configs.BlocksToRetryProof)
+		return false
+	}
+	tk.ResetWindow(proofWindow())
+	if len(verifiedPorepData) == 0 {
+		tk.Reset(configs.BlocksToRetryProof)
+		return true
+	}
+	logger.InfoLogger.Sugar().Infof("[%v] vpd round of %v segments at block %v", configs.MinerId_S, len(verifiedPorepData), tk.Head.Number)
+	for i := 0; i < len(verifiedPorepData); i++ {
+		randnum, err = chain.Client.IntentSubmitPostToChain(
+			keystore.Secret(),
+			configs.ChainTx_SegmentBook_IntentSubmitPost,
+			uint64(verifiedPorepData[i].SegmentId),
+			segsizetype,
+			segType,
 		)
+		if err != nil || randnum == 0 {
+			logger.ErrLogger.Sugar().Errorf("[%v][%v]", err, randnum)
+			retrySoon = retrySoon || !chain.IsPermanent(err)
+			continue
+		}
+		// postRandData, err = chain.GetSeedNumOnChain(
+		// 	keystore.Secret(),
+		// 	configs.ChainModule_SegmentBook,
+		// 	configs.ChainModule_SegmentBook_ParamSetD,
+		// )
+		// if err != nil {
+		// 	logger.ErrLogger.Sugar().Errorf("%v", err)
+		// 	continue
+		// }
+
+		sealcidstring := ""
+		sealcid := make([]string, 0)
+		for j := 0; j < len(verifiedPorepData[i].SealedCid); j++ {
+			sealcidstring = ""
+			for k := 0; k < len(verifiedPorepData[i].SealedCid[j]); k++ {
+				temp := fmt.Sprintf("%c", verifiedPorepData[i].SealedCid[j][k])
+				sealcidstring += temp
+			}
+			sealcid = append(sealcid, sealcidstring)
+		}
+		seed, err := tools.IntegerToBytes(randnum)
 		if err != nil {
 			logger.ErrLogger.Sugar().Errorf("%v", err)
-			tk.Reset(time.Minute)
 			continue
-		} else {
-			tk.Reset(time.Minute * time.Duration(configs.Vpd_SubmintPeriod))
-		}
-		if len(verifiedPorepData) == 0 {
-			tk.Reset(time.Minute)
-		}
-		for i := 0; i < len(verifiedPorepData); i++ {
-			randnum, err = chain.IntentSubmitPostToChain(
-				configs.Confile.MinerData.IdAccountPhraseOrSeed,
-				configs.ChainTx_SegmentBook_IntentSubmitPost,
-				uint64(verifiedPorepData[i].Segment_id),
-				segsizetype,
-				segType,
-			)
-			if err != nil || randnum == 0 {
-				logger.ErrLogger.Sugar().Errorf("[%v][%v]", err, randnum)
-				continue
-			}
-			// postRandData, err = chain.GetSeedNumOnChain(
-			// 	configs.Confile.MinerData.IdAccountPhraseOrSeed,
-			// 	configs.ChainModule_SegmentBook,
-			// 	configs.ChainModule_SegmentBook_ParamSetD,
-			// )
-			// if err != nil {
-			// 	logger.ErrLogger.Sugar().Errorf("%v", err)
-			// 	continue
-			// }
-
-			sealcidstring := ""
-			sealcid := make([]string, 0)
-			for j := 0; j < len(verifiedPorepData[i].Sealed_cid); j++ {
-				sealcidstring = ""
-				for k := 0; k < len(verifiedPorepData[i].Sealed_cid[j]); k++ {
-					temp := fmt.Sprintf("%c", verifiedPorepData[i].Sealed_cid[j][k])
-					sealcidstring += temp
-				}
-				sealcid = append(sealcid, sealcidstring)
-			}
-			seed, err := tools.IntegerToBytes(randnum)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
+		}
 
-			fileSegPath := filepath.Join(configs.MinerDataPath, configs.FileData)
-			_, err = os.Stat(fileSegPath)
-			if err != nil {
-				err = os.MkdirAll(fileSegPath, os.ModePerm)
-				if err != nil {
-					logger.ErrLogger.Sugar().Errorf("%v", err)
-					continue
-				}
-			}
-			hash := ""
-			for j := 0; j < len(verifiedPorepData[i].Hash); j++ {
-				temp := fmt.Sprintf("%c", verifiedPorepData[i].Hash[j])
-				hash += temp
-			}
-			filehashid := filepath.Join(fileSegPath, fmt.Sprintf("%v", hash))
-			_, err = os.Stat(filehashid)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			filesegid := filepath.Join(filehashid, fmt.Sprintf("%v", verifiedPorepData[i].Segment_id))
-			_, err = os.Stat(filesegid)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			cachepath := filepath.Join(filesegid, configs.Cache)
-			_, err = os.Stat(cachepath)
-			if err != nil {
-				logger.ErrLogger.Sugar().Errorf("%v", err)
-				continue
-			}
-			postprf, err := generateSenmentVpd(filesegid, cachepath, uint64(verifiedPorepData[i].Segment_id), seed, sealcid)
+		fileSegPath := filepath.Join(configs.MinerDataPath, configs.FileData)
+		_, err = os.Stat(fileSegPath)
+		if err != nil {
+			err = os.MkdirAll(fileSegPath, os.ModePerm)
 			if err != nil {
 				logger.ErrLogger.Sugar().Errorf("%v", err)
 				continue
 			}
-			var proof = make([][]byte, len(postprf))
-			for j := 0; j < len(postprf); j++ {
-				proof[j] = make([]byte, 0)
-				proof[j] = append(proof[j], postprf[j].ProofBytes...)
-			}
-			ok, err = chain.SegmentSubmitToVpd(
-				configs.Confile.MinerData.IdAccountPhraseOrSeed,
-				configs.ChainTx_SegmentBook_SubmitToVpd,
-				uint64(verifiedPorepData[i].Peer_id),
-				uint64(verifiedPorepData[i].Segment_id),
-				proof,
-				verifiedPorepData[i].Sealed_cid,
-			)
-			if !ok || err != nil {
-				logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpd, verifiedPorepData[i].Segment_id, proof, sealcid, err)
-			} else {
-				logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpd, verifiedPorepData[i].Segment_id, proof, sealcid)
-			}
 		}
+		hash := ""
+		for j := 0; j < len(verifiedPorepData[i].Hash); j++ {
+			temp := fmt.Sprintf("%c", verifiedPorepData[i].Hash[j])
+			hash += temp
+		}
+		filehashid := filepath.Join(fileSegPath, fmt.Sprintf("%v", hash))
+		_, err = os.Stat(filehashid)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		filesegid := filepath.Join(filehashid, fmt.Sprintf("%v", verifiedPorepData[i].SegmentId))
+		_, err = os.Stat(filesegid)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		cachepath := filepath.Join(filesegid, configs.Cache)
+		_, err = os.Stat(cachepath)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		postprf, err := proveFileSlice(filesegid, cachepath, uint64(verifiedPorepData[i].SegmentId), seed, sealcid)
+		if err != nil {
+			logger.ErrLogger.Sugar().Errorf("%v", err)
+			continue
+		}
+		var proof = make([][]byte, len(postprf))
+		for j := 0; j < len(postprf); j++ {
+			proof[j] = make([]byte, 0)
+			proof[j] = append(proof[j], postprf[j].ProofBytes...)
+		}
+		ok, err = chain.Client.SegmentSubmitToVpd(
+			keystore.Secret(),
+			uint64(verifiedPorepData[i].PeerId),
+			uint64(verifiedPorepData[i].SegmentId),
+			proof,
+			verifiedPorepData[i].SealedCid,
+		)
+		if !ok || err != nil {
+			retrySoon = retrySoon || !chain.IsPermanent(err)
+			logger.ErrLogger.Sugar().Errorf("[%v][%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpd, verifiedPorepData[i].SegmentId, proof, sealcid, err)
+		} else {
+			logger.InfoLogger.Sugar().Infof("[%v][%v][%v][%v]", configs.ChainTx_SegmentBook_SubmitToVpd, verifiedPorepData[i].SegmentId, proof, sealcid)
+		}
+	}
+	// transient faults are retried before the next period, permanent
+	// rejections by the runtime wait for the next challenge
+	if retrySoon {
+		tk.Retry(configs.BlocksToRetryProof)
 	}
+	return false
 }
 
 func getMountPathInfo(mountpath string) (mountpathInfo, error) {
@@ -0,0 +1,228 @@
+package proof
+
+import (
+	"os"
+	"path/filepath"
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"storage-mining/internal/keystore"
+	"storage-mining/internal/logger"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	prf "github.com/filecoin-project/specs-actors/actors/runtime/proof"
+	"github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+)
+
+const testPhrase = "bottom drive obey lake curtain smoke basket hold race lonely fit walk"
+
+// A proof received by the fake chain
+type submittedProof struct {
+	kind      string
+	segmentid uint64
+	proof     string
+}
+
+// Register a miner on a fake chain and replace the proof generators with
+// ones that only create the directories the workers expect
+func setupMiner(t *testing.T) (*chain.FakeChain, *[]submittedProof) {
+	logger.InfoLogger = zap.NewNop()
+	logger.ErrLogger = zap.NewNop()
+	configs.MinerDataPath = t.TempDir()
+	err := keystore.UseSecret(testPhrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a new miner is not exiting
+	err = chain.LoadExitProgress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := chain.NewFakeChain(1)
+	proofs := new([]submittedProof)
+	fake.Verify = func(kind string, peerid, segmentid uint64, proof []byte) bool {
+		*proofs = append(*proofs, submittedProof{kind: kind, segmentid: segmentid, proof: string(proof)})
+		return true
+	}
+	client := chain.Client
+	chain.Client = fake
+
+	sealed, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seal, prove, sealFile, proveFile, space := sealSegment, proveSegment, sealFileSlice, proveFileSlice, enableSpace
+	sealSegment = func(sectorId SectorID, seed abi.InteractiveSealRandomness, ticket abi.SealRandomness, sealProofType abi.RegisteredSealProof) (cid.Cid, []byte, error) {
+		return sealed, []byte{0xa1}, nil
+	}
+	proveSegment = func(sectorId SectorID, segsizetype uint8, postProofType abi.RegisteredPoStProof, sealedCIDsStr []string, randomness []byte) ([]prf.PoStProof, error) {
+		return []prf.PoStProof{{ProofBytes: []byte{0xb1}}}, nil
+	}
+	sealFileSlice = func(file, filesegpath string, segid uint64, rand []byte, uncid []string) ([]cid.Cid, [][]byte, error) {
+		return []cid.Cid{sealed}, [][]byte{{0xc1}}, os.MkdirAll(filepath.Join(filesegpath, configs.Cache), os.ModePerm)
+	}
+	proveFileSlice = func(sealpath, cachePath string, segid uint64, rand []byte, sealcid []string) ([]prf.PoStProof, error) {
+		return []prf.PoStProof{{ProofBytes: []byte{0xd1}}}, nil
+	}
+	enableSpace = func() (uint64, error) {
+		return configs.Space_1GB, nil
+	}
+	t.Cleanup(func() {
+		chain.Client = client
+		sealSegment, proveSegment, sealFileSlice, proveFileSlice, enableSpace = seal, prove, sealFile, proveFile, space
+	})
+
+	ok, err := chain.Client.RegisterToChain(
+		keystore.Secret(),
+		"0x"+strings.Repeat("01", 32),
+		"127.0.0.1",
+		2000,
+		15001,
+		15002,
+	)
+	if !ok || err != nil {
+		t.Fatalf("register: %v %v", ok, err)
+	}
+	mdata, err := chain.Client.GetMinerDataOnChain(keystore.Secret(), configs.ChainModule_Sminer, configs.ChainModule_Sminer_MinerItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mdata.Peerid == 0 {
+		t.Fatal("the miner is not registered")
+	}
+	configs.MinerId_I = uint64(mdata.Peerid)
+	return fake, proofs
+}
+
+func testTicker(fake *chain.FakeChain) *blockTicker {
+	tk := newBlockTicker("test", 1)
+	height, _ := fake.GetBlockHeight()
+	tk.Head = chain.ChainHead{Number: height}
+	return tk
+}
+
+func TestRejectedVpa(t *testing.T) {
+	fake, _ := setupMiner(t)
+	fake.Verify = func(kind string, peerid, segmentid uint64, proof []byte) bool {
+		return false
+	}
+	vpaRound(testTicker(fake), filepath.Join(configs.MinerDataPath, configs.SegmentData))
+
+	vpa, err := chain.Client.GetVpaPostOnChain(keystore.Secret(), configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ConProofInfoA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vpa) != 0 {
+		t.Fatalf("a rejected proof is verified: %v", vpa)
+	}
+	if idle := vpbRound(testTicker(fake)); !idle {
+		t.Fatal("vpb proves a segment that was not verified")
+	}
+}
+
+func TestMiningWorkflow(t *testing.T) {
+	fake, proofs := setupMiner(t)
+
+	// vpa: intent, then the proof of the idle segment
+	vpaRound(testTicker(fake), filepath.Join(configs.MinerDataPath, configs.SegmentData))
+	vpa, err := chain.Client.GetVpaPostOnChain(keystore.Secret(), configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ConProofInfoA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vpa) != 1 || len(*proofs) != 1 || (*proofs)[0].kind != chain.Proof_Vpa || (*proofs)[0].proof != "a1" {
+		t.Fatalf("vpa: %v %v", vpa, *proofs)
+	}
+	idleSeg := uint64(vpa[0].SegmentId)
+	if string(vpa[0].SealedCid) != "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n" || vpa[0].SizeType.Int64() != 8 {
+		t.Fatalf("vpa: %v", vpa[0])
+	}
+	// the challenge of the intent is answered
+	if _, err = chain.Client.SegmentSubmitToVpaOrVpb(keystore.Secret(), configs.ChainTx_SegmentBook_SubmitToVpa, configs.MinerId_I, idleSeg, nil, nil); err == nil || !strings.Contains(err.Error(), "NoIntentSubmitYet") {
+		t.Fatalf("the vpa challenge is still open: %v", err)
+	}
+
+	// vpb: the verified idle segment is proven
+	if idle := vpbRound(testTicker(fake)); idle {
+		t.Fatal("vpb found no verified segments")
+	}
+	if len(*proofs) != 2 || (*proofs)[1].kind != chain.Proof_Vpb || (*proofs)[1].segmentid != idleSeg || (*proofs)[1].proof != "b1" {
+		t.Fatalf("vpb: %v", *proofs)
+	}
+
+	// vpc: the assigned file slice is sealed and leaves MinerHoldSlice
+	if idle := vpdRound(testTicker(fake)); !idle {
+		t.Fatal("vpd found a file slice before one is assigned")
+	}
+	fileSeg := fake.AddFileSlice(configs.MinerId_I, "filehash", "filehash", [][]byte{[]byte("uncid")})
+	vpcRound(testTicker(fake), filepath.Join(configs.MinerDataPath, configs.FileData))
+	hold, err := chain.Client.GetunsealcidOnChain(keystore.Secret(), configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_MinerHoldSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vpc, err := chain.Client.GetVpcPostOnChain(keystore.Secret(), configs.ChainModule_SegmentBook, configs.ChainModule_SegmentBook_ConProofInfoC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hold) != 0 || len(vpc) != 1 || uint64(vpc[0].SegmentId) != fileSeg || string(vpc[0].Hash) != "filehash" {
+		t.Fatalf("vpc: %v %v", hold, vpc)
+	}
+	if (*proofs)[2].kind != chain.Proof_Vpc || (*proofs)[2].proof != "\xc1" {
+		t.Fatalf("vpc: %v", *proofs)
+	}
+
+	// vpd: the verified file slice is proven from its cache directory
+	if idle := vpdRound(testTicker(fake)); idle {
+		t.Fatal("vpd found no verified file slices")
+	}
+	if len(*proofs) != 4 || (*proofs)[3].kind != chain.Proof_Vpd || (*proofs)[3].segmentid != fileSeg || (*proofs)[3].proof != "\xd1" {
+		t.Fatalf("vpd: %v", *proofs)
+	}
+
+	// exit: no new segments, the collateral is withdrawn after the lock-in
+	err = chain.StartExit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chain.Exiting() {
+		t.Fatal("the miner is not exiting")
+	}
+	if p := chain.GetExitProgress(); p.Stage != chain.ExitStage_Exited || p.UnlockBlock != p.ExitBlock+fake.ExitLockBlocks {
+		t.Fatalf("exit progress: %v", p)
+	}
+	vpaRound(testTicker(fake), filepath.Join(configs.MinerDataPath, configs.SegmentData))
+	fake.AddFileSlice(configs.MinerId_I, "otherhash", "otherhash", nil)
+	vpcRound(testTicker(fake), filepath.Join(configs.MinerDataPath, configs.FileData))
+	if len(*proofs) != 4 {
+		t.Fatalf("proofs submitted while exiting: %v", *proofs)
+	}
+	if err = chain.WithdrawCollateral(); err == nil || chain.IsPermanent(err) {
+		t.Fatalf("withdrawn before the lock-in ends: %v", err)
+	}
+	if fake.Withdrawals != 0 {
+		t.Fatal("a withdrawal the dry run rejected was submitted")
+	}
+	// without a dry run the withdrawal is submitted and rejected
+	fake.NoDryRun = true
+	if err = chain.WithdrawCollateral(); err == nil || fake.Withdrawals != 1 {
+		t.Fatalf("withdrawal without a dry run: %v, %v submitted", err, fake.Withdrawals)
+	}
+	fake.NoDryRun = false
+	fake.Advance(fake.ExitLockBlocks)
+	err = chain.WithdrawCollateral()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := chain.GetExitProgress(); p.Stage != chain.ExitStage_Withdrawn {
+		t.Fatalf("exit progress: %v", p)
+	}
+	mdata, err := chain.Client.GetMinerDataOnChain(keystore.Secret(), configs.ChainModule_Sminer, configs.ChainModule_Sminer_MinerItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mdata.Peerid != 0 {
+		t.Fatalf("the miner is still registered: %v", mdata)
+	}
+}
@@ -0,0 +1,177 @@
+package proof
+
+import (
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"storage-mining/internal/logger"
+	"sync"
+	"time"
+)
+
+// Fires on new blocks of the chain, the block-driven counterpart of
+// time.Ticker, or on the events it follows. Nothing fires on the schedule
+// while the chain is stalled.
+type blockTicker struct {
+	name string
+	// blocks between two rounds
+	period uint64
+	// rounds start at multiples of the period
+	window bool
+	// block of the next round, 0 for the first head
+	next   uint64
+	heads  <-chan chain.ChainHead
+	cancel func()
+	// rounds are driven by these events while live reports true,
+	// the schedule is only kept as a fallback
+	events <-chan chain.MinerEvent
+	live   func() bool
+	// the next round is a retry, due even while the events are live
+	retry bool
+	// head of the current round
+	Head chain.ChainHead
+	// event that started the current round, nil for the schedule
+	Event *chain.MinerEvent
+}
+
+// Fire on the first head, then every period blocks
+func newBlockTicker(name string, period uint64) *blockTicker {
+	return &blockTicker{name: name, period: period, retry: true}
+}
+
+// Fire at the start of each window of period blocks
+func newWindowTicker(name string, period uint64) *blockTicker {
+	return &blockTicker{name: name, period: period, window: true}
+}
+
+// Wait for the block of the next round
+func (t *blockTicker) Wait() chain.ChainHead {
+	for {
+		if t.heads == nil {
+			heads, cancel, err := chain.Client.SubscribeHeads()
+			if err != nil {
+				logger.ErrLogger.Sugar().Errorf("[%v] %v", t.name, err)
+				time.Sleep(time.Second * 10)
+				continue
+			}
+			t.heads, t.cancel = heads, cancel
+		}
+		var (
+			h  chain.ChainHead
+			ok bool
+		)
+		select {
+		case ev := <-t.events:
+			t.Event = &ev
+			return t.Head
+		case h, ok = <-t.heads:
+		}
+		if !ok {
+			t.heads = nil
+			continue
+		}
+		t.Head = h
+		if t.next == 0 && t.window {
+			t.next = t.nextWindow()
+		}
+		if h.Number < t.next {
+			continue
+		}
+		if t.events != nil && t.live() && !t.retry {
+			continue
+		}
+		t.retry = false
+		t.Event = nil
+		if t.window {
+			t.next = t.nextWindow()
+		} else {
+			t.next = h.Number + t.period
+		}
+		return h
+	}
+}
+
+func (t *blockTicker) nextWindow() uint64 {
+	return (t.Head.Number/t.period + 1) * t.period
+}
+
+// Change the period, the next round is period blocks after the current
+// head. A window ticker turns into a plain one until ResetWindow.
+func (t *blockTicker) Reset(period uint64) {
+	t.period = period
+	t.window = false
+	t.next = t.Head.Number + period
+}
+
+// Go back to rounds at multiples of period, starting with the next window
+func (t *blockTicker) ResetWindow(period uint64) {
+	t.period = period
+	t.window = true
+	t.next = t.nextWindow()
+}
+
+// Drive the rounds by the events while live reports true
+func (t *blockTicker) Follow(events <-chan chain.MinerEvent, live func() bool) {
+	t.events = events
+	t.live = live
+}
+
+// Try again n blocks after the current head, also while the events are
+// live. The period is kept.
+func (t *blockTicker) Retry(n uint64) {
+	t.retry = true
+	t.next = t.Head.Number + n
+}
+
+// Put the next round off to n blocks after the current head, the period
+// is kept
+func (t *blockTicker) Delay(n uint64) {
+	t.next = t.Head.Number + n
+}
+
+func (t *blockTicker) Stop() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+var (
+	windowLock sync.Mutex
+	// block of the last timed task of the chain and the blocks since the
+	// one before, 0 while unknown
+	lastTimedTask uint64
+	timedTaskGap  uint64
+)
+
+// Learn the challenge window of the chain from its timed tasks
+func observeTimedTask(number uint64) {
+	windowLock.Lock()
+	defer windowLock.Unlock()
+	if number == 0 {
+		return
+	}
+	if lastTimedTask != 0 && number > lastTimedTask {
+		timedTaskGap = number - lastTimedTask
+	}
+	lastTimedTask = number
+}
+
+// Blocks of the Vpb and Vpd windows: the interval of the timed tasks of
+// the chain, or ProofWindow_S at the block time of the chain until two
+// of them were seen
+func proofWindow() uint64 {
+	windowLock.Lock()
+	gap := timedTaskGap
+	windowLock.Unlock()
+	if gap > 0 {
+		return gap
+	}
+	blockTime := time.Second * configs.BlockTime_S
+	d, ok, err := chain.Client.GetBlockTime()
+	if err != nil {
+		logger.ErrLogger.Sugar().Errorf("%v", err)
+	}
+	if ok {
+		blockTime = d
+	}
+	return uint64(time.Second * configs.ProofWindow_S / blockTime)
+}
@@ -0,0 +1,130 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Which calls the service signs
+type Policy struct {
+	// allowed calls, e.g. "Sminer.regnstk"
+	Calls map[string]bool
+	// find the call index of a call name, nothing is signed without it.
+	// The index is looked up again after a mismatch, in case of a
+	// runtime upgrade.
+	CallIndex func(call string, refresh bool) (types.CallIndex, error)
+	// genesis hash of the chain, a payload for another chain is refused
+	Genesis types.Hash
+}
+
+// The payload ends with the genesis and the block hash
+const payloadTail = 2 * len(types.Hash{})
+
+// Check the call of a payload against the policy
+func (p *Policy) Check(call string, payload []byte) error {
+	if !p.Calls[call] {
+		return errors.Errorf("call %v not allowed", call)
+	}
+	if p.CallIndex == nil {
+		return errors.Errorf("no call index to check the %v call against", call)
+	}
+	if p.Genesis == (types.Hash{}) {
+		return errors.New("no genesis hash to check the payload against")
+	}
+	if len(payload) < 2+payloadTail {
+		return errors.New("payload too short")
+	}
+	if !bytes.Equal(payload[len(payload)-payloadTail:len(payload)-payloadTail/2], p.Genesis[:]) {
+		return errors.Errorf("payload is not for the chain of genesis %v", p.Genesis.Hex())
+	}
+	for _, refresh := range []bool{false, true} {
+		ci, err := p.CallIndex(call, refresh)
+		if err != nil {
+			return err
+		}
+		if ci.SectionIndex == payload[0] && ci.MethodIndex == payload[1] {
+			return nil
+		}
+	}
+	return errors.Errorf("payload is not a %v call", call)
+}
+
+// Signing service
+type Server struct {
+	PublicKey []byte
+	Address   string
+	Token     string
+	Policy    *Policy
+	Sign      func(payload []byte) ([]byte, error)
+	// called for every request with the call and the outcome
+	Log func(call string, err error)
+
+	lock sync.Mutex
+}
+
+func (s *Server) Handler() http.Handler {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery(), s.auth)
+	r.GET(Path_Account, s.account)
+	r.POST(Path_Sign, s.sign)
+	return r
+}
+
+func (s *Server) auth(c *gin.Context) {
+	if s.Token == "" {
+		return
+	}
+	got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(s.Token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, SignResp{Error: "unauthorized"})
+	}
+}
+
+func (s *Server) account(c *gin.Context) {
+	c.JSON(http.StatusOK, AccountResp{PublicKey: types.HexEncodeToString(s.PublicKey), Address: s.Address})
+}
+
+func (s *Server) sign(c *gin.Context) {
+	var req SignReq
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, SignResp{Error: err.Error()})
+		return
+	}
+	payload, err := types.HexDecodeString(req.Payload)
+	if err != nil {
+		s.log(req.Call, err)
+		c.JSON(http.StatusBadRequest, SignResp{Error: "invalid payload"})
+		return
+	}
+	// policy lookups may refresh shared state, one request at a time
+	s.lock.Lock()
+	err = s.Policy.Check(req.Call, payload)
+	s.lock.Unlock()
+	if err != nil {
+		s.log(req.Call, err)
+		c.JSON(http.StatusForbidden, SignResp{Error: err.Error()})
+		return
+	}
+	sig, err := s.Sign(payload)
+	s.log(req.Call, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SignResp{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, SignResp{Signature: types.HexEncodeToString(sig)})
+}
+
+func (s *Server) log(call string, err error) {
+	if s.Log != nil {
+		s.Log(call, err)
+	}
+}
@@ -0,0 +1,177 @@
+package signer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"storage-mining/configs"
+	"storage-mining/internal/chain"
+	"storage-mining/internal/signer"
+	"strings"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+)
+
+const testPhrase = "bottom drive obey lake curtain smoke basket hold race lonely fit walk"
+
+// Genesis hash of the stand-in chain
+var testGenesis = types.NewHash([]byte(strings.Repeat("g", 32)))
+
+// Call indexes of a stand-in runtime, the service looks them up in the
+// metadata of its node
+var testCalls = map[string]types.CallIndex{
+	configs.ChainTx_Sminer_Register:         {SectionIndex: 10, MethodIndex: 0},
+	configs.ChainTx_Sminer_Withdraw:         {SectionIndex: 10, MethodIndex: 6},
+	configs.ChainTx_SegmentBook_SubmitToVpa: {SectionIndex: 11, MethodIndex: 2},
+}
+
+// A signing service for the test phrase that allows the registration and
+// the vpa proofs, with the call indexes of the stand-in runtime
+func newTestServer(t *testing.T, token string, lookups *int) (*httptest.Server, signature.KeyringPair) {
+	kp, err := signature.KeyringPairFromSecret(testPhrase, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &signer.Server{
+		PublicKey: kp.PublicKey,
+		Address:   kp.Address,
+		Token:     token,
+		Policy: &signer.Policy{
+			Calls: map[string]bool{
+				configs.ChainTx_Sminer_Register:         true,
+				configs.ChainTx_SegmentBook_SubmitToVpa: true,
+			},
+			CallIndex: func(call string, refresh bool) (types.CallIndex, error) {
+				*lookups++
+				ci, ok := testCalls[call]
+				if !ok {
+					return ci, errors.Errorf("call %v not found", call)
+				}
+				return ci, nil
+			},
+			Genesis: testGenesis,
+		},
+		Sign: func(payload []byte) ([]byte, error) {
+			return signature.Sign(payload, testPhrase)
+		},
+	}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv, kp
+}
+
+// The encoded payload of a call with the index of the stand-in runtime
+func testPayload(t *testing.T, call string) []byte {
+	return chainPayload(t, call, testGenesis)
+}
+
+func chainPayload(t *testing.T, call string, genesis types.Hash) []byte {
+	ci := testCalls[call]
+	b, err := types.EncodeToBytes(types.ExtrinsicPayloadV4{
+		ExtrinsicPayloadV3: types.ExtrinsicPayloadV3{
+			Method:      []byte{ci.SectionIndex, ci.MethodIndex, 1, 2, 3},
+			Era:         types.ExtrinsicEra{IsImmortalEra: true},
+			Nonce:       types.NewUCompactFromUInt(7),
+			Tip:         types.NewUCompactFromUInt(0),
+			SpecVersion: 100,
+			GenesisHash: genesis,
+			BlockHash:   types.NewHash([]byte(strings.Repeat("b", 32))),
+		},
+		TransactionVersion: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSignAllowedCall(t *testing.T) {
+	lookups := 0
+	srv, kp := newTestServer(t, "secret", &lookups)
+	s, err := chain.NewRemoteSigner(srv.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if types.HexEncodeToString(s.PublicKey()) != types.HexEncodeToString(kp.PublicKey) {
+		t.Fatalf("public key %x, want %x", s.PublicKey(), kp.PublicKey)
+	}
+	payload := testPayload(t, configs.ChainTx_SegmentBook_SubmitToVpa)
+	sig, err := s.Sign(configs.ChainTx_SegmentBook_SubmitToVpa, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := signature.Verify(payload, sig, testPhrase)
+	if err != nil || !ok {
+		t.Fatalf("invalid signature: %v %v", ok, err)
+	}
+}
+
+func TestRefuseCall(t *testing.T) {
+	lookups := 0
+	srv, _ := newTestServer(t, "secret", &lookups)
+	s, err := chain.NewRemoteSigner(srv.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a call that is not allowed
+	_, err = s.Sign(configs.ChainTx_Sminer_Withdraw, testPayload(t, configs.ChainTx_Sminer_Withdraw))
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("not allowed call signed: %v", err)
+	}
+	// an allowed name on the payload of another call, looked up again in
+	// case of a runtime upgrade
+	lookups = 0
+	_, err = s.Sign(configs.ChainTx_Sminer_Register, testPayload(t, configs.ChainTx_Sminer_Withdraw))
+	if err == nil || !strings.Contains(err.Error(), "payload is not a") {
+		t.Fatalf("mislabeled call signed: %v", err)
+	}
+	if lookups != 2 {
+		t.Fatalf("%v call index lookups, want 2", lookups)
+	}
+	// an allowed call for another chain
+	other := types.NewHash([]byte(strings.Repeat("o", 32)))
+	_, err = s.Sign(configs.ChainTx_Sminer_Register, chainPayload(t, configs.ChainTx_Sminer_Register, other))
+	if err == nil || !strings.Contains(err.Error(), "genesis") {
+		t.Fatalf("call for another chain signed: %v", err)
+	}
+}
+
+func TestRefuseUnauthorized(t *testing.T) {
+	lookups := 0
+	srv, _ := newTestServer(t, "secret", &lookups)
+	_, err := chain.NewRemoteSigner(srv.URL, "wrong")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("unauthorized request served: %v", err)
+	}
+	res, err := http.Post(srv.URL+signer.Path_Sign, "application/json", strings.NewReader(`{"call":"Sminer.regnstk","payload":"0x0a00"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status %v without a token", res.Status)
+	}
+}
+
+func TestPolicyWithoutCallIndex(t *testing.T) {
+	p := &signer.Policy{Calls: map[string]bool{configs.ChainTx_Sminer_Register: true}, Genesis: testGenesis}
+	err := p.Check(configs.ChainTx_Sminer_Register, testPayload(t, configs.ChainTx_Sminer_Register))
+	if err == nil {
+		t.Fatal("a call is signed without checking its index")
+	}
+}
+
+func TestPolicyWithoutGenesis(t *testing.T) {
+	p := &signer.Policy{
+		Calls: map[string]bool{configs.ChainTx_Sminer_Register: true},
+		CallIndex: func(call string, refresh bool) (types.CallIndex, error) {
+			return testCalls[call], nil
+		},
+	}
+	err := p.Check(configs.ChainTx_Sminer_Register, testPayload(t, configs.ChainTx_Sminer_Register))
+	if err == nil {
+		t.Fatal("a call is signed without checking its genesis")
+	}
+}
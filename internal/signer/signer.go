@@ -0,0 +1,32 @@
+package signer
+
+// A small HTTP/JSON protocol to sign the extrinsics of the identity
+// account on a separate host, which holds the key and decides which
+// calls it signs:
+//
+//	GET  /account  -> {"publicKey": "0x..", "address": ".."}
+//	POST /sign     {"call": "Sminer.regnstk", "payload": "0x.."}
+//	               -> {"signature": "0x.."} or {"error": ".."}
+//
+// payload is the encoded extrinsic payload, starting with the call index.
+// Requests carry "Authorization: Bearer <token>" when a token is set.
+
+const (
+	Path_Account = "/account"
+	Path_Sign    = "/sign"
+)
+
+type AccountResp struct {
+	PublicKey string `json:"publicKey"`
+	Address   string `json:"address"`
+}
+
+type SignReq struct {
+	Call    string `json:"call"`
+	Payload string `json:"payload"`
+}
+
+type SignResp struct {
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// SS58 addresses, see
+// https://docs.substrate.io/reference/address-formats/
+
+const accountIdLen = 32
+
+// Decode an account given as an SS58 address or as a hex public key.
+// An SS58 address must carry the network prefix of the chain.
+func ParseAccount(s string, prefix uint16) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") {
+		b, err := hex.DecodeString(s[2:])
+		if err != nil || len(b) != accountIdLen {
+			return nil, errors.New("invalid hex public key, expected 32 bytes")
+		}
+		return b, nil
+	}
+	pub, p, err := DecodeSS58(s)
+	if err != nil {
+		// a hex public key without 0x
+		if b, herr := hex.DecodeString(s); herr == nil && len(b) == accountIdLen {
+			return b, nil
+		}
+		return nil, err
+	}
+	if p != prefix {
+		return nil, errors.Errorf("address of network prefix %v, the chain uses %v", p, prefix)
+	}
+	return pub, nil
+}
+
+// Decode an SS58 address into the public key and network prefix
+func DecodeSS58(addr string) ([]byte, uint16, error) {
+	b, err := base58.Decode(addr)
+	if err != nil {
+		return nil, 0, errors.New("invalid SS58 address")
+	}
+	if len(b) < 1 {
+		return nil, 0, errors.New("invalid SS58 address")
+	}
+	var (
+		prefix    uint16
+		prefixLen int
+	)
+	switch {
+	case b[0] < 64:
+		prefix, prefixLen = uint16(b[0]), 1
+	case b[0] < 128:
+		if len(b) < 2 {
+			return nil, 0, errors.New("invalid SS58 address")
+		}
+		lower := b[0]<<2 | b[1]>>6
+		upper := b[1] & 0x3f
+		prefix, prefixLen = uint16(lower)|uint16(upper)<<8, 2
+	default:
+		return nil, 0, errors.New("invalid SS58 address prefix")
+	}
+	if len(b) != prefixLen+accountIdLen+2 {
+		return nil, 0, errors.New("invalid SS58 address length")
+	}
+	sum := ss58Checksum(b[:prefixLen+accountIdLen])
+	if sum[0] != b[len(b)-2] || sum[1] != b[len(b)-1] {
+		return nil, 0, errors.New("invalid SS58 address checksum")
+	}
+	return b[prefixLen : prefixLen+accountIdLen], prefix, nil
+}
+
+// Encode a public key as an SS58 address
+func EncodeSS58(pub []byte, prefix uint16) (string, error) {
+	if len(pub) != accountIdLen {
+		return "", errors.New("invalid public key length")
+	}
+	var b []byte
+	switch {
+	case prefix < 64:
+		b = []byte{byte(prefix)}
+	case prefix < 16384:
+		first := byte(prefix&0xfc) >> 2
+		second := byte(prefix>>8) | byte(prefix&0x03)<<6
+		b = []byte{first | 0x40, second}
+	default:
+		return "", errors.New("invalid SS58 prefix")
+	}
+	b = append(b, pub...)
+	sum := ss58Checksum(b)
+	return base58.Encode(append(b, sum[:2]...)), nil
+}
+
+func ss58Checksum(b []byte) [64]byte {
+	return blake2b.Sum512(append([]byte("SS58PRE"), b...))
+}
@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+var (
+	alicePub, _ = hex.DecodeString("d43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d")
+	bobPub, _   = hex.DecodeString("8eaf04151687736326c9fea17e25fc5287613693c912909cb226aa4794f26a48")
+)
+
+// Addresses of the substrate dev accounts
+var ss58Vectors = []struct {
+	pub    []byte
+	prefix uint16
+	addr   string
+}{
+	{alicePub, 42, "5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY"},
+	{bobPub, 42, "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"},
+	{alicePub, 0, "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"},
+	{alicePub, 2, "HNZata7iMYWmk5RvZRTiAsSDhV8366zq2YGb3tLH5Upf74F"},
+	// two byte prefixes
+	{alicePub, 11330, "cXjmuHdBk4J3Zyt2oGodwGegNFaTFPcfC48PZ9NMmcUFzF6cc"},
+	{bobPub, 11330, "cXiCk1Z1bva3fpsYHqsfzXJmQ9jSMw5FrZJFE61E6YVLkU6w2"},
+	{alicePub, 255, "yGHXkYLYqxijLKKfd9Q2CB9shRVu8rPNBS53wvwGTutYg4zTg"},
+	{alicePub, 16383, "yNa8JpqfFB3q8A29rCwSgxvdU94ufJw2yKKxDgznS5m1PoFvn"},
+}
+
+func TestEncodeSS58(t *testing.T) {
+	for _, v := range ss58Vectors {
+		addr, err := EncodeSS58(v.pub, v.prefix)
+		if err != nil || addr != v.addr {
+			t.Errorf("EncodeSS58(%x, %v) = %v %v, want %v", v.pub, v.prefix, addr, err, v.addr)
+		}
+	}
+	if _, err := EncodeSS58(alicePub, 16384); err == nil {
+		t.Error("prefix 16384 encoded")
+	}
+	if _, err := EncodeSS58(alicePub[:31], 42); err == nil {
+		t.Error("31 byte public key encoded")
+	}
+}
+
+func TestDecodeSS58(t *testing.T) {
+	for _, v := range ss58Vectors {
+		pub, prefix, err := DecodeSS58(v.addr)
+		if err != nil || prefix != v.prefix || !bytes.Equal(pub, v.pub) {
+			t.Errorf("DecodeSS58(%v) = %x %v %v, want %x %v", v.addr, pub, prefix, err, v.pub, v.prefix)
+		}
+	}
+}
+
+func TestParseAccount(t *testing.T) {
+	alice := ss58Vectors[0].addr
+	for _, c := range []struct {
+		in     string
+		prefix uint16
+		want   []byte
+		err    string
+	}{
+		{alice, 42, alicePub, ""},
+		{" " + alice + "\n", 42, alicePub, ""},
+		{"cXjmuHdBk4J3Zyt2oGodwGegNFaTFPcfC48PZ9NMmcUFzF6cc", 11330, alicePub, ""},
+		{"0xd43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d", 42, alicePub, ""},
+		{"d43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d", 11330, alicePub, ""},
+		// another network
+		{"15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5", 42, nil, "network prefix 0"},
+		{alice, 11330, nil, "network prefix 42"},
+		{"cXjmuHdBk4J3Zyt2oGodwGegNFaTFPcfC48PZ9NMmcUFzF6cc", 42, nil, "network prefix 11330"},
+		// last character changed
+		{alice[:len(alice)-1] + "Z", 42, nil, "checksum"},
+		{"cXjmuHdBk4J3Zyt2oGodwGegNFaTFPcfC48PZ9NMmcUFzF6cd", 11330, nil, "checksum"},
+		{alice[:len(alice)-2], 42, nil, "length"},
+		{"0xd43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da2", 42, nil, "hex public key"},
+		{"5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKut0Y", 42, nil, "invalid SS58"},
+		{"", 42, nil, "invalid SS58"},
+	} {
+		pub, err := ParseAccount(c.in, c.prefix)
+		if c.err == "" {
+			if err != nil || !bytes.Equal(pub, c.want) {
+				t.Errorf("ParseAccount(%q, %v) = %x %v, want %x", c.in, c.prefix, pub, err, c.want)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("ParseAccount(%q, %v) = %x %v, want an error about %v", c.in, c.prefix, pub, err, c.err)
+		}
+	}
+}